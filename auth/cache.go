@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Tokens are what a login leaves us with, the refresh token is good
+// for new JWT's without knowing the password.
+type Tokens struct {
+	Username     string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenCache keeps the tokens of each host in a file only readable by
+// the user, so later invocations can skip logging in.
+type TokenCache struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// DefaultTokenCachePath is where tokens are cached, unless told otherwise
+func DefaultTokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find cache directory: %w", err)
+	}
+
+	return filepath.Join(dir, "iectl", "tokens.json"), nil
+}
+
+// NewTokenCache returns a cache kept at path, which does not
+// have to exist until something is cached.
+func NewTokenCache(path string) *TokenCache {
+	return &TokenCache{Path: path}
+}
+
+func (c *TokenCache) read() (map[string]Tokens, error) {
+	tokens := make(map[string]Tokens)
+
+	fi, err := os.Stat(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token cache: %w", err)
+	}
+
+	// windows does not do unix permissions
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("token cache %s is accessible by others, it should only be readable by you (chmod 600)", c.Path)
+	}
+
+	p, err := os.ReadFile(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token cache: %w", err)
+	}
+
+	err = json.Unmarshal(p, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse token cache %s: %w", c.Path, err)
+	}
+
+	return tokens, nil
+}
+
+// write replaces the cache file, other invocations either see the old
+// or the new file - never half of it.
+func (c *TokenCache) write(tokens map[string]Tokens) error {
+	p, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal token cache: %w", err)
+	}
+
+	dir := filepath.Dir(c.Path)
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("unable to create token cache directory: %w", err)
+	}
+
+	// CreateTemp creates files only readable by us
+	fd, err := os.CreateTemp(dir, ".tokens-*")
+	if err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	defer os.Remove(fd.Name())
+
+	_, err = fd.Write(p)
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+
+	err = os.Rename(fd.Name(), c.Path)
+	if err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the tokens cached for host
+func (c *TokenCache) Get(host string) (Tokens, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens, err := c.read()
+	if err != nil {
+		return Tokens{}, false, err
+	}
+
+	t, exists := tokens[host]
+	return t, exists, nil
+}
+
+// All returns every cached host and its tokens
+func (c *TokenCache) All() (map[string]Tokens, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.read()
+}
+
+// Put caches t for host, replacing whatever was there
+func (c *TokenCache) Put(host string, t Tokens) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the file is read again, other invocations may have added hosts
+	tokens, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	tokens[host] = t
+	return c.write(tokens)
+}
+
+// Delete forgets the tokens of host
+func (c *TokenCache) Delete(host string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	_, exists := tokens[host]
+	if !exists {
+		return nil
+	}
+
+	delete(tokens, host)
+	return c.write(tokens)
+}
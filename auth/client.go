@@ -3,7 +3,6 @@ package auth
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -22,11 +22,11 @@ var ErrInvalidCredentials = errors.New("invalid credentials")
 type Option func(*http.Client) error
 
 func WithInsecure(c *http.Client) error {
-	t, ok := c.Transport.(*http.Transport)
-	if !ok {
-		return fmt.Errorf("transport is not *http.Transport")
+	cfg, err := tlsConfig(c)
+	if err != nil {
+		return err
 	}
-	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	cfg.InsecureSkipVerify = true
 	return nil
 }
 
@@ -71,12 +71,51 @@ func WithSSHTunnel(proxy string, config *ssh.ClientConfig) (Option, error) {
 }
 
 func WithCredentials(host, user, pass string) Option {
+	return WithCachedCredentials(context.Background(), nil, host, user, pass)
+}
+
+// WithCachedCredentials is WithCredentials, but resumes the session kept
+// in cache for host if there is one - logging in only if that fails. The
+// tokens of new sessions are cached. A nil cache caches nothing.
+//
+// Logging in gives up once ctx is done, ctx does not bound the session.
+func WithCachedCredentials(ctx context.Context, cache *TokenCache, host, user, pass string) Option {
 	return func(c *http.Client) error {
+		alive, cancel := context.WithCancel(context.Background())
 		t := &authTransport{
 			RoundTripper: c.Transport,
+			host:         host,
+			cache:        cache,
+			ctx:          alive,
+			cancel:       cancel,
 		}
 		c.Transport = t
-		return t.login(host, user, pass)
+
+		t.refreshing.Lock()
+		defer t.refreshing.Unlock()
+
+		if cache == nil {
+			return t.login(ctx, host, user, pass)
+		}
+
+		cached, exists, err := cache.Get(host)
+		if err != nil {
+			return err
+		}
+
+		if exists && cached.Username == user {
+			t.username = user
+			t.refreshToken.Store(&cached.RefreshToken)
+			err = t.refresh(ctx)
+			if err == nil {
+				t.startKeepalive()
+				return nil
+			}
+
+			// the device has forgotten us, or was reset
+		}
+
+		return t.login(ctx, host, user, pass)
 	}
 }
 
@@ -108,14 +147,92 @@ func Client(opts ...Option) (*http.Client, error) {
 	return c, nil
 }
 
+// Close stops refreshing the tokens of c in the background, and closes
+// its idle connections. c should not be used afterwards.
+func Close(c *http.Client) {
+	if c == nil {
+		return
+	}
+
+	switch t := c.Transport.(type) {
+	case *authTransport:
+		t.cancel()
+	case *lazyTransport:
+		t.close()
+	}
+
+	c.CloseIdleConnections()
+}
+
+// Reauthenticate logs in to the device of c again, using user and pass
+// rather than what c was created with - e.g. to confirm a password was
+// changed. The new tokens replace the old ones, and are cached.
+func Reauthenticate(c *http.Client, user, pass string) error {
+	t, err := authenticated(c)
+	if err != nil {
+		return err
+	}
+
+	// requests failing meanwhile wait for us, rather than refreshing
+	// a session about to be replaced
+	t.refreshing.Lock()
+	defer t.refreshing.Unlock()
+
+	return t.login(t.ctx, t.host, user, pass)
+}
+
+// authenticated returns the transport of c, logging in if c is lazy
+func authenticated(c *http.Client) (*authTransport, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no client to authenticate")
+	}
+
+	if l, ok := c.Transport.(*lazyTransport); ok {
+		var err error
+		c, err = l.authenticate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t, ok := c.Transport.(*authTransport)
+	if !ok {
+		return nil, fmt.Errorf("client is not authenticated")
+	}
+
+	return t, nil
+}
+
 type authTransport struct {
 	http.RoundTripper
 	token           atomic.Pointer[string]
-	refreshToken    string
+	refreshToken    atomic.Pointer[string]
 	refreshTokenErr atomic.Pointer[error]
+
+	// refreshing makes concurrent requests failing with
+	// the same token refresh it once, it is held while
+	// logging in and refreshing - and guards username.
+	refreshing sync.Mutex
+
+	host     string
+	username string
+	cache    *TokenCache
+
+	// ctx is cancelled by Close, stopping keepalive
+	ctx    context.Context
+	cancel context.CancelFunc
+	alive  sync.Once
 }
 
-func (a *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+func (a *authTransport) CloseIdleConnections() {
+	c, ok := a.RoundTripper.(interface{ CloseIdleConnections() })
+	if ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// send sends req with the current token, returning the token used
+func (a *authTransport) send(req *http.Request) (*http.Response, *string, error) {
 	// Clone request to avoid modifying the original one
 	clonedReq := req.Clone(req.Context())
 
@@ -124,11 +241,30 @@ func (a *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		clonedReq.Header.Set("Authorization", *t)
 	}
 
+	resp, err := a.RoundTripper.RoundTrip(clonedReq)
+	return resp, t, err
+}
+
+func (a *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// warning: we try to fetch the refreshToken loop's error
 	// as a convenience to the caller - but it is racy - it might be stuck at something
 	// or starved of resources hence, the refreshTokenErr might not be set yet - or it might
 	// not have encountered an error at all...
-	resp, err := a.RoundTripper.RoundTrip(clonedReq)
+	resp, used, err := a.send(req)
+
+	// the token might have expired while the device was unreachable, or
+	// the device restarted and forgot it - refresh it, and try once more.
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && a.refreshToken.Load() != nil && rewindable(req) {
+		refreshErr := a.refreshIfCurrent(used)
+		if refreshErr == nil {
+			retry, rewindErr := rewind(req)
+			if rewindErr == nil {
+				resp.Body.Close()
+				resp, _, err = a.send(retry)
+			}
+		}
+	}
+
 	if err != nil {
 		refreshErr := a.refreshTokenErr.Load()
 		if refreshErr != nil {
@@ -148,7 +284,8 @@ func (a *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
-func (a *authTransport) login(host, user, pass string) error {
+// login trades user and pass for tokens, refreshing must be held
+func (a *authTransport) login(ctx context.Context, host, user, pass string) error {
 	u := url.URL{
 		Scheme: "https",
 		Host:   host,
@@ -168,7 +305,7 @@ func (a *authTransport) login(host, user, pass string) error {
 		return fmt.Errorf("unable to marshal auth request: %w", err)
 	}
 
-	authRequest, err := http.NewRequest("POST", u.String(), bytes.NewReader(requestBody))
+	authRequest, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(requestBody))
 	if err != nil {
 		return fmt.Errorf("unable to create http request: %w", err)
 	}
@@ -196,72 +333,205 @@ func (a *authTransport) login(host, user, pass string) error {
 	}
 
 	a.token.Store(&jwt)
+	a.username = user
 
+	refreshToken, ok := refreshCookie(resp)
+	if !ok {
+		return nil
+	}
+
+	a.refreshToken.Store(&refreshToken)
+	err = a.store()
+	if err != nil {
+		return err
+	}
+
+	a.startKeepalive()
+	return nil
+}
+
+// refreshCookie returns the refresh token set by resp, if any
+func refreshCookie(resp *http.Response) (string, bool) {
 	for _, v := range resp.Cookies() {
 		if v.Name == "refresh_token" {
-			a.refreshToken = v.Value
-
-			// start keepalive routine
-			go a.keepalive(u)
-			break
+			return v.Value, true
 		}
 	}
 
+	return "", false
+}
+
+// store caches the current tokens if there is a cache, refreshing must be held
+func (a *authTransport) store() error {
+	if a.cache == nil {
+		return nil
+	}
+
+	err := a.cache.Put(a.host, Tokens{
+		Username:     a.username,
+		Token:        *a.token.Load(),
+		RefreshToken: *a.refreshToken.Load(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to cache tokens: %w", err)
+	}
+
 	return nil
 }
 
-func (a *authTransport) keepalive(url url.URL) {
-	url.Path = "/auth/refresh"
-	for {
-		// TODO: use actual expire value from JWT
-		// 	for now, we know its usually 10 minuttes, so we refresh at every 9 minuttes
-		//
-		// TODO: we should learn if we are even supposed to refresh the token before
-		//   the jwt expires - to me it seems like the refresh_token works even though
-		//	 hours might have gone by - this could significantly simplify the code as
-		//   we wont need any routines to do stuff in the background
-		//
-		// TODO: give consumers a way to cancel this routine
-		// 	In the context of iectl, it think its okay that this jwt is refreshed forever
-		time.Sleep(time.Minute * 9)
-		req, err := http.NewRequest("GET", url.String(), nil)
-		if err != nil {
-			err = fmt.Errorf("refresh token: could not create http request: %w", err)
-			a.refreshTokenErr.Store(&err)
-			break
-		}
+// rewindable tells if the body of req can be sent again
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
 
-		c := &http.Cookie{
-			Name:  "refresh_token",
-			Value: a.refreshToken,
-		}
+// rewind returns req with a fresh copy of its body
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
 
-		req.AddCookie(c)
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
 
-		httpClient := &http.Client{Transport: a}
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			err = fmt.Errorf("refresh token: request failed: %w", err)
-			a.refreshTokenErr.Store(&err)
-			break
-		}
+// refreshIfCurrent refreshes the JWT, unless it is no longer used -
+// someone else refreshed it while we waited.
+func (a *authTransport) refreshIfCurrent(used *string) error {
+	a.refreshing.Lock()
+	defer a.refreshing.Unlock()
+
+	if a.token.Load() != used {
+		return nil
+	}
+
+	// Close gives up on refreshes in flight
+	err := a.refresh(a.ctx)
+	if err != nil {
+		err = fmt.Errorf("refresh token: %w", err)
+		a.refreshTokenErr.Store(&err)
+	}
+
+	return err
+}
+
+// refresh trades the refresh token for a new JWT, refreshing must be held
+func (a *authTransport) refresh(ctx context.Context) error {
+	u := url.URL{
+		Scheme: "https",
+		Host:   a.host,
+		Path:   "/auth/refresh",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create http request: %w", err)
+	}
+
+	req.AddCookie(&http.Cookie{
+		Name:  "refresh_token",
+		Value: *a.refreshToken.Load(),
+	})
+
+	resp, err := a.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	// the body have nothing of interest
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request returned unexpected status code: %d", resp.StatusCode)
+	}
 
-		// the body have nothing of interest
-		resp.Body.Close()
+	jwt := resp.Header.Get("Authorization")
+	if jwt == "" {
+		return fmt.Errorf("a successive call to refresh did not include a new JWT in its response")
+	}
+
+	a.token.Store(&jwt)
+
+	// the device may hand out a new refresh token, the old one
+	// is likely to stop working
+	refreshToken, ok := refreshCookie(resp)
+	if ok {
+		a.refreshToken.Store(&refreshToken)
+	}
+
+	return a.store()
+}
+
+// Logout revokes tokens at host, reached using c. Tokens the
+// device does not know about are as good as revoked.
+func Logout(ctx context.Context, c *http.Client, host string, tokens Tokens) error {
+	u := url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   "/auth/logout",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to create http request: %w", err)
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			err = fmt.Errorf("refresh token: request returned unexpected status code: %d", resp.StatusCode)
-			a.refreshTokenErr.Store(&err)
-			break
+	req.Header.Set("Authorization", tokens.Token)
+	req.AddCookie(&http.Cookie{
+		Name:  "refresh_token",
+		Value: tokens.RefreshToken,
+	})
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusUnauthorized:
+		return nil
+	}
+
+	return fmt.Errorf("unexpected http status code: %d", resp.StatusCode)
+}
+
+// startKeepalive starts keepalive, unless it is running already
+func (a *authTransport) startKeepalive() {
+	a.alive.Do(func() { go a.keepalive() })
+}
+
+// keepaliveRetry is how long keepalive waits after failing to refresh
+const keepaliveRetry = 30 * time.Second
+
+// keepalive refreshes the JWT before it expires, until Close is called
+func (a *authTransport) keepalive() {
+	var failed bool
+	for {
+		wait := keepaliveRetry
+		if !failed {
+			wait = refreshIn(*a.token.Load())
 		}
 
-		jwt := resp.Header.Get("Authorization")
-		if jwt == "" {
-			err = fmt.Errorf("refresh token: a successive call to refresh did not include a new JWT in its response")
-			a.refreshTokenErr.Store(&err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-a.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
 		}
 
-		a.token.Store(&jwt)
+		used := a.token.Load()
+		err := a.refreshIfCurrent(used)
+
+		// the JWT is still good for a while, the device might
+		// just be restarting
+		failed = err != nil
 	}
 }
 
@@ -0,0 +1,258 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/target"
+)
+
+func newClient(t *testing.T, srv *bsptest.Server, opts ...auth.Option) *http.Client {
+	t.Helper()
+
+	opts = append([]auth.Option{srv.Trust}, opts...)
+	opts = append(opts, auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	c, err := auth.Client(opts...)
+	if err != nil {
+		t.Fatalf("unable to authenticate: %s", err)
+	}
+	t.Cleanup(func() { auth.Close(c) })
+
+	return c
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	c := newClient(t, srv)
+	client := bsp.New(target.Endpoint{Hostname: srv.Host(), Client: c})
+
+	// a restart makes the device forget the JWT
+	srv.ForgetTokens()
+
+	_, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("expected the request to be retried with a new token, got %s", err)
+	}
+
+	if srv.Refreshes() != 1 {
+		t.Fatalf("expected a single refresh, got %d", srv.Refreshes())
+	}
+
+	// bodies are sent again as well
+	srv.ForgetTokens()
+	err = client.SetHostname(context.Background(), "iE250-renamed")
+	if err != nil {
+		t.Fatalf("unable to set hostname: %s", err)
+	}
+
+	if srv.Device().Hostname != "iE250-renamed" {
+		t.Fatalf("expected the hostname to be set, got %s", srv.Device().Hostname)
+	}
+}
+
+func TestRefreshOnce(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	c := newClient(t, srv)
+
+	// requests the device refuses no matter what are not retried forever
+	req, err := http.NewRequest("GET", srv.URL+"/bsp/system/status", nil)
+	if err != nil {
+		t.Fatalf("unable to create request: %s", err)
+	}
+
+	srv.ForgetTokens()
+	srv.InjectFault(bsptest.Fault{Path: "/bsp/system/status", StatusCode: http.StatusUnauthorized})
+
+	resp, err := c.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	if srv.Refreshes() != 1 {
+		t.Fatalf("expected a single refresh, got %d", srv.Refreshes())
+	}
+
+	// a body that cannot be read again, is not retried
+	srv.ClearFaults()
+	srv.ForgetTokens()
+	req, err = http.NewRequest("POST", srv.URL+"/bsp/hostname", struct{ *bytes.Buffer }{bytes.NewBufferString(`{"hostname":"x"}`)})
+	if err != nil {
+		t.Fatalf("unable to create request: %s", err)
+	}
+
+	resp, err = c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized || srv.Refreshes() != 1 {
+		t.Fatalf("expected the 401 as is, got %d after %d refreshes", resp.StatusCode, srv.Refreshes())
+	}
+}
+
+func TestRotatedRefreshToken(t *testing.T) {
+	srv := bsptest.NewUnstartedServer()
+	srv.RotateRefreshTokens = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	c := newClient(t, srv)
+	client := bsp.New(target.Endpoint{Hostname: srv.Host(), Client: c})
+
+	// the second refresh needs the token handed out by the first
+	for i := range 2 {
+		srv.ForgetTokens()
+		_, err := client.Status(context.Background())
+		if err != nil {
+			t.Fatalf("refresh %d failed: %s", i+1, err)
+		}
+	}
+}
+
+func TestReauthenticateWhileRefreshing(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	c := newClient(t, srv)
+	client := bsp.New(target.Endpoint{Hostname: srv.Host(), Client: c})
+
+	// requests refreshing the session race logging in again,
+	// which go test -race should be quiet about.
+	done := make(chan error)
+	go func() {
+		var err error
+		for range 5 {
+			srv.ForgetTokens()
+			_, err = client.Status(context.Background())
+			if err != nil {
+				break
+			}
+		}
+		done <- err
+	}()
+
+	for range 5 {
+		err := auth.Reauthenticate(c, srv.Username, srv.Password)
+		if err != nil {
+			t.Fatalf("unable to authenticate again: %s", err)
+		}
+	}
+
+	err := <-done
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	srv := bsptest.NewUnstartedServer()
+	srv.TokenTTL = 2 * time.Second
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	c := newClient(t, srv)
+
+	// the JWT is refreshed before it expires
+	time.Sleep(3 * time.Second)
+	if srv.Refreshes() == 0 {
+		t.Fatalf("expected the JWT to be refreshed")
+	}
+
+	auth.Close(c)
+	refreshes := srv.Refreshes()
+
+	time.Sleep(2 * time.Second)
+	if srv.Refreshes() != refreshes {
+		t.Fatalf("expected no refreshes after Close, got %d more", srv.Refreshes()-refreshes)
+	}
+}
+
+func TestCachedCredentials(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	cache := auth.NewTokenCache(filepath.Join(t.TempDir(), "tokens.json"))
+	for range 2 {
+		c, err := auth.Client(srv.Trust, auth.WithCachedCredentials(context.Background(), cache, srv.Host(), srv.Username, srv.Password))
+		if err != nil {
+			t.Fatalf("unable to authenticate: %s", err)
+		}
+		auth.Close(c)
+	}
+
+	if srv.Logins() != 1 || srv.Refreshes() != 1 {
+		t.Fatalf("expected a login and a refresh, got %d and %d", srv.Logins(), srv.Refreshes())
+	}
+
+	// a cache for another user is not used
+	_, err := auth.Client(srv.Trust, auth.WithCachedCredentials(context.Background(), cache, srv.Host(), "someone", "else"))
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected the login of another user to fail, got %v", err)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	logins := 0
+	c := auth.Lazy(func() (*http.Client, error) {
+		logins++
+		return auth.Client(srv.Trust, auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	})
+
+	if srv.Logins() != 0 {
+		t.Fatalf("expected no login before the client is used")
+	}
+
+	client := bsp.New(target.Endpoint{Hostname: srv.Host(), Client: c})
+	for range 2 {
+		_, err := client.Status(context.Background())
+		if err != nil {
+			t.Fatalf("unable to get status: %s", err)
+		}
+	}
+
+	if logins != 1 || srv.Logins() != 1 {
+		t.Fatalf("expected a single login, got %d", logins)
+	}
+
+	// closed clients do not log in again
+	auth.Close(c)
+	_, err := client.Status(context.Background())
+	if err == nil {
+		t.Fatalf("expected a closed client to fail")
+	}
+}
+
+func TestLazyError(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	c := auth.Lazy(func() (*http.Client, error) {
+		return auth.Client(srv.Trust, auth.WithCredentials(srv.Host(), srv.Username, "wrong"))
+	})
+
+	err := auth.Authenticate(c)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	_, err = bsp.New(target.Endpoint{Hostname: srv.Host(), Client: c}).Status(context.Background())
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected requests to fail with the login error, got %v", err)
+	}
+}
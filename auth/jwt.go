@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// defaultLifetime is what JWT's without a readable exp claim are assumed to
+// live, which is what the devices hand out.
+const defaultLifetime = 10 * time.Minute
+
+// minRefresh keeps short lived JWT's from being refreshed in a tight loop
+const minRefresh = time.Second
+
+// expiry returns when jwt expires, as told by its exp claim. The signature
+// is not verified, that is for the device to do.
+func expiry(jwt string) (time.Time, bool) {
+	jwt = strings.TrimPrefix(jwt, "Bearer ")
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	p, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	claims := struct {
+		Expires *json.Number `json:"exp"`
+	}{}
+
+	err = json.Unmarshal(p, &claims)
+	if err != nil || claims.Expires == nil {
+		return time.Time{}, false
+	}
+
+	exp, err := claims.Expires.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(exp), 0), true
+}
+
+// refreshIn returns how long to wait before refreshing jwt, leaving
+// a tenth of its remaining lifetime as margin.
+func refreshIn(jwt string) time.Duration {
+	remaining := defaultLifetime
+	exp, ok := expiry(jwt)
+	if ok {
+		remaining = time.Until(exp)
+	}
+
+	return max(remaining*9/10, minRefresh)
+}
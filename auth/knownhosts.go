@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// KnownHosts pins the certificates of devices, much like known_hosts does
+// for ssh. Devices generate self-signed certificates, which cannot be
+// verified - instead the certificate is trusted the first time a device is
+// seen, and refused if it changes afterwards.
+type KnownHosts struct {
+	Path string
+
+	// Strict refuses hosts that are not pinned, rather than
+	// trusting them on first use
+	Strict bool
+
+	// Pinned is called when a host is trusted on first use, if set
+	Pinned func(host, fingerprint string)
+
+	mu sync.Mutex
+}
+
+// Pin is the certificate fingerprint trusted for a host
+type Pin struct {
+	Host        string `json:"host"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// CertificateMismatchError is returned when a host presents
+// another certificate than the one pinned.
+type CertificateMismatchError struct {
+	Host      string
+	Pinned    string
+	Presented string
+}
+
+func (e *CertificateMismatchError) Error() string {
+	return fmt.Sprintf("WARNING: the certificate of %s has changed! It is %s, but %s is trusted. "+
+		"Someone could be intercepting the connection - or the device was reset or got a new certificate. "+
+		"If that is expected, trust the new one using 'iectl bsp trust add %s'",
+		e.Host, e.Presented, e.Pinned, e.Host)
+}
+
+// UnknownHostError is returned for hosts not pinned, when
+// trust on first use is not allowed.
+type UnknownHostError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *UnknownHostError) Error() string {
+	return fmt.Sprintf("%s is not trusted, its certificate is %s - trust it using 'iectl bsp trust add %s'",
+		e.Host, e.Fingerprint, e.Host)
+}
+
+// DefaultKnownHostsPath is where pins are kept, unless told otherwise
+func DefaultKnownHostsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "iectl", "known_hosts"), nil
+}
+
+// NewKnownHosts returns pins kept at path, which does not
+// have to exist until something is pinned.
+func NewKnownHosts(path string) *KnownHosts {
+	return &KnownHosts{Path: path}
+}
+
+// Fingerprint returns the SHA256 fingerprint of cert, formatted
+// like ssh does for host keys.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// WithKnownHosts verifies the certificate of host using known, certificates
+// that can be verified using the root CAs (see WithCABundle) need no pin.
+// Given a CA bundle or server name, certificates have to verify - they
+// are never pinned.
+func WithKnownHosts(known *KnownHosts, host string) Option {
+	return func(c *http.Client) error {
+		cfg, err := tlsConfig(c)
+		if err != nil {
+			return err
+		}
+
+		// the root CAs and server name are looked up once connecting,
+		// options applied after this one count as well.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return known.verify(host, cfg.RootCAs, cfg.ServerName, cs)
+		}
+		return nil
+	}
+}
+
+func (k *KnownHosts) verify(host string, roots *x509.CertPool, name string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("%s presented no certificate", host)
+	}
+
+	// given CAs or a name to verify against, the certificate is expected
+	// to be issued by a CA - pinning whatever is presented would hide
+	// someone intercepting the connection
+	issued := roots != nil || name != ""
+
+	if name == "" {
+		name = host
+		h, _, err := net.SplitHostPort(host)
+		if err == nil {
+			name = h
+		}
+	}
+
+	leaf := cs.PeerCertificates[0]
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, v := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(v)
+	}
+
+	_, err := leaf.Verify(opts)
+	if err == nil {
+		return nil
+	}
+
+	if issued {
+		return fmt.Errorf("unable to verify the certificate of %s: %w", host, err)
+	}
+
+	presented := Fingerprint(leaf)
+	pinned, exists, err := k.Get(host)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if pinned != presented {
+			return &CertificateMismatchError{Host: host, Pinned: pinned, Presented: presented}
+		}
+		return nil
+	}
+
+	if k.Strict {
+		return &UnknownHostError{Host: host, Fingerprint: presented}
+	}
+
+	err = k.Add(host, presented)
+	if err != nil {
+		return err
+	}
+
+	if k.Pinned != nil {
+		k.Pinned(host, presented)
+	}
+
+	return nil
+}
+
+// read parses the known hosts file, a line of host and fingerprint for
+// every pin - blank lines and lines starting with # are ignored.
+func (k *KnownHosts) read() ([]Pin, error) {
+	p, err := os.ReadFile(k.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known hosts: %w", err)
+	}
+
+	pins := make([]Pin, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a host and a fingerprint", k.Path, n)
+		}
+
+		pins = append(pins, Pin{Host: fields[0], Fingerprint: fields[1]})
+	}
+
+	return pins, nil
+}
+
+// write replaces the known hosts file, other invocations either see
+// the old or the new file - never half of it.
+func (k *KnownHosts) write(pins []Pin) error {
+	var b strings.Builder
+	for _, v := range pins {
+		fmt.Fprintf(&b, "%s %s\n", v.Host, v.Fingerprint)
+	}
+
+	dir := filepath.Dir(k.Path)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("unable to create known hosts directory: %w", err)
+	}
+
+	fd, err := os.CreateTemp(dir, ".known_hosts-*")
+	if err != nil {
+		return fmt.Errorf("unable to write known hosts: %w", err)
+	}
+	defer os.Remove(fd.Name())
+
+	_, err = fd.WriteString(b.String())
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("unable to write known hosts: %w", err)
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write known hosts: %w", err)
+	}
+
+	err = os.Rename(fd.Name(), k.Path)
+	if err != nil {
+		return fmt.Errorf("unable to write known hosts: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the fingerprint pinned for host
+func (k *KnownHosts) Get(host string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	pins, err := k.read()
+	if err != nil {
+		return "", false, err
+	}
+
+	i := slices.IndexFunc(pins, func(p Pin) bool { return p.Host == host })
+	if i < 0 {
+		return "", false, nil
+	}
+
+	return pins[i].Fingerprint, true, nil
+}
+
+// All returns every pin
+func (k *KnownHosts) All() ([]Pin, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.read()
+}
+
+// Add pins fingerprint for host, replacing whatever was there
+func (k *KnownHosts) Add(host, fingerprint string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// the file is read again, other invocations may have added hosts
+	pins, err := k.read()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(pins, func(p Pin) bool { return p.Host == host })
+	if i >= 0 {
+		pins[i].Fingerprint = fingerprint
+	} else {
+		pins = append(pins, Pin{Host: host, Fingerprint: fingerprint})
+	}
+
+	return k.write(pins)
+}
+
+// Remove forgets the pin of host, and tells if there was one
+func (k *KnownHosts) Remove(host string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	pins, err := k.read()
+	if err != nil {
+		return false, err
+	}
+
+	before := len(pins)
+	pins = slices.DeleteFunc(pins, func(p Pin) bool { return p.Host == host })
+	if len(pins) == before {
+		return false, nil
+	}
+
+	return true, k.write(pins)
+}
@@ -0,0 +1,73 @@
+package auth_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestKnownHostsVerified(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	known := auth.NewKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	known.Strict = true
+
+	// certificates that verify using the root CAs need no pin
+	c, err := auth.Client(srv.Trust, auth.WithKnownHosts(known, srv.Host()), auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err != nil {
+		t.Fatalf("expected a verified certificate to be trusted, got %s", err)
+	}
+	auth.Close(c)
+
+	pins, err := known.All()
+	if err != nil {
+		t.Fatalf("unable to read pins: %s", err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("expected nothing to be pinned, got %+v", pins)
+	}
+}
+
+func TestKnownHostsUnrelatedCA(t *testing.T) {
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	other, err := bsptest.SelfSignedCertificate("ca.example")
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	bundle, _ := writePEM(t, other)
+
+	ca, err := auth.WithCABundle(bundle, false)
+	if err != nil {
+		t.Fatalf("unable to load ca bundle: %s", err)
+	}
+
+	known := auth.NewKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	known.Pinned = func(host, fingerprint string) {
+		t.Errorf("expected nothing to be trusted on first use, got %s", host)
+	}
+
+	// the certificate is not issued by the CA, nor a CA of the system
+	cases := map[string][]auth.Option{
+		"ca bundle":   {ca},
+		"server name": {auth.WithServerName("127.0.0.1")},
+	}
+
+	for name, opts := range cases {
+		opts = append(opts, auth.WithKnownHosts(known, srv.Host()), auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+		_, err = auth.Client(opts...)
+		if err == nil || !strings.Contains(err.Error(), "unable to verify the certificate") {
+			t.Errorf("%s: expected the certificate to be refused, got %v", name, err)
+		}
+	}
+
+	pins, err := known.All()
+	if err != nil || len(pins) != 0 {
+		t.Fatalf("expected nothing to be pinned, got %+v: %v", pins, err)
+	}
+}
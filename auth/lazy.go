@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var errClosed = errors.New("client is closed")
+
+// Lazy returns a client which logs in on its first request, using the
+// client login returns from then on. If login fails, every request
+// fails with its error - it is not tried again.
+func Lazy(login func() (*http.Client, error)) *http.Client {
+	return &http.Client{Transport: &lazyTransport{login: login}}
+}
+
+// Authenticate logs in using c now, rather than on its first request. It
+// does nothing for clients that are not lazy, or already logged in.
+func Authenticate(c *http.Client) error {
+	if c == nil {
+		return nil
+	}
+
+	l, ok := c.Transport.(*lazyTransport)
+	if !ok {
+		return nil
+	}
+
+	_, err := l.authenticate()
+	return err
+}
+
+type lazyTransport struct {
+	login func() (*http.Client, error)
+
+	// mu is held while logging in, requests wait for it
+	mu     sync.Mutex
+	done   bool
+	client *http.Client
+	err    error
+}
+
+func (l *lazyTransport) authenticate() (*http.Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.done {
+		l.client, l.err = l.login()
+		l.done = true
+	}
+
+	return l.client, l.err
+}
+
+func (l *lazyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, err := l.authenticate()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Transport.RoundTrip(req)
+}
+
+// close closes the client logged in with, if any, and makes sure
+// no one logs in afterwards.
+func (l *lazyTransport) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.client != nil {
+		Close(l.client)
+	}
+
+	l.done = true
+	l.client, l.err = nil, errClosed
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tlsConfig returns the tls config of c, creating it if needed - options
+// change it rather than replacing it, so they can be combined.
+func tlsConfig(c *http.Client) (*tls.Config, error) {
+	t, ok := c.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("transport is not *http.Transport")
+	}
+
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+
+	return t.TLSClientConfig, nil
+}
+
+// WithCABundle trusts the CAs of the pem encoded bundle at path, and the
+// ones of the system too if system is set.
+func WithCABundle(path string, system bool) (Option, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ca bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if system {
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load system CAs: %w", err)
+		}
+	}
+
+	if !pool.AppendCertsFromPEM(p) {
+		return nil, fmt.Errorf("no certificates found in ca bundle %s", path)
+	}
+
+	return func(c *http.Client) error {
+		cfg, err := tlsConfig(c)
+		if err != nil {
+			return err
+		}
+
+		cfg.RootCAs = pool
+		return nil
+	}, nil
+}
+
+// WithClientCertificate presents the certificate at certFile, for gateways
+// doing mutual TLS. keyFile holds its private key, both are pem encoded.
+func WithClientCertificate(certFile, keyFile string) (Option, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+
+	return func(c *http.Client) error {
+		cfg, err := tlsConfig(c)
+		if err != nil {
+			return err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+		return nil
+	}, nil
+}
+
+// WithServerName verifies the certificate of the device against name,
+// rather than the host connected to - e.g. the .local hostname of a
+// device reached by its ip address.
+func WithServerName(name string) Option {
+	return func(c *http.Client) error {
+		cfg, err := tlsConfig(c)
+		if err != nil {
+			return err
+		}
+
+		cfg.ServerName = name
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+// writePEM writes the certificate and key of cert to files, returning their paths
+func writePEM(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	certPEM, keyPEM, err := bsptest.EncodePEM(cert)
+	if err != nil {
+		t.Fatalf("unable to encode certificate: %s", err)
+	}
+
+	err = os.WriteFile(certFile, certPEM, 0o600)
+	if err != nil {
+		t.Fatalf("unable to write certificate: %s", err)
+	}
+
+	err = os.WriteFile(keyFile, keyPEM, 0o600)
+	if err != nil {
+		t.Fatalf("unable to write key: %s", err)
+	}
+
+	return certFile, keyFile
+}
+
+// newNamedServer starts a server whose certificate only names name
+func newNamedServer(t *testing.T, name string) (*bsptest.Server, string) {
+	t.Helper()
+
+	cert, err := bsptest.SelfSignedCertificate(name)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+
+	srv := bsptest.NewUnstartedServer()
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	bundle, _ := writePEM(t, cert)
+	return srv, bundle
+}
+
+func TestServerName(t *testing.T) {
+	srv, bundle := newNamedServer(t, "iE250-0bad0c.local")
+
+	ca, err := auth.WithCABundle(bundle, false)
+	if err != nil {
+		t.Fatalf("unable to load ca bundle: %s", err)
+	}
+
+	// the certificate does not name the address
+	_, err = auth.Client(ca, auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err == nil {
+		t.Fatalf("expected the certificate to be refused for %s", srv.Host())
+	}
+
+	c, err := auth.Client(ca, auth.WithServerName("iE250-0bad0c.local"), auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err != nil {
+		t.Fatalf("expected the certificate to verify against the server name, got %s", err)
+	}
+	auth.Close(c)
+
+	// pins are not needed either, as the certificate verifies
+	known := auth.NewKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	known.Strict = true
+	c, err = auth.Client(ca, auth.WithKnownHosts(known, srv.Host()), auth.WithServerName("iE250-0bad0c.local"), auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err != nil {
+		t.Fatalf("expected the certificate to verify, got %s", err)
+	}
+	auth.Close(c)
+}
+
+func TestClientCertificate(t *testing.T) {
+	clientCert, err := bsptest.SelfSignedCertificate("iectl")
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	certFile, keyFile := writePEM(t, clientCert)
+
+	srv := bsptest.NewUnstartedServer()
+	presented := make(chan []byte, 1)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			select {
+			case presented <- raw[0]:
+			default:
+			}
+			return nil
+		},
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	_, err = auth.Client(srv.Trust, auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err == nil {
+		t.Fatalf("expected the server to require a client certificate")
+	}
+
+	cert, err := auth.WithClientCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unable to load client certificate: %s", err)
+	}
+
+	c, err := auth.Client(srv.Trust, cert, auth.WithCredentials(srv.Host(), srv.Username, srv.Password))
+	if err != nil {
+		t.Fatalf("unable to authenticate: %s", err)
+	}
+	auth.Close(c)
+
+	raw := <-presented
+	if string(raw) != string(clientCert.Certificate[0]) {
+		t.Fatalf("expected the client certificate to be presented")
+	}
+}
@@ -0,0 +1,37 @@
+package bsptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deif/iectl/target"
+	"github.com/spf13/cobra"
+)
+
+// Execute runs cmd with args, srv being the only target - like the bsp
+// command tree hands targets down to its subcommands.
+func Execute(t testing.TB, cmd *cobra.Command, srv *Server, args ...string) error {
+	t.Helper()
+
+	// keep pins and caches away from whoever runs the tests
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	e, err := srv.Endpoint()
+	if err != nil {
+		t.Fatalf("unable to authenticate: %s", err)
+	}
+
+	// cobra hands the context of the first execution down to subcommands
+	// for good, so every subcommand must have its context replaced.
+	ctx := target.NewContext(context.Background(), target.Collection{e})
+	for _, v := range cmd.Commands() {
+		v.SetContext(ctx)
+	}
+
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	return cmd.ExecuteContext(ctx)
+}
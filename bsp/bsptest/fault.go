@@ -0,0 +1,118 @@
+package bsptest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault describes a misbehaviour of the server, for requests matching
+// Method and Path. Faults are evaluated in the order they were injected,
+// the first match wins.
+type Fault struct {
+	// Method to match, empty matches any method
+	Method string
+
+	// Path to match, a trailing * matches any path with that prefix
+	Path string
+
+	// Delay the response
+	Delay time.Duration
+
+	// StatusCode answered instead of the real response,
+	// zero lets the request through (after Delay)
+	StatusCode int
+
+	// Drop closes the connection without answering
+	Drop bool
+
+	// Times limits how many requests are affected, zero is forever
+	Times int
+
+	hits int
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	if f.Method != "" && f.Method != r.Method {
+		return false
+	}
+
+	prefix, wildcard := strings.CutSuffix(f.Path, "*")
+	if wildcard {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+
+	return f.Path == r.URL.Path
+}
+
+// InjectFault makes the server misbehave as described by f
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+func (s *Server) fault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if !f.matches(r) {
+			continue
+		}
+
+		f.hits++
+		if f.Times != 0 && f.hits >= f.Times {
+			s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+		}
+
+		c := *f
+		return &c
+	}
+
+	return nil
+}
+
+func (s *Server) faulty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := s.fault(r)
+		if f == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if f.Drop {
+			hj, ok := w.(http.Hijacker)
+			if ok {
+				conn, _, err := hj.Hijack()
+				if err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+
+		if f.StatusCode != 0 {
+			http.Error(w, http.StatusText(f.StatusCode), f.StatusCode)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,602 @@
+// Package bsptest provides an in-process fake of the BSP REST API,
+// for testing code that talks to DEIF controllers without having
+// physical hardware at hand.
+package bsptest
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/target"
+)
+
+// Server is a fake device, serving the BSP REST API over https.
+type Server struct {
+	*httptest.Server
+
+	// Username and Password accepted by /auth/login
+	Username string
+	Password string
+
+	// TokenTTL is the lifetime of issued JWT's
+	TokenTTL time.Duration
+
+	// UpgradeDuration is the time it takes to install firmware
+	UpgradeDuration time.Duration
+
+	// RotateRefreshTokens makes refreshing hand out a new refresh
+	// token, revoking the one used
+	RotateRefreshTokens bool
+
+	mu       sync.Mutex
+	device   bsp.Device
+	services map[bsp.Service]bool
+	sshKeys  string
+	tokens   map[string]time.Time
+	refresh  map[string]struct{}
+	faults   []*Fault
+
+	firmware       *Firmware
+	upgradeStarted time.Time
+	upgradeDone    bool
+
+	logins        int
+	refreshes     int
+	restarts      int
+	factoryResets int
+}
+
+// Firmware describes the last firmware file uploaded to the server
+type Firmware struct {
+	Name string
+	Size int64
+}
+
+// NewServer starts and returns a new Server, the caller
+// should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.StartTLS()
+	return s
+}
+
+// NewUnstartedServer returns a new Server but doesn't start it,
+// which allows the caller to change its configuration (listener, tls config)
+// before calling StartTLS.
+func NewUnstartedServer() *Server {
+	s := &Server{
+		Username:        "admin",
+		Password:        "admin",
+		TokenTTL:        10 * time.Minute,
+		UpgradeDuration: 100 * time.Millisecond,
+		tokens:          make(map[string]time.Time),
+		refresh:         make(map[string]struct{}),
+	}
+	s.reset()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/login", s.login)
+	mux.HandleFunc("GET /auth/refresh", s.refreshToken)
+	mux.HandleFunc("POST /auth/logout", s.logout)
+
+	mux.HandleFunc("GET /bsp/system/status", s.authorized(s.status))
+	mux.HandleFunc("POST /bsp/system/restart", s.authorized(s.restart))
+	mux.HandleFunc("POST /bsp/system/reset", s.authorized(s.factoryReset))
+	mux.HandleFunc("GET /bsp/hostname", s.authorized(s.getHostname))
+	mux.HandleFunc("POST /bsp/hostname", s.authorized(s.setHostname))
+	mux.HandleFunc("GET /bsp/service/{service}", s.authorized(s.getService))
+	mux.HandleFunc("PUT /bsp/service/{service}", s.authorized(s.setService))
+	mux.HandleFunc("GET /bsp/keys/ssh", s.authorized(s.getSSHKeys))
+	mux.HandleFunc("POST /bsp/keys/ssh", s.authorized(s.setSSHKeys))
+	mux.HandleFunc("DELETE /bsp/keys/ssh", s.authorized(s.removeSSHKeys))
+	mux.HandleFunc("POST /bsp/firmware/file", s.authorized(s.uploadFirmware))
+	mux.HandleFunc("PUT /bsp/firmware/upgrade", s.authorized(s.startUpgrade))
+	mux.HandleFunc("GET /bsp/firmware/upgrade", s.authorized(s.upgradeStatus))
+
+	s.Server = httptest.NewUnstartedServer(s.faulty(mux))
+
+	return s
+}
+
+// reset puts the device back to its factory state
+func (s *Server) reset() {
+	s.device = bsp.Device{
+		Hostname: "iE250-0bad0c",
+		Serial:   "2300000001",
+		Mountpoints: []bsp.MountPoint{
+			{MountPoint: "/", Size: 4 << 30, Used: 1 << 30},
+			{MountPoint: "/data", Size: 8 << 30, Used: 256 << 20},
+		},
+		Software: bsp.Software{
+			A:      "2.0.9.0",
+			B:      "2.0.8.0",
+			Active: "A",
+		},
+	}
+
+	eth0 := bsp.Interface{Description: "Ethernet 1", Ifname: "eth0", Kind: "ethernet"}
+	eth0.Status.LinkState = "up"
+	eth0.Status.MacAddress = "00:1b:7b:0b:ad:0c"
+	eth0.Status.IPv4 = &struct {
+		IP           string `json:"ip"`
+		PrefixLength int    `json:"prefix_length"`
+	}{IP: "192.168.2.21", PrefixLength: 24}
+	s.device.Interfaces = []bsp.Interface{eth0}
+
+	s.services = map[bsp.Service]bool{
+		bsp.ServiceSSH: true,
+		bsp.ServiceRDP: false,
+	}
+	s.sshKeys = ""
+	s.firmware = nil
+	s.upgradeStarted = time.Time{}
+	s.upgradeDone = false
+}
+
+// Host returns the address of the server, suitable as a target hostname
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// Trust is an auth.Option that makes the client trust
+// the certificate of the server.
+func (s *Server) Trust(c *http.Client) error {
+	t, ok := c.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("transport is not *http.Transport")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(s.Certificate())
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return nil
+}
+
+// Endpoint returns an endpoint for the server, authenticated
+// using the servers Username and Password.
+func (s *Server) Endpoint() (target.Endpoint, error) {
+	c, err := auth.Client(s.Trust, auth.WithCredentials(s.Host(), s.Username, s.Password))
+	if err != nil {
+		return target.Endpoint{}, err
+	}
+
+	return target.Endpoint{Hostname: s.Host(), Client: c}, nil
+}
+
+// Device returns a copy of the device state
+func (s *Server) Device() bsp.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.device
+}
+
+// SetDevice replaces the device state
+func (s *Server) SetDevice(d bsp.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device = d
+}
+
+func (s *Server) ServiceRunning(service bsp.Service) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.services[service]
+}
+
+func (s *Server) SSHKeys() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sshKeys
+}
+
+// Firmware returns the last uploaded firmware file, or nil
+func (s *Server) Firmware() *Firmware {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.firmware
+}
+
+// Logins returns the number of successful logins
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Refreshes returns the number of JWT's handed out for refresh tokens
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// ForgetTokens invalidates every JWT handed out, like a restart of the
+// device does. Refresh tokens are still good.
+func (s *Server) ForgetTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+}
+
+func (s *Server) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+func (s *Server) FactoryResets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.factoryResets
+}
+
+// token returns a new unsigned JWT, expiring after TokenTTL.
+func (s *Server) token(user string) string {
+	expires := time.Now().Add(s.TokenTTL)
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	claims, _ := json.Marshal(struct {
+		Subject string `json:"sub"`
+		Expires int64  `json:"exp"`
+	}{user, expires.Unix()})
+
+	jwt := header + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + randomString()
+	s.tokens[jwt] = expires
+
+	return jwt
+}
+
+func randomString() string {
+	p := make([]byte, 16)
+	rand.Read(p)
+	return base64.RawURLEncoding.EncodeToString(p)
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	doc := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if doc.Username != s.Username || doc.Password != s.Password {
+		http.Error(w, "invalid credentials", http.StatusForbidden)
+		return
+	}
+
+	s.logins++
+	refresh := randomString()
+	s.refresh[refresh] = struct{}{}
+
+	http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: refresh, Path: "/auth", HttpOnly: true, Secure: true})
+	w.Header().Set("Authorization", "Bearer "+s.token(doc.Username))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) refreshToken(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie("refresh_token")
+	if err != nil {
+		http.Error(w, "missing refresh_token", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.refresh[c.Value]
+	if !exists {
+		http.Error(w, "invalid refresh_token", http.StatusUnauthorized)
+		return
+	}
+
+	s.refreshes++
+	if s.RotateRefreshTokens {
+		delete(s.refresh, c.Value)
+		refresh := randomString()
+		s.refresh[refresh] = struct{}{}
+		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: refresh, Path: "/auth", HttpOnly: true, Secure: true})
+	}
+
+	w.Header().Set("Authorization", "Bearer "+s.token(s.Username))
+	w.WriteHeader(http.StatusOK)
+}
+
+// logout revokes the refresh token and JWT of the request
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := r.Cookie("refresh_token")
+	if err == nil {
+		delete(s.refresh, c.Value)
+	}
+
+	delete(s.tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorized rejects requests without a valid, unexpired JWT
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		expires, exists := s.tokens[jwt]
+		s.mu.Unlock()
+
+		if !exists || time.Now().After(expires) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.device)
+}
+
+func (s *Server) restart(w http.ResponseWriter, r *http.Request) {
+	doc := struct {
+		Delay int `json:"delay"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil || doc.Delay < 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restarts++
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) factoryReset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.factoryResets++
+	s.reset()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type hostnameDoc struct {
+	Hostname string `json:"hostname"`
+}
+
+func (s *Server) getHostname(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, hostnameDoc{s.device.Hostname})
+}
+
+func (s *Server) setHostname(w http.ResponseWriter, r *http.Request) {
+	doc := hostnameDoc{}
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil || doc.Hostname == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device.Hostname = doc.Hostname
+	w.WriteHeader(http.StatusOK)
+}
+
+type serviceDoc struct {
+	Running bool `json:"running"`
+}
+
+func (s *Server) getService(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running, exists := s.services[bsp.Service(r.PathValue("service"))]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, serviceDoc{running})
+}
+
+func (s *Server) setService(w http.ResponseWriter, r *http.Request) {
+	doc := serviceDoc{}
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	service := bsp.Service(r.PathValue("service"))
+	_, exists := s.services[service]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.services[service] = doc.Running
+	w.WriteHeader(http.StatusOK)
+}
+
+type sshKeyDoc struct {
+	Certificate string `json:"certificate"`
+}
+
+func (s *Server) getSSHKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sshKeys == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sshKeyDoc{s.sshKeys})
+}
+
+func (s *Server) setSSHKeys(w http.ResponseWriter, r *http.Request) {
+	doc := sshKeyDoc{}
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil || !strings.HasPrefix(doc.Certificate, "ssh-") {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sshKeys = doc.Certificate
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeSSHKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sshKeys = ""
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) uploadFirmware(w http.ResponseWriter, r *http.Request) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	part, err := mr.NextPart()
+	if err != nil || part.FormName() != "file" {
+		http.Error(w, "expected a file part", http.StatusBadRequest)
+		return
+	}
+
+	n, err := io.Copy(io.Discard, part)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// a truncated body will make the multipart reader fail
+	// looking for the closing boundary
+	_, err = mr.NextPart()
+	if err != io.EOF {
+		http.Error(w, "malformed multipart body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.firmware = &Firmware{Name: part.FileName(), Size: n}
+	s.upgradeStarted = time.Time{}
+	s.upgradeDone = false
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) startUpgrade(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.firmware == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.upgradeStarted = time.Now()
+	s.upgradeDone = false
+	w.WriteHeader(http.StatusAccepted)
+}
+
+var upgradeSteps = []string{
+	"Checking bundle",
+	"Verifying signature",
+	"Updating slots",
+	"Copying image to rootfs",
+	"Installing done.",
+}
+
+func (s *Server) upgradeStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.firmware == nil || s.upgradeStarted.IsZero() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.upgradeDone {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	progress := 100
+	if s.UpgradeDuration > 0 {
+		progress = int(100 * time.Since(s.upgradeStarted) / s.UpgradeDuration)
+	}
+
+	if progress >= 100 {
+		s.install()
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	doc := bsp.UpgradeStatus{
+		Lines: []bsp.UpgradeLine{{
+			Progress: progress,
+			Text:     upgradeSteps[progress*len(upgradeSteps)/100],
+		}},
+	}
+
+	writeJSON(w, http.StatusAccepted, doc)
+}
+
+// install puts the uploaded firmware into the inactive slot
+// and marks it active.
+func (s *Server) install() {
+	version := strings.TrimSuffix(s.firmware.Name, ".raucb")
+	if i := strings.LastIndex(version, "-v"); i != -1 {
+		version = version[i+2:]
+	}
+
+	if s.device.Software.Active == "A" {
+		s.device.Software.B = version
+		s.device.Software.Active = "B"
+	} else {
+		s.device.Software.A = version
+		s.device.Software.Active = "A"
+	}
+
+	s.upgradeDone = true
+}
@@ -0,0 +1,127 @@
+// Package bsp is a typed client for the BSP REST API found on
+// the IE generation of DEIF controllers.
+package bsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/deif/iectl/target"
+)
+
+// StatusError is returned whenever the device answers with
+// a status code the called method did not expect.
+type StatusError struct {
+	Host       string
+	Method     string
+	Path       string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected statuscode: %d %s", e.Host, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// StatusCode returns the http status code carried by err, or
+// zero if err is not (or does not wrap) a *StatusError.
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// Client talks to a single device, using the http client of
+// the endpoint - which is expected to be authenticated already.
+type Client struct {
+	Endpoint target.Endpoint
+}
+
+func New(e target.Endpoint) *Client {
+	return &Client{Endpoint: e}
+}
+
+func (c *Client) url(path string) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   c.Endpoint.Hostname,
+		Path:   path,
+	}
+	return u.String()
+}
+
+// do sends in as json (unless in is nil) and decodes the response body
+// into out (unless out is nil). Any status code not in expect results in
+// a *StatusError, expect defaults to 200 OK.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, expect ...int) error {
+	var body io.Reader
+	if in != nil {
+		p, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("%s: unable to marshal request body: %w", c.Endpoint.Hostname, err)
+		}
+		body = bytes.NewReader(p)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http request: %w", c.Endpoint.Hostname, err)
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Endpoint.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: unable to http %s: %w", c.Endpoint.Hostname, method, err)
+	}
+	defer resp.Body.Close()
+
+	err = c.check(req, resp, expect...)
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = decode(resp.Body, out)
+	if err != nil {
+		return fmt.Errorf("%s: unable to unmarshal response: %w", c.Endpoint.Hostname, err)
+	}
+
+	return nil
+}
+
+func (c *Client) check(req *http.Request, resp *http.Response, expect ...int) error {
+	if len(expect) == 0 {
+		expect = []int{http.StatusOK}
+	}
+
+	for _, v := range expect {
+		if resp.StatusCode == v {
+			return nil
+		}
+	}
+
+	return &StatusError{
+		Host:       c.Endpoint.Hostname,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: resp.StatusCode,
+	}
+}
+
+func decode(r io.Reader, out any) error {
+	dec := json.NewDecoder(r)
+	return dec.Decode(out)
+}
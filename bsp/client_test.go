@@ -0,0 +1,219 @@
+package bsp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func newClient(t *testing.T) (*bsptest.Server, *bsp.Client) {
+	t.Helper()
+
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	e, err := srv.Endpoint()
+	if err != nil {
+		t.Fatalf("unable to authenticate: %s", err)
+	}
+
+	return srv, bsp.New(e)
+}
+
+func TestStatus(t *testing.T) {
+	srv, c := newClient(t)
+
+	d, err := c.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unable to get status: %s", err)
+	}
+
+	if d.Serial != srv.Device().Serial {
+		t.Fatalf("unexpected serial: %s", d.Serial)
+	}
+}
+
+func TestPrimaryInterface(t *testing.T) {
+	d := bsp.Device{}
+	err := json.Unmarshal([]byte(`{"interfaces": [
+		{"ifname": "can0", "status": {"link_state": "up"}},
+		{"ifname": "eth0", "status": {"link_state": "down", "ipv4": {"ip": "10.0.0.2"}}},
+		{"ifname": "eth1", "status": {"link_state": "up", "ipv4": {"ip": "192.168.2.21"}}}
+	]}`), &d)
+	if err != nil {
+		t.Fatalf("unable to unmarshal device: %s", err)
+	}
+
+	iface, _ := d.PrimaryInterface()
+	if iface.Ifname != "eth1" {
+		t.Fatalf("expected the interface with link, got %s", iface.Ifname)
+	}
+
+	// without link, any address is better than none
+	d.Interfaces[2].Status.LinkState = "down"
+	iface, _ = d.PrimaryInterface()
+	if iface.Ifname != "eth0" {
+		t.Fatalf("expected the first interface with an address, got %s", iface.Ifname)
+	}
+
+	d.Interfaces = d.Interfaces[:1]
+	iface, _ = d.PrimaryInterface()
+	if iface.Ifname != "can0" {
+		t.Fatalf("expected the only interface, got %s", iface.Ifname)
+	}
+
+	d.Interfaces = nil
+	_, ok := d.PrimaryInterface()
+	if ok {
+		t.Fatalf("expected no interface")
+	}
+}
+
+func TestHostname(t *testing.T) {
+	srv, c := newClient(t)
+	ctx := context.Background()
+
+	err := c.SetHostname(ctx, "rig3-a")
+	if err != nil {
+		t.Fatalf("unable to set hostname: %s", err)
+	}
+
+	h, err := c.Hostname(ctx)
+	if err != nil {
+		t.Fatalf("unable to get hostname: %s", err)
+	}
+
+	if h != "rig3-a" || srv.Device().Hostname != "rig3-a" {
+		t.Fatalf("hostname not set, got %s", h)
+	}
+}
+
+func TestService(t *testing.T) {
+	srv, c := newClient(t)
+	ctx := context.Background()
+
+	err := c.SetServiceRunning(ctx, bsp.ServiceRDP, true)
+	if err != nil {
+		t.Fatalf("unable to enable rdp: %s", err)
+	}
+
+	running, err := c.ServiceRunning(ctx, bsp.ServiceRDP)
+	if err != nil {
+		t.Fatalf("unable to get rdp status: %s", err)
+	}
+
+	if !running || !srv.ServiceRunning(bsp.ServiceRDP) {
+		t.Fatalf("rdp should be running")
+	}
+}
+
+func TestSSHKeys(t *testing.T) {
+	_, c := newClient(t)
+	ctx := context.Background()
+
+	_, err := c.SSHKeys(ctx)
+	if bsp.StatusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404, got: %v", err)
+	}
+
+	err = c.SetSSHKeys(ctx, "nonsense")
+	if bsp.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("expected 400, got: %v", err)
+	}
+
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDkP test@iectl\n"
+	err = c.SetSSHKeys(ctx, key)
+	if err != nil {
+		t.Fatalf("unable to set keys: %s", err)
+	}
+
+	keys, err := c.SSHKeys(ctx)
+	if err != nil || keys != key {
+		t.Fatalf("unexpected keys %q: %v", keys, err)
+	}
+
+	err = c.RemoveSSHKeys(ctx)
+	if err != nil {
+		t.Fatalf("unable to remove keys: %s", err)
+	}
+
+	_, err = c.SSHKeys(ctx)
+	if bsp.StatusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 after remove, got: %v", err)
+	}
+}
+
+func TestFirmware(t *testing.T) {
+	srv, c := newClient(t)
+	ctx := context.Background()
+
+	err := c.StartUpgrade(ctx)
+	if bsp.StatusCode(err) != http.StatusNotFound {
+		t.Fatalf("expected 404 without firmware, got: %v", err)
+	}
+
+	image := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 1<<16)
+	err = c.UploadFirmware(ctx, "ie250-mp-pcm21-v2.0.10.0.raucb", bytes.NewReader(image), int64(len(image)))
+	if err != nil {
+		t.Fatalf("unable to upload firmware: %s", err)
+	}
+
+	f := srv.Firmware()
+	if f == nil || f.Size != int64(len(image)) {
+		t.Fatalf("server did not receive the full image: %+v", f)
+	}
+
+	err = c.StartUpgrade(ctx)
+	if err != nil {
+		t.Fatalf("unable to start upgrade: %s", err)
+	}
+
+	for {
+		status, err := c.UpgradeStatus(ctx)
+		if err != nil {
+			t.Fatalf("unable to get upgrade status: %s", err)
+		}
+		if status.Done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sw := srv.Device().Software
+	if sw.Active != "B" || sw.B != "2.0.10.0" {
+		t.Fatalf("firmware not installed: %+v", sw)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	srv, c := newClient(t)
+	srv.InjectFault(bsptest.Fault{Path: "/bsp/system/*", StatusCode: http.StatusServiceUnavailable, Times: 1})
+
+	err := c.Restart(context.Background(), time.Second)
+
+	var statusErr *bsp.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected *bsp.StatusError, got: %v", err)
+	}
+
+	if statusErr.StatusCode != http.StatusServiceUnavailable || statusErr.Path != "/bsp/system/restart" {
+		t.Fatalf("unexpected status error: %+v", statusErr)
+	}
+
+	// the fault should only have hit once
+	err = c.Restart(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("unable to restart: %s", err)
+	}
+
+	if srv.Restarts() != 1 {
+		t.Fatalf("expected one restart, got %d", srv.Restarts())
+	}
+}
@@ -0,0 +1,112 @@
+package bsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// UploadFirmware streams a firmware image of size bytes to the device.
+// The image is only stored on the device, use StartUpgrade to install it.
+func (c *Client) UploadFirmware(ctx context.Context, name string, image io.Reader, size int64) error {
+	// We render the multipart envelope up front, that way we know
+	// the exact content length without having to buffer the image.
+	var envelope bytes.Buffer
+	mp := multipart.NewWriter(&envelope)
+	_, err := mp.CreateFormFile("file", name)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create multipart body: %w", c.Endpoint.Hostname, err)
+	}
+
+	header := bytes.Clone(envelope.Bytes())
+	envelope.Reset()
+
+	err = mp.Close()
+	if err != nil {
+		return fmt.Errorf("%s: unable to create multipart body: %w", c.Endpoint.Hostname, err)
+	}
+	trailer := envelope.Bytes()
+
+	body := io.MultiReader(bytes.NewReader(header), io.LimitReader(image, size), bytes.NewReader(trailer))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("/bsp/firmware/file"), body)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http request: %w", c.Endpoint.Hostname, err)
+	}
+
+	req.Header.Set("Content-Type", mp.FormDataContentType())
+	req.ContentLength = int64(len(header)) + size + int64(len(trailer))
+
+	resp, err := c.Endpoint.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: unable to http post: %w", c.Endpoint.Hostname, err)
+	}
+	defer resp.Body.Close()
+
+	return c.check(req, resp, http.StatusCreated)
+}
+
+// StartUpgrade asks the device to install the previously uploaded firmware
+func (c *Client) StartUpgrade(ctx context.Context) error {
+	return c.do(ctx, "PUT", "/bsp/firmware/upgrade", nil, nil, http.StatusAccepted)
+}
+
+type UpgradeLine struct {
+	Progress int    `json:"progress"`
+	Text     string `json:"text"`
+}
+
+type UpgradeStatus struct {
+	// Done is set once the device reports the firmware installed
+	Done  bool          `json:"-"`
+	Lines []UpgradeLine `json:"lines"`
+}
+
+// Progress returns the ratio (0.0 to 1.0) and text of the current step
+func (u *UpgradeStatus) Progress() (float64, string) {
+	if u.Done {
+		return 1.0, "Successfully installed firmware."
+	}
+	if len(u.Lines) == 0 {
+		return 0, ""
+	}
+
+	return float64(u.Lines[0].Progress) / 100, u.Lines[0].Text
+}
+
+// UpgradeStatus polls the progress of an upgrade started with StartUpgrade.
+// A device without any uploaded firmware answers 404 while a failed
+// installation answers 500, check for them using StatusCode.
+func (c *Client) UpgradeStatus(ctx context.Context) (*UpgradeStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url("/bsp/firmware/upgrade"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http request: %w", c.Endpoint.Hostname, err)
+	}
+
+	resp, err := c.Endpoint.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to http get: %w", c.Endpoint.Hostname, err)
+	}
+	defer resp.Body.Close()
+
+	err = c.check(req, resp, http.StatusOK, http.StatusAccepted, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &UpgradeStatus{}
+	if resp.StatusCode == http.StatusCreated {
+		status.Done = true
+		return status, nil
+	}
+
+	err = decode(resp.Body, status)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to unmarshal progress: %w", c.Endpoint.Hostname, err)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,20 @@
+package bsp
+
+import "context"
+
+type hostnameDoc struct {
+	Hostname string `json:"hostname"`
+}
+
+func (c *Client) Hostname(ctx context.Context) (string, error) {
+	doc := hostnameDoc{}
+	err := c.do(ctx, "GET", "/bsp/hostname", nil, &doc)
+	if err != nil {
+		return "", err
+	}
+	return doc.Hostname, nil
+}
+
+func (c *Client) SetHostname(ctx context.Context, hostname string) error {
+	return c.do(ctx, "POST", "/bsp/hostname", hostnameDoc{Hostname: hostname}, nil)
+}
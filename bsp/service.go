@@ -0,0 +1,31 @@
+package bsp
+
+import "context"
+
+// Service names a system service that can be toggled
+// through the api.
+type Service string
+
+const (
+	ServiceSSH Service = "ssh"
+	ServiceRDP Service = "rdp"
+)
+
+type serviceDoc struct {
+	Running bool `json:"running"`
+}
+
+// ServiceRunning reports whether service s is enabled
+func (c *Client) ServiceRunning(ctx context.Context, s Service) (bool, error) {
+	doc := serviceDoc{}
+	err := c.do(ctx, "GET", "/bsp/service/"+string(s), nil, &doc)
+	if err != nil {
+		return false, err
+	}
+	return doc.Running, nil
+}
+
+// SetServiceRunning enables or disables service s
+func (c *Client) SetServiceRunning(ctx context.Context, s Service, running bool) error {
+	return c.do(ctx, "PUT", "/bsp/service/"+string(s), serviceDoc{Running: running}, nil)
+}
@@ -0,0 +1,33 @@
+package bsp
+
+import (
+	"context"
+	"net/http"
+)
+
+type sshKeyDoc struct {
+	Certificate string `json:"certificate"`
+}
+
+// SSHKeys returns the authorized_keys of the root user, a device without
+// any keys answers 404, check for it using StatusCode.
+func (c *Client) SSHKeys(ctx context.Context) (string, error) {
+	doc := sshKeyDoc{}
+	err := c.do(ctx, "GET", "/bsp/keys/ssh", nil, &doc)
+	if err != nil {
+		return "", err
+	}
+	return doc.Certificate, nil
+}
+
+// SetSSHKeys replaces the authorized_keys of the root user,
+// keys is expected to be newline separated.
+func (c *Client) SetSSHKeys(ctx context.Context, keys string) error {
+	return c.do(ctx, "POST", "/bsp/keys/ssh", sshKeyDoc{Certificate: keys}, nil,
+		http.StatusOK, http.StatusAccepted)
+}
+
+func (c *Client) RemoveSSHKeys(ctx context.Context) error {
+	return c.do(ctx, "DELETE", "/bsp/keys/ssh", nil, nil,
+		http.StatusOK, http.StatusAccepted)
+}
@@ -0,0 +1,123 @@
+package bsp
+
+import (
+	"context"
+)
+
+type Interface struct {
+	Description string `json:"description"`
+	Ifname      string `json:"ifname"`
+	Kind        string `json:"kind"`
+	Status      struct {
+		LinkState  string `json:"link_state"`
+		MacAddress string `json:"mac_address"`
+		IPv4       *struct {
+			IP           string `json:"ip"`
+			PrefixLength int    `json:"prefix_length"`
+		} `json:"ipv4,omitempty"`
+		IPv6 *struct {
+			IP           string `json:"ip"`
+			PrefixLength int    `json:"prefix_length"`
+		} `json:"ipv6,omitempty"`
+	} `json:"status"`
+}
+
+type MountPoint struct {
+	MountPoint string `json:"mountPoint"`
+	Size       uint64 `json:"size"`
+	Used       uint64 `json:"used"`
+}
+
+// Usage returns how much of the mountpoint is used, in percent
+func (m MountPoint) Usage() float64 {
+	if m.Size == 0 {
+		return 0
+	}
+	return float64(m.Used) / float64(m.Size) * 100
+}
+
+type Software struct {
+	A      string `json:"A"`
+	B      string `json:"B"`
+	Active string `json:"active"`
+}
+
+// ActiveVersion returns the version of the software in the active slot
+func (s Software) ActiveVersion() string {
+	if s.Active == "B" {
+		return s.B
+	}
+	return s.A
+}
+
+// Inactive returns the slot which is not active, A or B
+func (s Software) Inactive() string {
+	if s.Active == "B" {
+		return "A"
+	}
+	return "B"
+}
+
+// InactiveVersion returns the version of the software in the other slot,
+// which is what the device falls back to
+func (s Software) InactiveVersion() string {
+	if s.Active == "B" {
+		return s.A
+	}
+	return s.B
+}
+
+type Device struct {
+	Hostname    string       `json:"hostname"`
+	Interfaces  []Interface  `json:"interfaces"`
+	Mountpoints []MountPoint `json:"mountpoints"`
+	Serial      string       `json:"serialnumber"`
+	Software    Software     `json:"software"`
+}
+
+// Mountpoint returns the mountpoint at path
+func (d *Device) Mountpoint(path string) (MountPoint, bool) {
+	for _, v := range d.Mountpoints {
+		if v.MountPoint == path {
+			return v, true
+		}
+	}
+	return MountPoint{}, false
+}
+
+// PrimaryInterface returns the interface the device is most likely reached
+// on, the first one with an IPv4 address - preferring those with link.
+func (d *Device) PrimaryInterface() (Interface, bool) {
+	var fallback *Interface
+	for i, v := range d.Interfaces {
+		if v.Status.IPv4 == nil {
+			continue
+		}
+		if v.Status.LinkState == "up" {
+			return v, true
+		}
+		if fallback == nil {
+			fallback = &d.Interfaces[i]
+		}
+	}
+
+	if fallback != nil {
+		return *fallback, true
+	}
+
+	if len(d.Interfaces) > 0 {
+		return d.Interfaces[0], true
+	}
+
+	return Interface{}, false
+}
+
+// Status fetches general system status
+func (c *Client) Status(ctx context.Context) (*Device, error) {
+	d := &Device{}
+	err := c.do(ctx, "GET", "/bsp/system/status", nil, d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
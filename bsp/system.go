@@ -0,0 +1,37 @@
+package bsp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Restart reboots the device after delay, rounded up to the nearest second.
+func (c *Client) Restart(ctx context.Context, delay time.Duration) error {
+	req := struct {
+		Delay int `json:"delay"`
+	}{
+		Delay: int(math.Ceil(delay.Seconds())),
+	}
+
+	return c.do(ctx, "POST", "/bsp/system/restart", req, nil,
+		http.StatusOK, http.StatusAccepted)
+}
+
+func (c *Client) FactoryReset(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("/bsp/system/reset"), nil)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http request: %w", c.Endpoint.Hostname, err)
+	}
+	req.Header.Set("Content-Type", "application/binary")
+
+	resp, err := c.Endpoint.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: unable to http post: %w", c.Endpoint.Hostname, err)
+	}
+	defer resp.Body.Close()
+
+	return c.check(req, resp, http.StatusOK, http.StatusAccepted)
+}
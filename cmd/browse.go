@@ -3,49 +3,69 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
-	"github.com/deif/iectl/mdns"
+	"github.com/deif/iectl/cmd/bsp"
+	"github.com/deif/iectl/output"
 	"github.com/deif/iectl/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/miekg/dns"
 	openBrowser "github.com/pkg/browser"
 	"github.com/spf13/cobra"
 )
 
-var updates chan []*mdns.Target
-
 var browseCmd = &cobra.Command{
 	Use:   "browse",
 	Short: "browse DEIF devices on the network",
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		asJson, _ := cmd.Flags().GetBool("json")
-		if asJson {
-			return fmt.Errorf("browse can't do --json")
-		}
-		return nil
-	},
+	Long: `browse DEIF devices on the network, and open the web interface of those selected.
+
+With structured output, e.g. --json, the selected devices are printed instead
+of opened, the browser is then drawn on stderr:
+
+  iectl browse -o ndjson | jq -r .hostname
+
+Given a password, stored credentials (see iectl bsp credentials) or cached
+sessions, the status of every device is fetched as well - and can be filtered
+on along with addresses, interface and TXT records. Only devices whose
+certificate is trusted already are logged in to.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		q := dns.Question{Name: dns.Fqdn("_base-unit-deif._tcp.local"), Qtype: dns.TypePTR}
-		browser := mdns.Browser{Question: q}
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		networks, _ := cmd.Flags().GetStringSlice("scan")
+		d, err := bsp.DiscovererFromFlags(cmd.Flags(), networks, nil)
+		if err != nil {
+			return err
+		}
 
-		var err error
-		updates, err = browser.Run(context.Background())
+		events, err := d.Run(context.Background())
 		if err != nil {
-			return fmt.Errorf("unable to browse mdns: %w", err)
+			return fmt.Errorf("unable to discover devices: %w", err)
 		}
 
-		m := tui.BrowserModel(updates)
+		useIP, _ := cmd.Flags().GetBool("use-ip")
+		m := tui.BrowserModel(events, bsp.StatusFromFlags(cmd, useIP))
 
-		p := tea.NewProgram(m, tea.WithAltScreen())
+		options := []tea.ProgramOption{tea.WithAltScreen()}
+		if out.Structured() {
+			options = append(options, tea.WithOutput(os.Stderr))
+		}
+
+		p := tea.NewProgram(m, options...)
 		if _, err := p.Run(); err != nil {
 			return err
 		}
 
+		if out.Structured() {
+			return out.Print(m.Selected)
+		}
+
 		// m.Selected should now hold whatever the user wanted to open
 		// it may be empty, in case that the user just wanted to quit
 		for _, v := range m.Selected {
-			err := openBrowser.OpenURL(v.Description())
+			err := openBrowser.OpenURL(v.URL())
 			if err != nil {
 				return err
 			}
@@ -55,5 +75,10 @@ var browseCmd = &cobra.Command{
 }
 
 func init() {
+	bsp.AddBrowserFlags(browseCmd.Flags())
+	browseCmd.Flags().StringSlice("scan", []string{}, "probe network(s) in CIDR notation for devices instead of using mDNS")
+	browseCmd.Flags().Bool("use-ip", false, "fetch status by ip address instead of hostname")
+	bsp.AddLoginFlags(browseCmd.Flags(), "")
+	bsp.AddTLSFlags(browseCmd.Flags())
 	rootCmd.AddCommand(browseCmd)
 }
@@ -0,0 +1,168 @@
+package bsp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestMain(m *testing.M) {
+	// these normally live on the iectl root command
+	output.AddFlags(RootCmd.PersistentFlags())
+	RootCmd.PersistentFlags().BoolP("interactive", "i", false, "interactive mode")
+
+	// keep tokens and credentials away from whoever runs the tests
+	dir, err := os.MkdirTemp("", "iectl-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.Setenv("HOME", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newServer(t *testing.T) *bsptest.Server {
+	t.Helper()
+	srv := bsptest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// execute runs iectl bsp with args against servers,
+// returning what the command wrote to stdout.
+func execute(t *testing.T, servers []*bsptest.Server, args ...string) (string, error) {
+	t.Helper()
+	return executeVerified(t, servers, append(args, "--insecure")...)
+}
+
+// executeVerified is execute, but verifying the certificates of servers
+func executeVerified(t *testing.T, servers []*bsptest.Server, args ...string) (string, error) {
+	t.Helper()
+
+	for _, v := range servers {
+		args = append(args, "--target", v.Host())
+	}
+
+	return run(t, args...)
+}
+
+// run runs iectl bsp with args, returning what the command wrote to stdout
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	resetFlags(RootCmd)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %s", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		p, _ := io.ReadAll(r)
+		output <- string(p)
+	}()
+
+	RootCmd.SetArgs(args)
+	RootCmd.SilenceUsage = true
+	RootCmd.SilenceErrors = true
+	err = RootCmd.Execute()
+
+	w.Close()
+	return <-output, err
+}
+
+// withStdin makes s the stdin of commands, until the test is done
+func withStdin(t *testing.T, s string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %s", err)
+	}
+	w.WriteString(s)
+	w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+// resetFlags puts every flag back to its default value, as cobra
+// keeps flag values between runs.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+
+		sv, ok := f.Value.(pflag.SliceValue)
+		if ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+
+	for _, v := range cmd.Commands() {
+		resetFlags(v)
+	}
+}
+
+func assertContains(t *testing.T, output, substr string) {
+	t.Helper()
+	if !strings.Contains(output, substr) {
+		t.Fatalf("expected output to contain %q, got:\n%s", substr, output)
+	}
+}
+
+// failure is the text of err, along with the errors of the targets
+// it failed on - those are told about on stderr, not in err.
+func failure(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	text := err.Error()
+
+	var fleetErr *fleet.Error
+	if errors.As(err, &fleetErr) {
+		for _, v := range fleetErr.Unwrap() {
+			text += "\n" + v.Error()
+		}
+	}
+
+	return text
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	srv := newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{srv}, "status", "--password", "wrong")
+	if !strings.Contains(failure(err), "invalid credentials") {
+		t.Fatalf("expected invalid credentials, got: %v", err)
+	}
+}
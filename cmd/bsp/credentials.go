@@ -0,0 +1,320 @@
+package bsp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/deif/iectl/credentials"
+	"github.com/deif/iectl/inventory"
+	"github.com/deif/iectl/output"
+	"github.com/spf13/cobra"
+)
+
+// passphraseEnv holds the passphrase of the credentials store, for
+// when there is no one to ask and no command to run.
+const passphraseEnv = "IECTL_CREDENTIALS_PASSPHRASE"
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "List, set or remove stored credentials",
+	Long: `List, set or remove stored credentials
+
+Usernames and passwords of devices can be kept in an encrypted file, by
+default credentials in the iectl config directory or given by --credentials.
+Entries match devices by hostname, address, serial number (if it is known
+from the inventory or discovery) or a glob of either, e.g. 'iE250-*' or
+'10.20.3.*'. Exact matches win over globs.
+
+Passwords are looked up in order: the inventory, --password if given, the
+credentials file and at last the default --password.
+
+The file is unlocked using the output of --credentials-passphrase-command,
+the IECTL_CREDENTIALS_PASSPHRASE environment variable or by asking.`,
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		s, err := openCredentials(cmd, false)
+		if err != nil {
+			return err
+		}
+
+		// passwords are never shown
+		type entry struct {
+			Match    string `json:"match"`
+			Username string `json:"username"`
+		}
+
+		entries := make([]entry, 0)
+		if s != nil {
+			for _, e := range s.Entries {
+				entries = append(entries, entry{e.Match, e.Username})
+			}
+		}
+
+		if out.Structured() {
+			return out.Print(entries)
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("no stored credentials")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MATCH\tUSERNAME")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\n", e.Match, e.Username)
+		}
+		return w.Flush()
+	},
+}
+
+var credentialsSetCmd = &cobra.Command{
+	Use:   "set <match>",
+	Short: "Store the username and password of devices matching <match>",
+	Long: `Store the username and password of devices matching <match>
+
+The username is given by --username, the password is asked for twice - or
+read from stdin using --password-stdin:
+
+  pass show rig3 | iectl bsp credentials set '10.20.3.*' --password-stdin`,
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		user, _ := cmd.Flags().GetString("username")
+
+		fromStdin, _ := cmd.Flags().GetBool("password-stdin")
+		var (
+			pass []byte
+			err  error
+		)
+		if fromStdin {
+			pass, err = readLine(os.Stdin)
+		} else {
+			pass, err = askTwice(fmt.Sprintf("Enter password for %s@%s: ", user, args[0]))
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(pass) == 0 {
+			return fmt.Errorf("refusing to store an empty password")
+		}
+
+		s, err := openCredentials(cmd, true)
+		if err != nil {
+			return err
+		}
+
+		s.Set(credentials.Entry{Match: args[0], Username: user, Password: string(pass)})
+		return s.Save()
+	},
+}
+
+var credentialsRemoveCmd = &cobra.Command{
+	Use:         "remove <match>",
+	Short:       "Remove the stored credentials for <match>",
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openCredentials(cmd, false)
+		if err != nil {
+			return err
+		}
+
+		if s == nil || !s.Remove(args[0]) {
+			return fmt.Errorf("no stored credentials for %q", args[0])
+		}
+
+		return s.Save()
+	},
+}
+
+func init() {
+	credentialsSetCmd.Flags().Bool("password-stdin", false, "read the password from the first line of stdin")
+	credentialsCmd.AddCommand(credentialsSetCmd)
+	credentialsCmd.AddCommand(credentialsRemoveCmd)
+	RootCmd.AddCommand(credentialsCmd)
+}
+
+// credentialsPath is the file named by --credentials, or the default one
+func credentialsPath(cmd *cobra.Command) (string, error) {
+	path, _ := cmd.Flags().GetString("credentials")
+	if path != "" {
+		return path, nil
+	}
+
+	return credentials.DefaultPath()
+}
+
+// openCredentials unlocks the credentials file, which is nil if there is
+// none - unless create is set, then a new one is returned.
+func openCredentials(cmd *cobra.Command, create bool) (*credentials.Store, error) {
+	path, err := credentialsPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := credentials.Exists(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if !create {
+			return nil, nil
+		}
+
+		p, err := passphrase(cmd, path, true)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.New(path, p)
+	}
+
+	p, err := passphrase(cmd, path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.Open(path, p)
+}
+
+// passphrase returns the passphrase of the credentials file at path, from
+// --credentials-passphrase-command, the environment or by asking. A new
+// passphrase is asked for twice.
+func passphrase(cmd *cobra.Command, path string, create bool) ([]byte, error) {
+	command, _ := cmd.Flags().GetString("credentials-passphrase-command")
+	if command != "" {
+		return passphraseFromCommand(command)
+	}
+
+	p, ok := os.LookupEnv(passphraseEnv)
+	if ok {
+		return []byte(p), nil
+	}
+
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	if !interactive {
+		return nil, fmt.Errorf("unable to unlock %s, use --credentials-passphrase-command or set %s", path, passphraseEnv)
+	}
+
+	if create {
+		return askTwice(fmt.Sprintf("Enter new passphrase for %s: ", path))
+	}
+
+	fmt.Printf("Enter passphrase for %s: ", path)
+	pass, err := readPassword()
+	fmt.Println()
+	if err != nil {
+		return nil, fmt.Errorf("unable to ask for passphrase: %w", err)
+	}
+
+	return pass, nil
+}
+
+// passphraseFromCommand runs command using the shell, and returns the first
+// line it outputs - e.g. 'pass show iectl' or 'security find-generic-password -w -s iectl'.
+func passphraseFromCommand(command string) ([]byte, error) {
+	c := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	}
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+
+	p, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("passphrase command failed: %w", err)
+	}
+
+	return readLine(bytes.NewReader(p))
+}
+
+// askTwice asks for a secret until it is entered the same way twice
+func askTwice(prompt string) ([]byte, error) {
+	for {
+		fmt.Print(prompt)
+		first, err := readPassword()
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("unable to ask for password: %w", err)
+		}
+
+		fmt.Print("Enter it again: ")
+		second, err := readPassword()
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("unable to ask for password: %w", err)
+		}
+
+		if bytes.Equal(first, second) {
+			return first, nil
+		}
+
+		fmt.Println("They did not match, try again.")
+	}
+}
+
+// readLine reads the first line of r, without the line ending
+func readLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("unable to read password: %w", err)
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// secrets unlocks the credentials file once the first target needs it,
+// commands not logging in never ask for the passphrase.
+type secrets struct {
+	cmd *cobra.Command
+
+	once  sync.Once
+	store *credentials.Store
+	err   error
+}
+
+// unlock opens the credentials file, unless done already
+func (s *secrets) unlock() error {
+	s.once.Do(func() {
+		s.store, s.err = openCredentials(s.cmd, false)
+	})
+
+	return s.err
+}
+
+// lookup returns the stored credentials of device, if any
+func (s *secrets) lookup(device *inventory.Device) (credentials.Entry, bool, error) {
+	err := s.unlock()
+	if err != nil {
+		return credentials.Entry{}, false, fmt.Errorf("unable to unlock credentials: %w", err)
+	}
+	if s.store == nil {
+		return credentials.Entry{}, false, nil
+	}
+
+	host := device.Address
+	h, _, err := net.SplitHostPort(device.Address)
+	if err == nil {
+		host = h
+	}
+
+	e, ok := s.store.Lookup(device.Name, device.Address, host, device.Serial)
+	return e, ok, nil
+}
@@ -0,0 +1,81 @@
+package bsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+// setCredentials stores password for match, as if piped to bsp credentials set
+func setCredentials(t *testing.T, file, match, password string) {
+	t.Helper()
+
+	withStdin(t, password+"\n")
+	_, err := execute(t, nil, "credentials", "set", match, "--password-stdin", "--credentials", file)
+	if err != nil {
+		t.Fatalf("unable to set credentials: %s", err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+	file := filepath.Join(t.TempDir(), "credentials")
+
+	a, b := newServer(t), newServer(t)
+	a.Password, b.Password = "alpha", "bravo"
+
+	setCredentials(t, file, a.Host(), "alpha")
+	setCredentials(t, file, "127.0.0.*", "bravo")
+
+	p, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read credentials: %s", err)
+	}
+	if strings.Contains(string(p), "alpha") || strings.Contains(string(p), "bravo") {
+		t.Fatalf("passwords written in plaintext")
+	}
+
+	// the exact match wins for a, the glob is used for b
+	_, err = execute(t, []*bsptest.Server{a, b}, "status", "--credentials", file, "--no-token-cache")
+	if err != nil {
+		t.Fatalf("expected stored credentials to be used, got %s", err)
+	}
+
+	// the passphrase may come from a command as well
+	os.Unsetenv(passphraseEnv)
+	out, err := execute(t, nil, "credentials", "--credentials", file, "--credentials-passphrase-command", "echo correct horse")
+	if err != nil {
+		t.Fatalf("unable to list credentials: %s", err)
+	}
+	assertContains(t, out, "127.0.0.*")
+	if strings.Contains(out, "bravo") {
+		t.Fatalf("expected passwords not to be listed:\n%s", out)
+	}
+
+	// an explicit --password wins over the stored ones
+	_, err = execute(t, []*bsptest.Server{a}, "status", "--credentials", file, "--no-token-cache", "--password", "wrong")
+	if err == nil {
+		t.Fatalf("expected --password to be used")
+	}
+
+	// the wrong passphrase is no good
+	t.Setenv(passphraseEnv, "battery staple")
+	_, err = execute(t, []*bsptest.Server{a}, "status", "--credentials", file, "--no-token-cache")
+	if !strings.Contains(failure(err), "wrong passphrase") {
+		t.Fatalf("expected the wrong passphrase to fail, got %v", err)
+	}
+
+	t.Setenv(passphraseEnv, "correct horse")
+	_, err = execute(t, nil, "credentials", "remove", "127.0.0.*", "--credentials", file)
+	if err != nil {
+		t.Fatalf("unable to remove credentials: %s", err)
+	}
+
+	_, err = execute(t, nil, "credentials", "remove", "127.0.0.*", "--credentials", file)
+	if err == nil {
+		t.Fatalf("expected removing twice to fail")
+	}
+}
@@ -0,0 +1,45 @@
+package debug
+
+import (
+	"context"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/target"
+)
+
+func execute(ctx context.Context, args ...string) error {
+	for _, v := range RootCmd.Commands() {
+		v.SetContext(ctx)
+	}
+
+	RootCmd.SetArgs(args)
+	RootCmd.SilenceUsage = true
+	RootCmd.SilenceErrors = true
+	return RootCmd.ExecuteContext(ctx)
+}
+
+func TestGet(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	e, err := srv.Endpoint()
+	if err != nil {
+		t.Fatalf("unable to authenticate: %s", err)
+	}
+
+	err = execute(target.NewContext(context.Background(), target.Collection{e}), "get", "hostname")
+	if err != nil {
+		t.Fatalf("debug get failed: %s", err)
+	}
+}
+
+func TestMultipleTargets(t *testing.T) {
+	ctx := target.NewContext(context.Background(), target.Collection{
+		{Hostname: "a"}, {Hostname: "b"},
+	})
+	err := execute(ctx, "get", "hostname")
+	if err == nil {
+		t.Fatalf("expected refusal with more than one target")
+	}
+}
@@ -128,7 +128,7 @@ func isResponsePrintable(read *bufio.Reader) bool {
 	i := 0
 	for i < len(bytes) {
 		rune, size := utf8.DecodeRune(bytes[i:])
-		fmt.Printf("%s\n", rune)
+		fmt.Printf("%c\n", rune)
 		if rune == utf8.RuneError {
 			// found unreadable byte.
 			// if we are at the end of the chunk, see if last byte(s) could
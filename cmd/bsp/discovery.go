@@ -0,0 +1,116 @@
+package bsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/mdns"
+	"github.com/deif/iectl/scan"
+	"github.com/deif/iectl/target"
+	"github.com/deif/iectl/tui"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Discoverer finds devices, it is implemented by both
+// mdns.Browser and scan.Scanner.
+type Discoverer interface {
+	Run(ctx context.Context) (chan mdns.Event, error)
+}
+
+// AddBrowserFlags adds the flags controlling how devices are discovered,
+// they are shared by discover, browse and the bsp target flags.
+func AddBrowserFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("interface", []string{}, "only discover devices on the given network interface(s)")
+	flags.String("service", mdns.DefaultService, "DNS-SD service type devices announce")
+	flags.String("domain", mdns.DefaultDomain, "domain to discover devices in, other domains than local are looked up using unicast dns")
+	flags.String("dns-server", "", "unicast dns server (host[:port]) to discover devices from, in addition to mDNS")
+	flags.Uint16("scan-port", 443, "https port probed when scanning networks")
+}
+
+// BrowserFromFlags returns a browser configured by the flags added
+// by AddBrowserFlags.
+func BrowserFromFlags(flags *pflag.FlagSet) mdns.Browser {
+	interfaces, _ := flags.GetStringSlice("interface")
+	service, _ := flags.GetString("service")
+	domain, _ := flags.GetString("domain")
+	server, _ := flags.GetString("dns-server")
+
+	return mdns.Browser{
+		Service:    service,
+		Domain:     domain,
+		Interfaces: interfaces,
+		Server:     server,
+	}
+}
+
+// DiscovererFromFlags returns a scanner probing networks if any are given,
+// and a browser configured by the flags from AddBrowserFlags otherwise. The
+// scanner gets the details of devices found using status, if not nil.
+func DiscovererFromFlags(flags *pflag.FlagSet, networks []string, status tui.StatusFunc) (Discoverer, error) {
+	if len(networks) == 0 {
+		b := BrowserFromFlags(flags)
+		return &b, nil
+	}
+
+	prefixes, err := scan.ParsePrefixes(networks)
+	if err != nil {
+		return nil, err
+	}
+
+	port, _ := flags.GetUint16("scan-port")
+
+	return &scan.Scanner{
+		Prefixes: prefixes,
+		Port:     port,
+		Status:   status,
+	}, nil
+}
+
+// StatusFromFlags returns a function fetching the status of discovered
+// devices, logging in like the bsp commands do - or nil if there is nothing
+// to log in with.
+func StatusFromFlags(cmd *cobra.Command, useIP bool) tui.StatusFunc {
+	logins, err := LoginsFromFlags(cmd)
+	if err != nil {
+		return func(context.Context, mdns.Target) (*bsp.Device, error) {
+			return nil, err
+		}
+	}
+
+	return logins.status(useIP)
+}
+
+// status returns a function fetching the status of discovered devices, or nil
+// if there is nothing to log in with. Looking at a device is no reason to trust
+// it, devices whose certificate is not trusted already are reported as untrusted.
+func (l *Logins) status(useIP bool) tui.StatusFunc {
+	usable, err := l.usable()
+	if err == nil && !usable {
+		return nil
+	}
+
+	if l.tls.Known != nil {
+		known := auth.NewKnownHosts(l.tls.Known.Path)
+		known.Strict = true
+		l.tls.Known = known
+	}
+
+	return func(ctx context.Context, t mdns.Target) (*bsp.Device, error) {
+		c, err := l.Client(ctx, t, useIP)
+
+		var unknown *auth.UnknownHostError
+		if errors.As(err, &unknown) {
+			return nil, fmt.Errorf("untrusted, certificate %s - trust it using 'iectl bsp trust add %s'", unknown.Fingerprint, unknown.Host)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer auth.Close(c)
+
+		return bsp.New(target.Endpoint{Hostname: t.Address(useIP), Client: c}).Status(ctx)
+	}
+}
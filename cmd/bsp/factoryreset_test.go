@@ -0,0 +1,29 @@
+package bsp
+
+import (
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestFactoryReset(t *testing.T) {
+	srv := newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{srv}, "hostname", "rig3-a")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+
+	_, err = execute(t, []*bsptest.Server{srv}, "factory-reset")
+	if err != nil {
+		t.Fatalf("factory-reset failed: %s", err)
+	}
+
+	if srv.FactoryResets() != 1 {
+		t.Fatalf("expected a factory reset")
+	}
+
+	if srv.Device().Hostname == "rig3-a" {
+		t.Fatalf("hostname survived factory reset")
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
 	"github.com/deif/iectl/target"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -25,15 +28,17 @@ func init() {
 var firmwareCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install new firmware on device",
-	Args:  cobra.MatchAll(cobra.ExactArgs(1)),
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		asJson, _ := cmd.Flags().GetBool("json")
-		if asJson {
-			return fmt.Errorf("install can't do --json")
-		}
-		return nil
-	},
+	Long: `Install new firmware on device
+
+With structured output, e.g. --json, the progress is drawn on stderr and
+the outcome for each target is printed once done.`,
+	Args: cobra.MatchAll(cobra.ExactArgs(1)),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
 		// lets just check if we are able to open the file in question
 		// we could also Stat the, but this dosnt take into account
 		// if we are actually allowed to open the file
@@ -47,125 +52,172 @@ var firmwareCmd = &cobra.Command{
 		// to the user on errors - just display the ui and the error
 		cmd.SilenceUsage = true
 
-		targets := target.FromContext(cmd.Context())
-		firmwareTargets := make([]*firmwareTarget, 0, len(targets))
-		for _, t := range targets {
-			ft, err := newFirmwareTarget(
-				target.Endpoint{Hostname: t.Hostname, Client: t.Client},
-				args[0],
-			)
+		// without an interactive terminal, there is no keyboard to read from
+		uiOptions := make([]tea.ProgramOption, 0)
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		if !interactive {
+			uiOptions = append(uiOptions, tea.WithInput(nil))
+		}
 
-			if err != nil {
-				return fmt.Errorf("unable to prepare firmware task: %w", err)
-			}
+		// stdout is for the results
+		if out.Structured() {
+			uiOptions = append(uiOptions, tea.WithOutput(os.Stderr))
+		}
 
-			firmwareTargets = append(firmwareTargets, ft)
+		targets := target.FromContext(cmd.Context())
+		results, err := InstallFirmware(targets, args[0], uiOptions...)
+		if !out.Structured() || results == nil {
+			return err
 		}
 
-		// we now hold a bunch of firmwaretargets ready to proceed
-		m, err := multiProgressModelWithTargets(firmwareTargets)
+		return errors.Join(err, fleet.FromContext(cmd.Context()).Summary(results))
+	},
+}
+
+// InstallFirmware uploads file to every target, and installs it once it is
+// uploaded everywhere - showing the progress of each target as it goes.
+// The outcome for each target is returned, nil if nothing was attempted.
+func InstallFirmware(targets target.Collection, file string, uiOptions ...tea.ProgramOption) ([]fleet.Result, error) {
+	// log in before the ui takes the terminal, someone might
+	// have to be asked for a password
+	err := targets.Authenticate()
+	if err != nil {
+		return nil, err
+	}
+
+	firmwareTargets := make([]*firmwareTarget, 0, len(targets))
+	for _, t := range targets {
+		ft, err := newFirmwareTarget(
+			target.Endpoint{Hostname: t.Hostname, Client: t.Client},
+			file,
+		)
+
 		if err != nil {
-			return fmt.Errorf("unable to initialize ui: %w", err)
+			return nil, fmt.Errorf("unable to prepare firmware task: %w", err)
 		}
 
-		// This context and cancel func is used to cancel the next few operations
-		operationContext, operationCancel := context.WithCancel(context.Background())
+		firmwareTargets = append(firmwareTargets, ft)
+	}
+
+	// we now hold a bunch of firmwaretargets ready to proceed
+	m, err := multiProgressModelWithTargets(firmwareTargets)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize ui: %w", err)
+	}
+
+	// This context and cancel func is used to cancel the next few operations
+	operationContext, operationCancel := context.WithCancel(context.Background())
+	defer operationCancel()
+
+	// the outcome for each target, in case anyone asks
+	start := time.Now()
+	results := make([]fleet.Result, len(firmwareTargets))
+	done := func(i int, err error) {
+		results[i].Err = err
+		results[i].Duration = time.Since(start)
+	}
+
+	var uiGroup errgroup.Group
+	ui := tea.NewProgram(m, uiOptions...)
+	uiGroup.Go(func() error {
+		// when the ui quits, cancel whatever we are doing
 		defer operationCancel()
 
-		var uiGroup errgroup.Group
-		ui := tea.NewProgram(m)
-		uiGroup.Go(func() error {
-			// when the ui quits, cancel whatever we are doing
-			defer operationCancel()
-
-			if _, err := ui.Run(); err != nil {
-				return fmt.Errorf("ui failed: %w", err)
-			}
-
-			return nil
-		})
+		if _, err := ui.Run(); err != nil {
+			return fmt.Errorf("ui failed: %w", err)
+		}
 
-		var loadGroup errgroup.Group
-		loadGroup.SetLimit(maxConcurrency)
-		for _, v := range firmwareTargets {
-			loadGroup.Go(func() error {
-				// feed status updates to ui
-				var wg sync.WaitGroup
-				wg.Add(1)
-				go func() error {
-					for {
-						p, open := <-v.LoadProgress
-						if !open {
-							wg.Done()
-							return nil
-						}
-
-						ui.Send(hostUpdate{p, v.Hostname})
+		return nil
+	})
+
+	var loadGroup errgroup.Group
+	loadGroup.SetLimit(maxConcurrency)
+	for i, v := range firmwareTargets {
+		results[i].Hostname = v.Hostname
+		loadGroup.Go(func() error {
+			// feed status updates to ui
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() error {
+				for {
+					p, open := <-v.LoadProgress
+					if !open {
+						wg.Done()
+						return nil
 					}
-				}()
 
-				// block here until the firmware is uploaded
-				err := v.LoadFirmware(operationContext, 3)
-				if err != nil {
-					err = fmt.Errorf("%s failed: %w", v.Hostname, err)
+					ui.Send(hostUpdate{p, v.Hostname})
 				}
+			}()
 
-				wg.Wait() // we have to wait until the ui feeder has emptied the
-				// progress channel and sent it to the ui, otherwise
-				// the ui will not properly show relevant information
-
-				return err
-			})
-		}
+			// block here until the firmware is uploaded
+			err := v.LoadFirmware(operationContext, 3)
+			if err != nil {
+				err = fmt.Errorf("%s failed: %w", v.Hostname, err)
+				done(i, err)
+			}
 
-		operationError := loadGroup.Wait()
-		if operationError != nil {
-			ui.Quit()
+			wg.Wait() // we have to wait until the ui feeder has emptied the
+			// progress channel and sent it to the ui, otherwise
+			// the ui will not properly show relevant information
 
-			return errors.Join(operationError, uiGroup.Wait())
-		}
+			return err
+		})
+	}
 
-		// well, we are here, all controllers have the file uploaded
+	operationError := loadGroup.Wait()
+	if operationError != nil {
+		ui.Quit()
 
-		for _, v := range firmwareTargets {
-			ui.Send(hostUpdate{progressMsg{ratio: 0.0, status: "Queued..."}, v.Hostname})
+		// firmware is only applied once it is loaded everywhere
+		for i := range results {
+			results[i].Skipped = results[i].Err == nil
 		}
 
-		for _, v := range firmwareTargets {
-			loadGroup.Go(func() error {
-				// once again, feed status into ui
-				var wg sync.WaitGroup
-				wg.Add(1)
-				go func() error {
-					for {
-						p, open := <-v.ApplyProgress
-						if !open {
-							wg.Done()
-							return nil
-						}
-
-						ui.Send(hostUpdate{p, v.Hostname})
+		return results, errors.Join(operationError, uiGroup.Wait())
+	}
+
+	// well, we are here, all controllers have the file uploaded
+
+	for _, v := range firmwareTargets {
+		ui.Send(hostUpdate{progressMsg{ratio: 0.0, status: "Queued..."}, v.Hostname})
+	}
+
+	for i, v := range firmwareTargets {
+		loadGroup.Go(func() error {
+			// once again, feed status into ui
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() error {
+				for {
+					p, open := <-v.ApplyProgress
+					if !open {
+						wg.Done()
+						return nil
 					}
-				}()
 
-				ui.Send(hostUpdate{progressMsg{ratio: 0.1, status: "Connecting"}, v.Hostname})
-
-				// block here until the firmware is uploaded
-				err := v.ApplyFirmware(operationContext, 1)
-				if err != nil {
-					err = fmt.Errorf("%s failed: %w", v.Hostname, err)
+					ui.Send(hostUpdate{p, v.Hostname})
 				}
+			}()
 
-				wg.Wait()
+			ui.Send(hostUpdate{progressMsg{ratio: 0.1, status: "Connecting"}, v.Hostname})
 
-				return err
-			})
-		}
+			// block here until the firmware is uploaded
+			err := v.ApplyFirmware(operationContext, 1)
+			if err != nil {
+				err = fmt.Errorf("%s failed: %w", v.Hostname, err)
+			}
+			done(i, err)
 
-		operationError = loadGroup.Wait()
+			wg.Wait()
 
-		ui.Quit()
+			return err
+		})
+	}
 
-		return errors.Join(operationError, uiGroup.Wait())
-	},
+	operationError = loadGroup.Wait()
+
+	ui.Quit()
+
+	return results, errors.Join(operationError, uiGroup.Wait())
 }
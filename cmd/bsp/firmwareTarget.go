@@ -2,21 +2,18 @@ package bsp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/deif/iectl/bsp"
 	"github.com/deif/iectl/target"
 	"github.com/dustin/go-humanize"
 
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
 
@@ -32,6 +29,10 @@ type progressWriter2 struct {
 	limiter          *rate.Limiter
 	stallTimer       *time.Timer
 	stopStallRoutine chan struct{}
+
+	// the http client might still be reading the request body
+	// when it returns, any writes after Close are dropped.
+	closed bool
 }
 
 func (p *progressWriter2) Initialize() {
@@ -51,6 +52,10 @@ func (p *progressWriter2) Initialize() {
 
 			if p.limiter.Allow() {
 				p.RLock()
+				if p.closed {
+					p.RUnlock()
+					return
+				}
 				msg := progressMsg{
 					ratio: float64(p.written) / float64(p.total),
 					status: fmt.Sprintf("%s of %s (stalled, timeout in %s)",
@@ -59,9 +64,9 @@ func (p *progressWriter2) Initialize() {
 						(60*time.Second - time.Now().Sub(p.lastWrittenTime)).Truncate(time.Second),
 					),
 				}
-				p.RUnlock()
 
 				p.channel <- msg
+				p.RUnlock()
 			}
 
 			p.stallTimer.Reset(time.Second)
@@ -74,6 +79,10 @@ func (p *progressWriter2) Write(in []byte) (int, error) {
 	p.Lock()
 	defer p.Unlock()
 
+	if p.closed {
+		return len(in), nil
+	}
+
 	p.lastWrittenTime = time.Now()
 	p.written += len(in)
 	p.stallTimer.Reset(time.Second)
@@ -91,6 +100,10 @@ func (p *progressWriter2) Write(in []byte) (int, error) {
 }
 
 func (p *progressWriter2) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.closed = true
 	p.stallTimer.Stop()
 	close(p.channel)
 	close(p.stopStallRoutine)
@@ -135,18 +148,6 @@ func newFirmwareTarget(t target.Endpoint, firmwareBlobPath string) (*firmwareTar
 // the caller is responsible for emptying LoadProgress or
 // the process will lock up
 func (f *firmwareTarget) LoadFirmware(ctx context.Context, rateLimit rate.Limit) error {
-	r, w, err := os.Pipe()
-	if err != nil {
-		return fmt.Errorf("unable to create pipe: %w", err)
-	}
-
-	mp := multipart.NewWriter(w)
-	partWriter, err := mp.CreateFormFile("file", f.baseName)
-
-	if err != nil {
-		return fmt.Errorf("unable to create multipart body: %s", err)
-	}
-
 	progress := &progressWriter2{
 		channel: f.LoadProgress,
 		limiter: rate.NewLimiter(rateLimit, 1),
@@ -154,105 +155,35 @@ func (f *firmwareTarget) LoadFirmware(ctx context.Context, rateLimit rate.Limit)
 	}
 	progress.Initialize()
 
-	pWrite := io.MultiWriter(partWriter,
-		progress)
-
-	var eGroup errgroup.Group
-	eGroup.Go(func() error {
-		_, copyError := io.Copy(pWrite, f.fd)
-
-		// close multipart writer
-		mp.Close()
-
-		// close pipe
-		w.Close()
-
-		// close file
-		f.fd.Close()
-
-		if copyError != nil {
-			f.LoadProgress <- progressMsg{err: fmt.Sprintf("Failed: %s", copyError), ratio: 0.0}
-		} else {
-			f.LoadProgress <- progressMsg{status: "Successfully uploaded file", ratio: 1.0}
-		}
-
-		// close the progress writer
-		progress.Close()
-
-		return copyError
-	})
-
-	u := url.URL{
-		Scheme: "https",
-		Host:   f.Hostname,
-		Path:   "/bsp/firmware/file",
-	}
-
 	f.LoadProgress <- progressMsg{ratio: 0, status: "Connecting..."}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), r)
-	if err != nil {
-		return fmt.Errorf("unable to create http request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", mp.FormDataContentType())
+	err := bsp.New(f.Endpoint).UploadFirmware(ctx, f.baseName,
+		io.TeeReader(f.fd, progress), f.info.Size())
 
-	// We happen to know that the multipart writers various headers and stuff
-	// is usually 232 bytes long - given that the content-type and fieldname dosnt change
-	// - all we need is add the actual file size and size of the filename
-	// what could go wrong ? - off the top of my head, the only solid approach would
-	// be to send the request to /dev/null first and count the bytes - but lets see
-	// if we can get by using this constant...
-	req.ContentLength = 232 + f.info.Size() + int64(len(f.baseName))
+	// close file
+	f.fd.Close()
 
-	resp, err := f.Client.Do(req)
 	if err != nil {
-		return fmt.Errorf("unable to http post: %w", err)
+		f.LoadProgress <- progressMsg{err: fmt.Sprintf("Failed: %s", err), ratio: 0.0}
+	} else {
+		f.LoadProgress <- progressMsg{status: "Successfully uploaded file", ratio: 1.0}
 	}
-	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-	}
+	// close the progress writer
+	progress.Close()
 
-	err = eGroup.Wait()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return err
 }
 
 func (f *firmwareTarget) ApplyFirmware(ctx context.Context, rateLimit rate.Limit) error {
 	defer close(f.ApplyProgress)
 
-	u := url.URL{
-		Scheme: "https",
-		Host:   f.Hostname,
-		Path:   "/bsp/firmware/upgrade",
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "PUT", u.String(), nil)
+	c := bsp.New(f.Endpoint)
+	err := c.StartUpgrade(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to create http put request: %w", err)
-	}
-
-	resp, err := f.Client.Do(req)
-	if err != nil {
-		return fmt.Errorf("unable to call http endpoint: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("unexpected http status code: %d", resp.StatusCode)
+		return err
 	}
 
-	var state = struct {
-		Lines []struct {
-			Progress int
-			Text     string
-		}
-	}{}
-
 	for {
 		// wait here for interval or fail if our
 		// deadline is exceeded or the context is cancelled.
@@ -265,27 +196,9 @@ func (f *firmwareTarget) ApplyFirmware(ctx context.Context, rateLimit rate.Limit
 		case <-t.C:
 		}
 
-		// TODO: can this req togeather with its context be resued as is?
-		// - not that it will really matter a lot....
-		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
-		if err != nil {
-			return fmt.Errorf("unable to create http request: %w", err)
-		}
-
-		resp, err = f.Client.Do(req)
-		if err != nil {
-			f.ApplyProgress <- progressMsg{ratio: 0, status: fmt.Sprintf("ERROR: %s", err)}
-			continue
-		}
-		switch resp.StatusCode {
-		case http.StatusOK:
-		case http.StatusAccepted:
-
-		case http.StatusCreated:
-			resp.Body.Close()
-			f.ApplyProgress <- progressMsg{ratio: 1.0, status: "Successfully installed firmware."}
-			return nil
-
+		state, err := c.UpgradeStatus(ctx)
+		switch bsp.StatusCode(err) {
+		case 0:
 		case http.StatusNotFound:
 			f.ApplyProgress <- progressMsg{ratio: 0, err: "device answers: no firmware found"}
 			return fmt.Errorf("device answers: no firmware found")
@@ -295,28 +208,26 @@ func (f *firmwareTarget) ApplyFirmware(ctx context.Context, rateLimit rate.Limit
 			return fmt.Errorf("failed to install image: internal server error")
 
 		default:
-			err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
 			f.ApplyProgress <- progressMsg{ratio: 0, err: err.Error()}
 			return err
 		}
 
-		// StatusAccepted and StatusCreated have progress in their bodies
-		dec := json.NewDecoder(resp.Body)
-		err = dec.Decode(&state)
+		// the device is likely busy rebooting or we are unable to parse
+		// its progress message - either way, we should continue without
+		// stopping everything.
 		if err != nil {
-			// this is kind of a weird error state, the webserver said a successive
-			// statuscode, but we cannot figure out how to parse the progress message
-			// - so i think we should continue without stopping everything.
-			f.ApplyProgress <- progressMsg{ratio: 0, status: fmt.Sprintf("ERR: %s", err)}
-			resp.Body.Close()
+			f.ApplyProgress <- progressMsg{ratio: 0, status: fmt.Sprintf("ERROR: %s", err)}
 			continue
 		}
 
-		resp.Body.Close()
-
+		ratio, text := state.Progress()
 		f.ApplyProgress <- progressMsg{
-			ratio:  float64(state.Lines[0].Progress) / 100,
-			status: state.Lines[0].Text,
+			ratio:  ratio,
+			status: text,
+		}
+
+		if state.Done {
+			return nil
 		}
 	}
 }
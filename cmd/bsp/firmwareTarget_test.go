@@ -1,69 +1,163 @@
 package bsp
 
 import (
+	"bytes"
 	"context"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 
-	"github.com/deif/iectl/auth"
-	"github.com/deif/iectl/target"
+	"github.com/deif/iectl/bsp/bsptest"
 )
 
-// TODO: implement a mock webserver instead of using a real device....
-// these tests will fail unless a physical device is available on the following
-// hostname
-const HOSTNAME = "iE250-05eb2f.local"
+// firmwareFile writes a fake firmware bundle to a temporary directory
+func firmwareFile(t *testing.T) string {
+	t.Helper()
 
-func TestFirmware(t *testing.T) {
-	c, err := auth.Client(auth.WithInsecure, auth.WithCredentials(HOSTNAME, "admin", "admin"))
+	path := filepath.Join(t.TempDir(), "ie250-mp-pcm21-v2.0.10.0-tc1.raucb")
+	err := os.WriteFile(path, bytes.Repeat([]byte("rauc"), 1<<18), 0o600)
 	if err != nil {
-		t.Fatalf("cannot communicate: %s", err)
-
+		t.Fatalf("unable to write firmware: %s", err)
 	}
 
-	ft, err := newFirmwareTarget(
-		target.Endpoint{Hostname: HOSTNAME, Client: c},
-		"/home/fas/Downloads/ie250-mp-pcm21-v2.0.10.0-tc1.raucb",
-	)
+	return path
+}
+
+func newTestFirmwareTarget(t *testing.T, srv *bsptest.Server) *firmwareTarget {
+	t.Helper()
+
+	e, err := srv.Endpoint()
+	if err != nil {
+		t.Fatalf("cannot communicate: %s", err)
+	}
 
+	ft, err := newFirmwareTarget(e, firmwareFile(t))
 	if err != nil {
 		t.Fatalf("cannot newFirmwareTarget: %s", err)
 	}
 
+	return ft
+}
+
+// drain logs progress until the channel is closed
+func drain(t *testing.T, wg *sync.WaitGroup, name string, c chan progressMsg) {
+	wg.Add(1)
+	go func() {
+		for v := range c {
+			t.Logf("We have a %s: %+v", name, v)
+		}
+
+		t.Logf("%s closed", name)
+		wg.Done()
+	}()
+}
+
+func TestFirmware(t *testing.T) {
+	srv := newServer(t)
+	ft := newTestFirmwareTarget(t, srv)
+
 	if ft.baseName != "ie250-mp-pcm21-v2.0.10.0-tc1.raucb" {
 		t.Fatalf("Not correct name")
 	}
+
 	var sync sync.WaitGroup
 
-	sync.Add(1)
-	go func() {
-		for v := range ft.LoadProgress {
-			t.Logf("We have a loadprogress: %+v", v)
-		}
+	drain(t, &sync, "loadprogress", ft.LoadProgress)
+	err := ft.LoadFirmware(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("error to load firmware: %s", err)
+	}
 
-		t.Log("LoadProgress closed")
-		sync.Done()
-	}()
+	if srv.Firmware().Size != ft.info.Size() {
+		t.Fatalf("device received %d bytes, expected %d", srv.Firmware().Size, ft.info.Size())
+	}
+
+	drain(t, &sync, "applyprogress", ft.ApplyProgress)
+	err = ft.ApplyFirmware(context.Background(), 20)
+	if err != nil {
+		t.Fatalf("could not apply firmware: %s", err)
+	}
+
+	sync.Wait()
 
-	err = ft.LoadFirmware(context.Background(), 1)
+	if srv.Device().Software.B != "2.0.10.0-tc1" {
+		t.Fatalf("firmware was not installed: %+v", srv.Device().Software)
+	}
+}
+
+func TestFirmwareUploadFault(t *testing.T) {
+	srv := newServer(t)
+	srv.InjectFault(bsptest.Fault{Path: "/bsp/firmware/file", StatusCode: http.StatusInsufficientStorage})
+	ft := newTestFirmwareTarget(t, srv)
+
+	var sync sync.WaitGroup
+	drain(t, &sync, "loadprogress", ft.LoadProgress)
+
+	err := ft.LoadFirmware(context.Background(), 1)
+	if err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+
+	sync.Wait()
+}
+
+func TestFirmwareApplyFault(t *testing.T) {
+	srv := newServer(t)
+	ft := newTestFirmwareTarget(t, srv)
+
+	var sync sync.WaitGroup
+	drain(t, &sync, "loadprogress", ft.LoadProgress)
+	err := ft.LoadFirmware(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("error to load firmware: %s", err)
 	}
 
-	sync.Add(1)
-	go func() {
-		for v := range ft.ApplyProgress {
-			t.Logf("We have a applyprogress: %+v", v)
+	// the device goes away for a bit, and then fails the installation
+	srv.InjectFault(bsptest.Fault{Method: "GET", Path: "/bsp/firmware/upgrade", Drop: true, Times: 2})
+	srv.InjectFault(bsptest.Fault{Method: "GET", Path: "/bsp/firmware/upgrade", StatusCode: http.StatusInternalServerError})
+
+	drain(t, &sync, "applyprogress", ft.ApplyProgress)
+	err = ft.ApplyFirmware(context.Background(), 20)
+	if err == nil {
+		t.Fatalf("expected installation to fail")
+	}
+
+	sync.Wait()
+}
+
+func TestInstall(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{a, b}, "install", firmwareFile(t))
+	if err != nil {
+		t.Fatalf("install failed: %s", err)
+	}
+
+	for _, v := range []*bsptest.Server{a, b} {
+		if v.Device().Software.Active != "B" {
+			t.Fatalf("firmware was not installed: %+v", v.Device().Software)
 		}
+	}
+}
 
-		t.Log("ApplyProgress closed")
-		sync.Done()
-	}()
+func TestInstallJSON(t *testing.T) {
+	a, b := newServer(t), newServer(t)
 
-	err = ft.ApplyFirmware(context.Background(), 1)
+	out, err := execute(t, []*bsptest.Server{a, b}, "install", firmwareFile(t), "-o", "json")
 	if err != nil {
-		t.Fatalf("could not apply firmware: %s", err)
+		t.Fatalf("install failed: %s", err)
 	}
 
-	sync.Wait()
+	results := decode[map[string]any](t, out)
+	if len(results) != 2 {
+		t.Fatalf("expected a result per target, got:\n%s", out)
+	}
+
+	for i, v := range []*bsptest.Server{a, b} {
+		if results[i]["host"] != v.Host() || results[i]["result"] != "ok" {
+			t.Fatalf("unexpected result: %+v", results[i])
+		}
+	}
 }
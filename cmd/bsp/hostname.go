@@ -1,14 +1,14 @@
 package bsp
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
+	"sync"
 
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
 	"github.com/deif/iectl/target"
 	"github.com/spf13/cobra"
 )
@@ -28,35 +28,10 @@ var hostnameCmd = &cobra.Command{
 			return fmt.Errorf("multiple targets, cannot set hostname without --same-for-all")
 		}
 
-		for _, target := range targets {
-			u := url.URL{
-				Scheme: "https",
-				Host:   target.Hostname,
-				Path:   "/bsp/hostname",
-			}
-
-			reqStruct := struct {
-				Hostname string `json:"hostname"`
-			}{
-				Hostname: args[0],
-			}
-
-			body, err := json.Marshal(reqStruct)
-			if err != nil {
-				return fmt.Errorf("unable to marshal request body: %w", err)
-			}
-
-			resp, err := target.Client.Post(u.String(), "application/json", bytes.NewReader(body))
-			if err != nil {
-				return fmt.Errorf("unable to http post: %w", err)
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("unexpected http status code: %d", resp.StatusCode)
-			}
-		}
-		return nil
+		cmd.SilenceUsage = true
+		return fleet.FromContext(cmd.Context()).Run(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+			return bsp.New(t).SetHostname(ctx, args[0])
+		})
 	},
 }
 
@@ -65,47 +40,59 @@ func init() {
 	RootCmd.AddCommand(hostnameCmd)
 }
 
+// hostnameResult is the hostname of a single target
+type hostnameResult struct {
+	Host     string `json:"host"`
+	Hostname string `json:"hostname"`
+}
+
 func gethostnameStatus(cmd *cobra.Command, _ []string) error {
-	targets := target.FromContext(cmd.Context())
-	for _, target := range targets {
-		u := url.URL{
-			Scheme: "https",
-			Host:   target.Hostname,
-			Path:   "/bsp/hostname",
-		}
+	out, err := output.FromFlags(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	cmd.SilenceUsage = true
 
-		resp, err := target.Client.Get(u.String())
+	var (
+		mu        sync.Mutex
+		hostnames = make(map[string]string)
+	)
+
+	targets := target.FromContext(cmd.Context())
+	executed := fleet.FromContext(cmd.Context()).Execute(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+		hostname, err := bsp.New(t).Hostname(ctx)
 		if err != nil {
-			return fmt.Errorf("unable to http get: %w", err)
+			return err
 		}
-		defer resp.Body.Close()
 
-		switch resp.StatusCode {
-		case http.StatusOK:
-		default:
-			return fmt.Errorf("unexpected statuscode: %d", resp.StatusCode)
+		mu.Lock()
+		defer mu.Unlock()
+		hostnames[t.Hostname] = hostname
+		return nil
+	})
+
+	results := make([]hostnameResult, 0, len(targets))
+	for _, v := range executed {
+		hostname, ok := hostnames[v.Hostname]
+		if !ok {
+			continue
 		}
 
-		asJson, _ := cmd.Flags().GetBool("json")
-		if asJson {
-			_, err = io.Copy(os.Stdout, resp.Body)
-			if err != nil {
-				return fmt.Errorf("unable to copy to stdout: %w", err)
-			}
-			return nil
+		if !out.Structured() {
+			fmt.Printf("Current hostname: %s\n", hostname)
+			continue
 		}
 
-		dec := json.NewDecoder(resp.Body)
-		response := &struct {
-			Hostname string `json:"hostname"`
-		}{}
+		results = append(results, hostnameResult{v.Hostname, hostname})
+	}
 
-		err = dec.Decode(response)
+	if out.Structured() {
+		err = out.Print(results)
 		if err != nil {
-			return fmt.Errorf("unable to unmarshal response: %w", err)
+			return err
 		}
-
-		fmt.Printf("Current hostname: %s\n", response.Hostname)
 	}
-	return nil
+
+	return fleet.Failures(os.Stderr, executed)
 }
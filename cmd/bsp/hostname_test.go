@@ -0,0 +1,44 @@
+package bsp
+
+import (
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestHostname(t *testing.T) {
+	srv := newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{srv}, "hostname")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+	assertContains(t, out, "Current hostname: "+srv.Device().Hostname)
+
+	_, err = execute(t, []*bsptest.Server{srv}, "hostname", "rig3-a")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+
+	if srv.Device().Hostname != "rig3-a" {
+		t.Fatalf("hostname was not set: %s", srv.Device().Hostname)
+	}
+}
+
+func TestHostnameSameForAll(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{a, b}, "hostname", "rig3")
+	if err == nil {
+		t.Fatalf("expected refusal to set the same hostname on multiple targets")
+	}
+
+	_, err = execute(t, []*bsptest.Server{a, b}, "hostname", "rig3", "--same-for-all")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+
+	if a.Device().Hostname != "rig3" || b.Device().Hostname != "rig3" {
+		t.Fatalf("hostname was not set on all targets")
+	}
+}
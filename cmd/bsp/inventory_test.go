@@ -0,0 +1,105 @@
+package bsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	a, b, c := newServer(t), newServer(t), newServer(t)
+	b.Password = "secret"
+
+	d := a.Device()
+	d.Hostname = "rig3-genset1"
+	a.SetDevice(d)
+	d.Hostname = "rig3-genset2"
+	b.SetDevice(d)
+	d.Hostname = "lab"
+	c.SetDevice(d)
+
+	t.Setenv("IECTL_TEST_GENSET2", "secret")
+
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	inventory := fmt.Sprintf(`
+devices:
+  genset1:
+    address: %s
+    labels: {site: aarhus, rig: "3"}
+  genset2:
+    address: %s
+    credentials: env:IECTL_TEST_GENSET2
+    labels: {site: aarhus, rig: "3"}
+  lab:
+    address: %s
+    labels: {site: lab}
+groups:
+  rig3: [genset1, genset2]
+`, a.Host(), b.Host(), c.Host())
+
+	err := os.WriteFile(path, []byte(inventory), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write inventory: %s", err)
+	}
+
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--group", "rig3"}, []string{"rig3-genset1", "rig3-genset2"}},
+		{[]string{"--selector", "site=lab"}, []string{"lab"}},
+		{[]string{"--group", "rig3", "--selector", "site=lab"}, nil},
+		{[]string{"--target", "genset2"}, []string{"rig3-genset2"}},
+	}
+
+	for _, v := range cases {
+		args := append([]string{"hostname", "--inventory", path}, v.args...)
+		out, err := execute(t, nil, args...)
+		if v.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", strings.Join(v.args, " "))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", strings.Join(v.args, " "), err)
+			continue
+		}
+
+		for _, hostname := range v.expected {
+			assertContains(t, out, hostname)
+		}
+
+		if strings.Count(out, "Current hostname") != len(v.expected) {
+			t.Errorf("%s: expected %d hosts, got:\n%s", strings.Join(v.args, " "), len(v.expected), out)
+		}
+	}
+}
+
+func TestInventoryRequired(t *testing.T) {
+	_, err := execute(t, nil, "hostname", "--inventory", filepath.Join(t.TempDir(), "missing.yaml"), "--group", "rig3")
+	if err == nil {
+		t.Fatalf("expected an error without an inventory")
+	}
+}
+
+func TestTargetFlagsExclusive(t *testing.T) {
+	cases := [][]string{
+		{"--target", "genset1", "--group", "rig3"},
+		{"--target", "genset1", "--selector", "site=lab"},
+		{"--target", "genset1", "--target-scan", "127.0.0.1/32"},
+		{"--group", "rig3", "--target-all"},
+		{"--selector", "site=lab", "--target-any"},
+		{"--group", "rig3", "--target-scan", "127.0.0.1/32"},
+	}
+
+	for _, v := range cases {
+		_, err := execute(t, nil, append([]string{"hostname"}, v...)...)
+		if err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+			t.Errorf("%s: expected the flags to be rejected, got %v", strings.Join(v, " "), err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package bsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/inventory"
+	"github.com/deif/iectl/mdns"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// errNoPassword is returned for devices there is no password for, and
+// no session cached either - rather than trying an empty password.
+var errNoPassword = errors.New("no password, use --password or store one using 'iectl bsp credentials set'")
+
+// AddLoginFlags adds the flags telling how to log in to devices, they are
+// shared by the bsp commands and the commands outside bsp talking to devices.
+// password is the default of --password, empty for none.
+func AddLoginFlags(flags *pflag.FlagSet, password string) {
+	flags.StringP("username", "u", "admin", "specify username")
+	flags.StringP("password", "p", password, "specify password")
+	flags.String("token-cache", "", "file authentication tokens are kept in between runs, defaults to tokens.json in the iectl cache directory")
+	flags.Bool("no-token-cache", false, "always log in with username and password, and keep no tokens")
+	flags.String("credentials", "", "encrypted file per-device credentials are kept in, defaults to credentials in the iectl config directory")
+	flags.String("credentials-passphrase-command", "", "command printing the passphrase of the credentials file, e.g. 'pass show iectl'")
+}
+
+// Logins logs in to discovered devices the way bsp commands log in to their
+// targets: using cached tokens, stored credentials or --password.
+type Logins struct {
+	logins *logins
+	tls    *TLS
+	user   string
+}
+
+// LoginsFromFlags returns Logins configured by the flags of AddLoginFlags
+// and AddTLSFlags. Refused passwords are not asked for again, and the
+// credentials file is unlocked right away - before a tui takes over.
+func LoginsFromFlags(cmd *cobra.Command) (*Logins, error) {
+	l, err := loginsFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.public(cmd)
+}
+
+// public returns Logins sharing the credentials of l, but never
+// asking for passwords.
+func (l *logins) public(cmd *cobra.Command) (*Logins, error) {
+	// stored credentials are of no use, given --password
+	if !l.explicit {
+		err := l.secrets.unlock()
+		if err != nil {
+			return nil, fmt.Errorf("unable to unlock credentials: %w", err)
+		}
+	}
+
+	tlsConfig, err := TLSFromFlags(cmd.Flags())
+	if err != nil {
+		return nil, err
+	}
+
+	quiet := &logins{
+		cache:    l.cache,
+		password: l.password,
+		explicit: l.explicit,
+		secrets:  l.secrets,
+	}
+
+	user, _ := cmd.Flags().GetString("username")
+	return &Logins{logins: quiet, tls: tlsConfig, user: user}, nil
+}
+
+// TLS is the tls configuration devices are reached with
+func (l *Logins) TLS() *TLS {
+	return l.tls
+}
+
+// Client logs in to the device of t, giving up once ctx is done. The
+// client should be closed using auth.Close.
+func (l *Logins) Client(ctx context.Context, t mdns.Target, useIP bool) (*http.Client, error) {
+	device := discovered([]*mdns.Target{&t}, useIP)[0]
+	return l.logins.login(ctx, device, l.user, "", l.tls.Options(device.Address, ""))
+}
+
+// usable tells if there is anything to log in with: a password,
+// stored credentials or cached sessions.
+func (l *Logins) usable() (bool, error) {
+	if l.logins.password != "" || l.logins.secrets.store != nil {
+		return true, nil
+	}
+
+	if l.logins.cache == nil {
+		return false, nil
+	}
+
+	tokens, err := l.logins.cache.All()
+	if err != nil {
+		return false, err
+	}
+
+	return len(tokens) > 0, nil
+}
+
+// loginsFromFlags returns logins using the token cache and credentials
+// named by the flags of cmd, nobody is asked for passwords.
+func loginsFromFlags(cmd *cobra.Command) (*logins, error) {
+	cache, err := tokenCache(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	pass, _ := cmd.Flags().GetString("password")
+	return &logins{
+		cache:    cache,
+		password: pass,
+		explicit: cmd.Flags().Changed("password"),
+		secrets:  &secrets{cmd: cmd},
+	}, nil
+}
+
+// logins logs in to targets, asking for another password if the one
+// given is refused and there is someone to ask.
+type logins struct {
+	cache       *auth.TokenCache
+	interactive bool
+
+	// secrets are the stored credentials, used for targets without
+	// a password in the inventory - unless --password is given.
+	secrets  *secrets
+	explicit bool
+
+	// mu makes targets ask for passwords one at a time, password
+	// is the one used for targets without one in the inventory.
+	mu       sync.Mutex
+	password string
+}
+
+// lazy returns a client logging in to device once used, see login
+func (l *logins) lazy(device *inventory.Device, user, pass string, options []auth.Option) *http.Client {
+	return auth.Lazy(func() (*http.Client, error) {
+		return l.login(context.Background(), device, user, pass, options)
+	})
+}
+
+// login logs in to device, pass is the password from the inventory - if
+// empty the stored or shared one is used. ctx bounds logging in.
+func (l *logins) login(ctx context.Context, device *inventory.Device, user, pass string, options []auth.Option) (*http.Client, error) {
+	host := device.Address
+	shared := pass == ""
+
+	l.mu.Lock()
+	if shared && !l.explicit {
+		e, ok, err := l.secrets.lookup(device)
+		if err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+
+		if ok {
+			shared = false
+			pass = e.Password
+			if device.Username == "" && e.Username != "" {
+				user = e.Username
+			}
+		}
+	}
+
+	if shared {
+		pass = l.password
+	}
+	l.mu.Unlock()
+
+	// without a password or anyone to ask for one, a
+	// cached session is all we have
+	if pass == "" && !l.interactive {
+		cached, err := l.cached(host, user)
+		if err != nil {
+			return nil, err
+		}
+		if !cached {
+			return nil, errNoPassword
+		}
+	}
+
+	login := func(pass string) (*http.Client, error) {
+		opts := append(slices.Clone(options), auth.WithCachedCredentials(ctx, l.cache, host, user, pass))
+		return auth.Client(opts...)
+	}
+
+	c, err := login(pass)
+	if !errors.Is(err, auth.ErrInvalidCredentials) || !l.interactive {
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate: %w", err)
+		}
+		return c, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// someone else might have entered a better password while we waited
+	if shared && l.password != pass {
+		pass = l.password
+		c, err = login(pass)
+		if err == nil {
+			return c, nil
+		}
+	}
+
+	// If we have a terminal, and the error was invalid credentials
+	// try to fix the issue by asking for another password...
+	for {
+		fmt.Printf("Enter password for https://%s@%s: ", user, host)
+
+		p, err := readPassword()
+		if err != nil {
+			return nil, fmt.Errorf("unable to ask for password: %w", err)
+		}
+
+		pass = string(p)
+
+		fmt.Println()
+		c, err = login(pass)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate: %w", err)
+		}
+
+		// we might as well try this newly entered password
+		// on future targets aswell
+		if shared {
+			l.password = pass
+		}
+
+		return c, nil
+	}
+}
+
+// cached tells if there is a session cached for user at host
+func (l *logins) cached(host, user string) (bool, error) {
+	if l.cache == nil {
+		return false, nil
+	}
+
+	t, exists, err := l.cache.Get(host)
+	if err != nil {
+		return false, err
+	}
+
+	return exists && t.Username == user, nil
+}
+
+// tokenCache returns the cache named by --token-cache, or the default
+// one - nil if --no-token-cache is set.
+func tokenCache(cmd *cobra.Command) (*auth.TokenCache, error) {
+	disabled, _ := cmd.Flags().GetBool("no-token-cache")
+	if disabled {
+		return nil, nil
+	}
+
+	path, _ := cmd.Flags().GetString("token-cache")
+	if path != "" {
+		return auth.NewTokenCache(path), nil
+	}
+
+	path, err := auth.DefaultTokenCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewTokenCache(path), nil
+}
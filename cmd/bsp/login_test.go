@@ -0,0 +1,131 @@
+package bsp
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/mdns"
+	"github.com/spf13/cobra"
+)
+
+// loginsCmd returns a command with the flags of a command outside bsp
+// with a default password of password, parsed from args.
+func loginsCmd(t *testing.T, password string, args ...string) *cobra.Command {
+	t.Helper()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("interactive", false, "")
+	AddLoginFlags(cmd.Flags(), password)
+	AddTLSFlags(cmd.Flags())
+
+	err := cmd.Flags().Parse(args)
+	if err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+
+	return cmd
+}
+
+// newLogins returns Logins configured by args, not verifying certificates
+func newLogins(t *testing.T, password string, args ...string) *Logins {
+	t.Helper()
+
+	l, err := LoginsFromFlags(loginsCmd(t, password, append(args, "--insecure")...))
+	if err != nil {
+		t.Fatalf("unable to create logins: %s", err)
+	}
+
+	return l
+}
+
+// discoveredAs returns srv, as if it was discovered
+func discoveredAs(srv *bsptest.Server) mdns.Target {
+	addr := netip.MustParseAddrPort(srv.Host())
+	return mdns.Target{Hostname: addr.Addr().String(), Port: addr.Port()}
+}
+
+func TestLogins(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+	file := filepath.Join(t.TempDir(), "credentials")
+	cache := filepath.Join(t.TempDir(), "tokens.json")
+
+	srv := newServer(t)
+	srv.Password = "alpha"
+	setCredentials(t, file, srv.Host(), "alpha")
+
+	// the stored password wins over the default one
+	l := newLogins(t, "admin", "--credentials", file, "--token-cache", cache)
+	c, err := l.Client(context.Background(), discoveredAs(srv), false)
+	if err != nil {
+		t.Fatalf("expected stored credentials to be used, got %s", err)
+	}
+	auth.Close(c)
+
+	// without a password, the cached session is used
+	l = newLogins(t, "", "--token-cache", cache)
+	c, err = l.Client(context.Background(), discoveredAs(srv), false)
+	if err != nil {
+		t.Fatalf("expected the cached session to be used, got %s", err)
+	}
+	auth.Close(c)
+
+	if srv.Logins() != 1 {
+		t.Fatalf("expected a single login, got %d", srv.Logins())
+	}
+
+	// and without that, the device is left alone
+	l = newLogins(t, "", "--no-token-cache")
+	_, err = l.Client(context.Background(), discoveredAs(srv), false)
+	if !errors.Is(err, errNoPassword) || srv.Logins() != 1 {
+		t.Fatalf("expected no attempt to log in, got %v after %d logins", err, srv.Logins())
+	}
+
+	// logging in gives up along with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	l = newLogins(t, "alpha", "--no-token-cache")
+	_, err = l.Client(ctx, discoveredAs(srv), false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected logging in to be cancelled, got %v", err)
+	}
+}
+
+func TestStatusFromFlags(t *testing.T) {
+	srv := newServer(t)
+	known := filepath.Join(t.TempDir(), "known_hosts")
+
+	// looking at a device does not make it trusted
+	status := StatusFromFlags(loginsCmd(t, "admin", "--known-hosts", known, "--no-token-cache"), false)
+	_, err := status(context.Background(), discoveredAs(srv))
+	if err == nil || !strings.Contains(err.Error(), "untrusted") {
+		t.Fatalf("expected the device to be untrusted, got %v", err)
+	}
+
+	pins, err := auth.NewKnownHosts(known).All()
+	if err != nil || len(pins) != 0 || srv.Logins() != 0 {
+		t.Fatalf("expected no pins and no logins, got %v and %d logins: %v", pins, srv.Logins(), err)
+	}
+
+	_, err = execute(t, nil, "trust", "add", srv.Host(), "--known-hosts", known)
+	if err != nil {
+		t.Fatalf("unable to trust: %s", err)
+	}
+
+	d, err := status(context.Background(), discoveredAs(srv))
+	if err != nil || d.Hostname != "iE250-0bad0c" {
+		t.Fatalf("expected the status of a trusted device, got %+v: %v", d, err)
+	}
+
+	// nothing to log in with, nothing to show
+	status = StatusFromFlags(loginsCmd(t, "", "--no-token-cache"), false)
+	if status != nil {
+		t.Fatalf("expected no status without credentials")
+	}
+}
@@ -0,0 +1,125 @@
+package bsp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
+	"github.com/deif/iectl/target"
+	"github.com/spf13/cobra"
+)
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke and forget cached authentication tokens",
+	Long: `Revoke and forget cached authentication tokens
+
+Logging in to a device leaves iectl with tokens, which are cached so later
+runs can skip logging in again. logout revokes them on the devices, and
+removes them from the cache - from every device, or just those targeted
+using --target, --group, --selector, --target-any or --target-all.
+
+Tokens are removed from the cache even if the device could not be reached
+to revoke them.`,
+	Annotations: map[string]string{skipTargets: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printer, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		cache, err := tokenCache(cmd)
+		if err != nil {
+			return err
+		}
+		if cache == nil {
+			return fmt.Errorf("there are no cached tokens with --no-token-cache")
+		}
+
+		cached, err := cache.All()
+		if err != nil {
+			return err
+		}
+
+		hosts := slices.Sorted(maps.Keys(cached))
+
+		// without targets, everything is logged out of
+		targeted := slices.ContainsFunc([]string{"target", "group", "selector", "target-any", "target-all", "target-scan"}, cmd.Flags().Changed)
+		if targeted {
+			l, err := loginsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			devices, err := targetsFromFlags(cmd, l)
+			if err != nil {
+				return fmt.Errorf("could not get targets from flags: %w", err)
+			}
+
+			hosts = hosts[:0]
+			for _, d := range devices {
+				_, exists := cached[d.Address]
+				if exists {
+					hosts = append(hosts, d.Address)
+				}
+			}
+		}
+
+		cmd.SilenceUsage = true
+
+		if len(hosts) == 0 {
+			if !printer.Structured() {
+				fmt.Println("not logged in to any devices")
+				return nil
+			}
+			return printer.Print([]fleet.Result{})
+		}
+
+		tlsConfig, err := TLSFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		jumps, _ := cmd.Flags().GetStringSlice("ssh-proxyjump")
+		jumpOptions, err := proxyJumpOptions(cmd, jumps)
+		if err != nil {
+			return err
+		}
+
+		// the tokens are all we need, no logging in
+		targets := make(target.Collection, 0, len(hosts))
+		for _, host := range hosts {
+			c, err := auth.Client(append(tlsConfig.Options(host, ""), jumpOptions...)...)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target.Endpoint{Hostname: host, Client: c})
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		executor := &fleet.Executor{
+			Parallel:        parallel,
+			ContinueOnError: true,
+			Printer:         printer,
+		}
+
+		return executor.Run(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+			err := auth.Logout(ctx, t.Client, t.Hostname, cached[t.Hostname])
+
+			forgetErr := cache.Delete(t.Hostname)
+			if forgetErr != nil {
+				return forgetErr
+			}
+
+			return err
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,148 @@
+package bsp
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestTokenCache(t *testing.T) {
+	srv := newServer(t)
+	servers := []*bsptest.Server{srv}
+	cache := filepath.Join(t.TempDir(), "tokens.json")
+
+	for range 2 {
+		_, err := execute(t, servers, "status", "--token-cache", cache)
+		if err != nil {
+			t.Fatalf("status failed: %s", err)
+		}
+	}
+
+	if srv.Logins() != 1 {
+		t.Fatalf("expected the second run to reuse the tokens, got %d logins", srv.Logins())
+	}
+
+	fi, err := os.Stat(cache)
+	if err != nil {
+		t.Fatalf("unable to stat cache: %s", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected cache to be private, got %s", fi.Mode())
+	}
+
+	out, err := execute(t, servers, "logout", "--token-cache", cache)
+	if err != nil {
+		t.Fatalf("logout failed: %s", err)
+	}
+	assertContains(t, out, srv.Host())
+
+	p, err := os.ReadFile(cache)
+	if err != nil {
+		t.Fatalf("unable to read cache: %s", err)
+	}
+	if strings.Contains(string(p), srv.Host()) {
+		t.Fatalf("expected tokens to be forgotten, got %s", p)
+	}
+
+	// nothing left to reuse
+	_, err = execute(t, servers, "status", "--token-cache", cache)
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if srv.Logins() != 2 {
+		t.Fatalf("expected a new login after logout, got %d logins", srv.Logins())
+	}
+
+	_, err = execute(t, servers, "status", "--token-cache", cache, "--no-token-cache")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if srv.Logins() != 3 {
+		t.Fatalf("expected --no-token-cache to log in, got %d logins", srv.Logins())
+	}
+}
+
+func TestTokenCacheRevoked(t *testing.T) {
+	srv := newServer(t)
+	servers := []*bsptest.Server{srv}
+	cache := filepath.Join(t.TempDir(), "tokens.json")
+
+	_, err := execute(t, servers, "status", "--token-cache", cache)
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	// pretend the tokens belong to another device, like one that was
+	// factory reset - logging in with the password has to work.
+	fresh := newServer(t)
+	p, err := os.ReadFile(cache)
+	if err != nil {
+		t.Fatalf("unable to read cache: %s", err)
+	}
+	p = []byte(strings.ReplaceAll(string(p), srv.Host(), fresh.Host()))
+	err = os.WriteFile(cache, p, 0o600)
+	if err != nil {
+		t.Fatalf("unable to write cache: %s", err)
+	}
+
+	_, err = execute(t, []*bsptest.Server{fresh}, "status", "--token-cache", cache)
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if fresh.Logins() != 1 {
+		t.Fatalf("expected a login, got %d", fresh.Logins())
+	}
+}
+
+func TestTokenCachePermissions(t *testing.T) {
+	srv := newServer(t)
+	cache := filepath.Join(t.TempDir(), "tokens.json")
+
+	err := os.WriteFile(cache, []byte("{}"), 0o644)
+	if err != nil {
+		t.Fatalf("unable to write cache: %s", err)
+	}
+
+	_, err = execute(t, []*bsptest.Server{srv}, "status", "--token-cache", cache)
+	if !strings.Contains(failure(err), "accessible by others") {
+		t.Fatalf("expected a readable cache to be refused, got %v", err)
+	}
+}
+
+func TestLogoutTargetScan(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	cache := filepath.Join(t.TempDir(), "tokens.json")
+
+	_, err := execute(t, []*bsptest.Server{a, b}, "status", "--token-cache", cache)
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	// only the device found is logged out of
+	addr := netip.MustParseAddrPort(a.Host())
+	out, err := execute(t, nil, "logout", "--token-cache", cache,
+		"--target-scan", addr.Addr().String(), "--scan-port", strconv.Itoa(int(addr.Port())), "--target-all")
+	if err != nil {
+		t.Fatalf("logout failed: %s", err)
+	}
+	assertContains(t, out, a.Host())
+
+	p, err := os.ReadFile(cache)
+	if err != nil {
+		t.Fatalf("unable to read cache: %s", err)
+	}
+	if strings.Contains(string(p), a.Host()) || !strings.Contains(string(p), b.Host()) {
+		t.Fatalf("expected only the scanned device to be logged out of, got %s", p)
+	}
+
+	// scanning without picking anything is an error, not every device
+	_, err = execute(t, nil, "logout", "--token-cache", cache, "--target-scan", addr.Addr().String())
+	if err == nil {
+		t.Fatalf("expected an error without --target-any or --target-all")
+	}
+}
@@ -0,0 +1,126 @@
+package bsp
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/mdns"
+	"github.com/spf13/cobra"
+)
+
+var mockDeviceCmd = &cobra.Command{
+	Use:   "mock-device",
+	Short: "Run a fake controller locally",
+	Long: `Runs a local stand-in for a controller, serving the bsp rest api over https
+with a self-signed certificate and announcing itself over mDNS, so discover,
+browse and --target-all finds it like real hardware.
+
+The fake controller accepts the credentials given by --username and --password,
+and keeps its state in memory until it is stopped.
+
+Listening on port 443 usually requires elevated privileges, use --listen to
+pick another port - mDNS announces whatever port is used.
+
+Examples:
+
+  Run a fake controller on an unprivileged port:
+
+    iectl bsp mock-device --listen :8443
+
+  Point iectl at it:
+
+    iectl bsp status --insecure --target localhost:8443
+`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		skipTargets: "true",
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		hostname, _ := cmd.Flags().GetString("hostname")
+		upgradeDuration, _ := cmd.Flags().GetDuration("upgrade-duration")
+		noMDNS, _ := cmd.Flags().GetBool("no-mdns")
+		service, _ := cmd.Flags().GetString("service")
+
+		if hostname == "" {
+			suffix := make([]byte, 3)
+			rand.Read(suffix)
+			hostname = "iE250-" + hex.EncodeToString(suffix)
+		}
+
+		srv := bsptest.NewUnstartedServer()
+		srv.Username, _ = cmd.Flags().GetString("username")
+		srv.Password, _ = cmd.Flags().GetString("password")
+		srv.UpgradeDuration = upgradeDuration
+
+		d := srv.Device()
+		d.Hostname = hostname
+		srv.SetDevice(d)
+
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("unable to listen on %s: %w", listen, err)
+		}
+
+		srv.Listener.Close()
+		srv.Listener = l
+
+		cert, err := bsptest.SelfSignedCertificate(hostname+".local", hostname, "localhost", "127.0.0.1", "::1")
+		if err != nil {
+			return fmt.Errorf("unable to create certificate: %w", err)
+		}
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		cmd.SilenceUsage = true
+
+		srv.StartTLS()
+		defer srv.Close()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		port := l.Addr().(*net.TCPAddr).Port
+		fmt.Printf("Serving fake controller %s on https://%s\n", hostname, l.Addr())
+
+		if noMDNS {
+			<-ctx.Done()
+			return nil
+		}
+
+		fmt.Printf("Announcing %s.local:%d over mDNS\n", hostname, port)
+		responder := mdns.Responder{
+			Service:  service + "." + mdns.DefaultDomain,
+			Instance: hostname,
+			Hostname: hostname + ".local",
+			Port:     uint16(port),
+			Text: []string{
+				"model=iE250",
+				"serial=" + d.Serial,
+				"version=" + d.Software.ActiveVersion(),
+			},
+		}
+
+		err = responder.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to respond to mDNS: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	mockDeviceCmd.Flags().String("listen", ":443", "address to serve the bsp rest api on")
+	mockDeviceCmd.Flags().String("hostname", "", "hostname of the fake controller, random if empty")
+	mockDeviceCmd.Flags().Duration("upgrade-duration", 2*time.Minute, "time it takes to install firmware")
+	mockDeviceCmd.Flags().Bool("no-mdns", false, "do not announce the fake controller over mDNS")
+	RootCmd.AddCommand(mockDeviceCmd)
+}
@@ -0,0 +1,97 @@
+package bsp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+// decode unmarshals the json output of a command into a list of v
+func decode[T any](t *testing.T, out string) []T {
+	t.Helper()
+
+	var v []T
+	err := json.Unmarshal([]byte(out), &v)
+	if err != nil {
+		t.Fatalf("unable to decode output: %s\n%s", err, out)
+	}
+
+	return v
+}
+
+func TestHostnameJSON(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	d := b.Device()
+	d.Hostname = "rig3-b"
+	b.SetDevice(d)
+
+	out, err := execute(t, []*bsptest.Server{a, b}, "hostname", "--json")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+
+	results := decode[hostnameResult](t, out)
+	expected := []hostnameResult{{a.Host(), a.Device().Hostname}, {b.Host(), "rig3-b"}}
+	if len(results) != len(expected) {
+		t.Fatalf("expected a result per host, got %+v", results)
+	}
+
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("expected %+v, got %+v", expected[i], results[i])
+		}
+	}
+}
+
+func TestSSHKeyJSON(t *testing.T) {
+	srv := newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{srv}, "sshkey", "-o", "json")
+	if err != nil {
+		t.Fatalf("sshkey failed: %s", err)
+	}
+
+	results := decode[map[string]string](t, out)
+	if len(results) != 1 || results[0]["host"] != srv.Host() || results[0]["authorized_keys"] != "" {
+		t.Fatalf("expected no keys, got %+v", results)
+	}
+}
+
+func TestServiceJSON(t *testing.T) {
+	srv := newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{srv}, "service", "ssh", "status", "-o", "json")
+	if err != nil {
+		t.Fatalf("service failed: %s", err)
+	}
+
+	results := decode[map[string]any](t, out)
+	if len(results) != 1 || results[0]["service"] != "ssh" || results[0]["running"] != true {
+		t.Fatalf("unexpected result: %+v", results)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{a, b}, "restart", "-o", "json")
+	if err != nil {
+		t.Fatalf("restart failed: %s", err)
+	}
+
+	results := decode[map[string]any](t, out)
+	if len(results) != 2 || results[1]["host"] != b.Host() || results[1]["result"] != "ok" {
+		t.Fatalf("unexpected summary: %+v", results)
+	}
+}
+
+func TestUnknownOutput(t *testing.T) {
+	srv := newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{srv}, "status", "-o", "xml")
+	if err == nil {
+		t.Fatalf("expected unknown format to be refused")
+	}
+}
@@ -0,0 +1,79 @@
+package bsp
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/fleet"
+)
+
+func TestRestart(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	_, err := execute(t, []*bsptest.Server{a, b}, "restart", "--delay", "1500ms")
+	if err != nil {
+		t.Fatalf("restart failed: %s", err)
+	}
+
+	if a.Restarts() != 1 || b.Restarts() != 1 {
+		t.Fatalf("expected both targets to restart")
+	}
+}
+
+func TestRestartFault(t *testing.T) {
+	srv := newServer(t)
+	srv.InjectFault(bsptest.Fault{Method: "POST", Path: "/bsp/system/restart", StatusCode: http.StatusConflict})
+
+	_, err := execute(t, []*bsptest.Server{srv}, "reboot")
+	if bsp.StatusCode(err) != http.StatusConflict {
+		t.Fatalf("expected 409, got: %v", err)
+	}
+}
+
+func TestRestartPartialFailure(t *testing.T) {
+	a, b, c := newServer(t), newServer(t), newServer(t)
+	a.InjectFault(bsptest.Fault{Method: "POST", Path: "/bsp/system/restart", StatusCode: http.StatusConflict})
+
+	servers := []*bsptest.Server{a, b, c}
+
+	// without --continue-on-error, the targets after a are left alone
+	out, err := execute(t, servers, "restart", "--parallel", "1")
+	var fleetErr *fleet.Error
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 1 {
+		t.Fatalf("expected a fleet error with exit code 1, got %v", err)
+	}
+	assertContains(t, out, "skipped")
+	if b.Restarts() != 0 || c.Restarts() != 0 {
+		t.Fatalf("expected remaining targets to be skipped")
+	}
+
+	a.InjectFault(bsptest.Fault{Method: "POST", Path: "/bsp/system/restart", StatusCode: http.StatusConflict})
+	out, err = execute(t, servers, "restart", "--parallel", "1", "--continue-on-error")
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 2 {
+		t.Fatalf("expected a fleet error with exit code 2, got %v", err)
+	}
+	assertContains(t, out, "409")
+	if b.Restarts() != 1 || c.Restarts() != 1 {
+		t.Fatalf("expected remaining targets to restart")
+	}
+}
+
+func TestRestartUnreachable(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	a.Password = "something else"
+
+	// a target refusing to let us in does not stop the others
+	out, err := execute(t, []*bsptest.Server{a, b}, "restart", "--continue-on-error")
+	var fleetErr *fleet.Error
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 2 {
+		t.Fatalf("expected a fleet error with exit code 2, got %v", err)
+	}
+	assertContains(t, out, "invalid credentials")
+
+	if b.Restarts() != 1 {
+		t.Fatalf("expected the reachable target to restart")
+	}
+}
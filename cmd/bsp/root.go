@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,18 +13,26 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/cmd/bsp/debug"
 	"github.com/deif/iectl/cmd/bsp/service"
 	"github.com/deif/iectl/cmd/bsp/sshkey"
-	"github.com/deif/iectl/cmd/bsp/debug"
+	"github.com/deif/iectl/filter"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/inventory"
 	"github.com/deif/iectl/mdns"
+	"github.com/deif/iectl/output"
 	sshc "github.com/deif/iectl/ssh"
 	"github.com/deif/iectl/target"
 	"github.com/deif/iectl/tui"
-	"github.com/miekg/dns"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
 
+// skipTargets is a command annotation, commands annotated with it
+// do not operate on targets and should not trigger any discovery
+// or authentication.
+const skipTargets = "iectl/skip-targets"
+
 var RootCmd = &cobra.Command{
 	Use:   "bsp",
 	Short: "Collection of commands relating to the bsp rest api",
@@ -37,215 +46,412 @@ var RootCmd = &cobra.Command{
 			return err
 		}
 
-		targets, err := targetsFromFlags(cmd)
+		_, skip := cmd.Annotations[skipTargets]
+		if skip {
+			return nil
+		}
+
+		// fail early on broken expressions
+		var where filter.Expression
+		whereFlag, _ := cmd.Flags().GetString("where")
+		if whereFlag != "" {
+			where, err = filter.Parse(whereFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --where: %w", err)
+			}
+		}
+
+		printer, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		// targets log in once they are used, commands not talking
+		// to the targets never do.
+		l, err := loginsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		l.interactive, _ = cmd.Flags().GetBool("interactive")
+
+		targets, err := targetsFromFlags(cmd, l)
 		if err != nil {
 			return fmt.Errorf("could not get targets from flags: %w", err)
 		}
 
-		options := make([]auth.Option, 0)
-		insecure, _ := cmd.Flags().GetBool("insecure")
-		if insecure {
-			options = append(options, auth.WithInsecure)
+		tlsConfig, err := TLSFromFlags(cmd.Flags())
+		if err != nil {
+			return err
 		}
 
 		sshProxyJumps, _ := cmd.Flags().GetStringSlice("ssh-proxyjump")
-		sshProxyJumpInsecure, _ := cmd.Flags().GetBool("ssh-proxyjump-insecure")
+		flagUser, _ := cmd.Flags().GetString("username")
 
-		sshOpts := make([]sshc.Option, 0)
-		if sshProxyJumpInsecure {
-			sshOpts = append(sshOpts, sshc.WithInsecureIgnoreHostkey)
-		}
+		collection := target.Collection{}
+		for _, device := range targets {
+			// the inventory may know better than the flags
+			user, jumps := flagUser, sshProxyJumps
+			if device.Username != "" {
+				user = device.Username
+			}
 
-		sshProxyJumpIdentity, _ := cmd.Flags().GetString("ssh-proxyjump-identity")
-		if sshProxyJumpIdentity != "" {
-			opt, err := sshc.WithIdentityFile(sshProxyJumpIdentity)
+			pass, err := device.Password()
 			if err != nil {
-				return fmt.Errorf("unable to create ssh client config for proxyjump identity %s: %w", sshProxyJumpIdentity, err)
+				return err
+			}
+
+			if len(device.ProxyJump) > 0 {
+				jumps = device.ProxyJump
 			}
-			sshOpts = append(sshOpts, opt)
-		}
 
-		for _, v := range sshProxyJumps {
-			c, err := sshc.ClientConfig(sshOpts...)
+			jumpOptions, err := proxyJumpOptions(cmd, jumps)
 			if err != nil {
-				return fmt.Errorf("unable to create ssh client config for proxyjump %s: %w", v, err)
+				return err
 			}
-			opt, err := auth.WithSSHTunnel(v, c)
+
+			options := append(tlsConfig.Options(device.Address, device.ServerName), jumpOptions...)
+			collection = append(collection, target.Endpoint{
+				Hostname: device.Address,
+				Client:   l.lazy(device, user, pass, options),
+			})
+		}
+
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		if where != nil {
+			collection, err = filterTargets(cmd.Context(), collection, where, parallel)
 			if err != nil {
-				return fmt.Errorf("unable to create ssh tunnel for proxyjump %s: %w", v, err)
+				return err
 			}
-			options = append(options, opt)
 		}
 
-		user, _ := cmd.Flags().GetString("username")
-		pass, _ := cmd.Flags().GetString("password")
+		continueOnError, _ := cmd.Flags().GetBool("continue-on-error")
+		executor := &fleet.Executor{
+			Parallel:        parallel,
+			ContinueOnError: continueOnError,
+			Printer:         printer,
+		}
 
-		interactive, _ := cmd.Flags().GetBool("interactive")
+		ctx := fleet.NewContext(cmd.Context(), executor)
+		cmd.SetContext(target.NewContext(ctx, collection))
 
-		collection := target.Collection{}
-		for _, host := range targets {
-			opts := append(options, auth.WithCredentials(host, user, pass))
-			c, err := auth.Client(opts...)
-
-			// If we have a terminal, and the error was invalid credentials
-			// try to fix the issue by asking for another password...
-			if errors.Is(err, auth.ErrInvalidCredentials) && interactive {
-				for {
-					fmt.Printf("Enter password for https://%s@%s: ", user, host)
-
-					var p []byte
-					p, err = readPassword()
-					if err != nil {
-						return fmt.Errorf("unable to ask for password: %w", err)
-					}
-
-					// we might as well try this newly entered password
-					// on future targets aswell
-					pass = string(p)
-
-					fmt.Println()
-					opts := append(options, auth.WithCredentials(host, user, pass))
-					c, err = auth.Client(opts...)
-
-					if errors.Is(err, auth.ErrInvalidCredentials) {
-						continue
-					}
-					if err != nil {
-						return fmt.Errorf("unable to authenticate: %w", err)
-					}
-
-					break
-				}
-			}
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		target.FromContext(cmd.Context()).Close()
+	},
+}
 
-			if err != nil {
-				return fmt.Errorf("unable to authenticate: %w", err)
-			}
+// proxyJumpOptions returns options tunneling through the ssh jump hosts
+func proxyJumpOptions(cmd *cobra.Command, jumps []string) ([]auth.Option, error) {
+	if len(jumps) == 0 {
+		return nil, nil
+	}
 
-			collection = append(collection, target.Endpoint{Hostname: host, Client: c})
+	sshProxyJumpInsecure, _ := cmd.Flags().GetBool("ssh-proxyjump-insecure")
+
+	sshOpts := make([]sshc.Option, 0)
+	if sshProxyJumpInsecure {
+		sshOpts = append(sshOpts, sshc.WithInsecureIgnoreHostkey)
+	}
 
+	sshProxyJumpIdentity, _ := cmd.Flags().GetString("ssh-proxyjump-identity")
+	if sshProxyJumpIdentity != "" {
+		opt, err := sshc.WithIdentityFile(sshProxyJumpIdentity)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create ssh client config for proxyjump identity %s: %w", sshProxyJumpIdentity, err)
 		}
+		sshOpts = append(sshOpts, opt)
+	}
 
-		cmd.SetContext(target.NewContext(cmd.Context(), collection))
+	options := make([]auth.Option, 0, len(jumps))
+	for _, v := range jumps {
+		c, err := sshc.ClientConfig(sshOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create ssh client config for proxyjump %s: %w", v, err)
+		}
+		opt, err := auth.WithSSHTunnel(v, c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create ssh tunnel for proxyjump %s: %w", v, err)
+		}
+		options = append(options, opt)
+	}
 
-		return nil
-	},
+	return options, nil
+}
+
+// loadInventory reads the inventory named by --inventory, or the default
+// one. Not having a default inventory is fine, nil is returned.
+func loadInventory(cmd *cobra.Command) (*inventory.Inventory, error) {
+	path, _ := cmd.Flags().GetString("inventory")
+	if path != "" {
+		return inventory.Load(path)
+	}
+
+	path, err := inventory.DefaultPath()
+	if err != nil {
+		return nil, nil
+	}
+
+	inv, err := inventory.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return inv, err
+}
+
+// hosts turns plain addresses into inventory devices
+func hosts(addresses []string) []*inventory.Device {
+	devices := make([]*inventory.Device, 0, len(addresses))
+	for _, v := range addresses {
+		devices = append(devices, &inventory.Device{Name: v, Address: v})
+	}
+
+	return devices
 }
 
-func targetsFromFlags(cmd *cobra.Command) ([]string, error) {
-	// if targets where directly specified, use them
+// discovered turns discovered targets into inventory devices, named
+// by their hostname and reached at their address.
+func discovered(targets []*mdns.Target, useIP bool) []*inventory.Device {
+	devices := make([]*inventory.Device, 0, len(targets))
+	for _, t := range targets {
+		devices = append(devices, &inventory.Device{
+			Name:    t.Hostname,
+			Address: t.Address(useIP),
+			Serial:  t.Text["serial"],
+		})
+	}
+
+	return devices
+}
+
+func targetsFromFlags(cmd *cobra.Command, l *logins) ([]*inventory.Device, error) {
+	inv, err := loadInventory(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// if targets where directly specified, use them - they
+	// may be names from the inventory.
 	t, _ := cmd.Flags().GetStringSlice("target")
 	if len(t) != 0 {
-		return t, nil
+		devices := hosts(t)
+		for i, v := range t {
+			if inv == nil {
+				break
+			}
+
+			d, exists := inv.Device(v)
+			if exists {
+				devices[i] = d
+			}
+		}
+		return devices, nil
 	}
 
-	timeout, _ := cmd.Flags().GetDuration("target-timeout")
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	selector, _ := cmd.Flags().GetString("selector")
+	if len(groups) > 0 || selector != "" {
+		return inventoryTargets(inv, groups, selector)
+	}
+
+	networks, _ := cmd.Flags().GetStringSlice("target-scan")
+	interactive, _ := cmd.Flags().GetBool("interactive")
 	pickAny, _ := cmd.Flags().GetBool("target-any")
+	pickAll, _ := cmd.Flags().GetBool("target-all")
+	browse := interactive && !pickAny && !pickAll
+
+	// scanned devices tell their serial number once logged in to, the
+	// browser shows their status - the targets picked share the
+	// credentials unlocked for that.
+	var logins *Logins
+	if len(networks) > 0 || browse {
+		logins, err = l.public(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var status tui.StatusFunc
+	if len(networks) > 0 {
+		status = logins.status(true)
+	}
+
+	d, err := DiscovererFromFlags(cmd.Flags(), networks, status)
+	if err != nil {
+		return nil, err
+	}
+
+	// a scan ends by itself, unless told otherwise, it is allowed to finish
+	timeout, _ := cmd.Flags().GetDuration("target-timeout")
+	if len(networks) > 0 && !cmd.Flags().Changed("target-timeout") {
+		timeout = 0
+	}
+
+	useIP, _ := cmd.Flags().GetBool("target-use-ip")
 	if pickAny {
-		return firstTarget(timeout)
+		t, err := firstTarget(d, timeout, useIP)
+		return discovered(t, useIP), err
 	}
 
-	pickAll, _ := cmd.Flags().GetBool("target-all")
 	if pickAll {
-		return allTargets(timeout)
+		t, err := allTargets(d, timeout)
+		return discovered(t, useIP), err
 	}
 
 	// if we reached this far, there where no --target's specified
 	// and --target-any and target-all where both off. If we have an interactive
 	// terminal - let the user choose though the browser
-	interactive, _ := cmd.Flags().GetBool("interactive")
-	if interactive {
-		return browseTargets()
+	if browse {
+		t, err := browseTargets(d, logins.status(useIP))
+		return discovered(t, useIP), err
 	}
 
 	return nil, fmt.Errorf("no targets specified, and terminal is not interactive")
 }
 
-func firstTarget(timeout time.Duration) ([]string, error) {
-	q := dns.Question{Name: dns.Fqdn("_base-unit-deif._tcp.local"), Qtype: dns.TypePTR}
-	browser := mdns.Browser{Question: q}
+// inventoryTargets returns the devices of the groups, matching selector
+func inventoryTargets(inv *inventory.Inventory, groups []string, selector string) ([]*inventory.Device, error) {
+	if inv == nil {
+		return nil, fmt.Errorf("--group and --selector requires an inventory, see --inventory")
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	devices := inv.All()
+	if len(groups) > 0 {
+		var err error
+		devices, err = inv.Group(groups...)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	updates, err := browser.Run(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("unable to browse mdns: %w", err)
+	if selector != "" {
+		s, err := inventory.ParseSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		devices = s.Select(devices)
 	}
 
-	t, ok := <-updates
-	if !ok {
-		return nil, fmt.Errorf("found no targets within deadline")
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices in the inventory matches")
 	}
 
-	return []string{t[0].Hostname}, nil
+	return devices, nil
 }
 
-func allTargets(timeout time.Duration) ([]string, error) {
-	q := dns.Question{Name: dns.Fqdn("_base-unit-deif._tcp.local"), Qtype: dns.TypePTR}
-	browser := mdns.Browser{Question: q}
+func firstTarget(d Discoverer, timeout time.Duration, useIP bool) ([]*mdns.Target, error) {
+	ctx, cancel := withTimeout(timeout)
+	defer cancel()
+
+	events, err := d.Run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover targets: %w", err)
+	}
+
+	var lastErr error
+	for {
+		e, ok := <-events
+		if !ok {
+			return nil, noTargets(lastErr)
+		}
+
+		if e.Type == mdns.Error {
+			lastErr = e.Err
+			continue
+		}
+
+		if e.Type == mdns.Removed {
+			continue
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		// when connecting by ip, we have to wait for an address
+		if useIP && len(e.Target.IPv4)+len(e.Target.IPv6) == 0 {
+			continue
+		}
+
+		return []*mdns.Target{&e.Target}, nil
+	}
+}
+
+func allTargets(d Discoverer, timeout time.Duration) ([]*mdns.Target, error) {
+	ctx, cancel := withTimeout(timeout)
 	defer cancel()
 
-	updates, err := browser.Run(ctx)
+	events, err := d.Run(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to browse mdns: %w", err)
+		return nil, fmt.Errorf("unable to discover targets: %w", err)
 	}
 
-	// we are looking for the last update.
-	var found []*mdns.Target
+	// we are looking for the targets known after the last event.
+	var (
+		found   []*mdns.Target
+		lastErr error
+	)
 	for {
-		t, ok := <-updates
+		e, ok := <-events
 		if !ok {
 			break
 		}
-		found = t
+
+		if e.Type == mdns.Error {
+			lastErr = e.Err
+		}
+		found = e.Targets
 	}
 
 	if len(found) == 0 {
-		return nil, fmt.Errorf("found no targets within deadline")
+		return nil, noTargets(lastErr)
 	}
 
-	targets := make([]string, 0)
-	for _, v := range found {
-		targets = append(targets, v.Hostname)
+	return found, nil
+}
+
+// withTimeout is context.WithTimeout, where zero means no timeout
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
 	}
 
-	return targets, nil
+	return context.WithTimeout(context.Background(), timeout)
 }
 
-func browseTargets() ([]string, error) {
-	q := dns.Question{Name: dns.Fqdn("_base-unit-deif._tcp.local"), Qtype: dns.TypePTR}
+// noTargets explains why nothing was found, browsing errors are
+// likely the reason.
+func noTargets(err error) error {
+	if err != nil {
+		return fmt.Errorf("found no targets within deadline: %w", err)
+	}
 
-	browser := mdns.Browser{Question: q}
+	return fmt.Errorf("found no targets within deadline")
+}
 
-	var err error
-	updates, err := browser.Run(context.Background())
+func browseTargets(d Discoverer, status tui.StatusFunc) ([]*mdns.Target, error) {
+	events, err := d.Run(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("unable to browse mdns: %w", err)
+		return nil, fmt.Errorf("unable to discover targets: %w", err)
 	}
 
-	m := tui.BrowserModel(updates)
+	m := tui.BrowserModel(events, status)
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		return nil, fmt.Errorf("unable to run tui: %w", err)
 	}
 
-	targets := make([]string, 0)
-	for _, v := range m.Selected {
-		targets = append(targets, v.Hostname)
-	}
-
-	return targets, nil
+	return m.Selected, nil
 }
 
 func init() {
-	RootCmd.PersistentFlags().StringSliceP("target", "t", []string{}, "specify hostname(s) or address(es) to target(s)")
+	RootCmd.PersistentFlags().StringSliceP("target", "t", []string{}, "specify hostname(s), address(es) or inventory name(s) to target(s)")
+	RootCmd.PersistentFlags().String("inventory", "", "inventory file, defaults to inventory.yaml in the iectl config directory")
+	RootCmd.PersistentFlags().StringSlice("group", []string{}, "target every device of the inventory group(s)")
+	RootCmd.PersistentFlags().Int("parallel", 8, "number of targets operated on at once")
+	RootCmd.PersistentFlags().Bool("continue-on-error", false, "keep going with the remaining targets when one fails")
+	RootCmd.PersistentFlags().String("where", "", "only target devices whose status matches, e.g. 'software.active_version < 2.0.10'")
+	RootCmd.PersistentFlags().String("selector", "", "target inventory devices with matching labels, e.g. site=aarhus,rig=3")
 	RootCmd.PersistentFlags().Bool("target-any", false, "any target, first answer picked - for networks with exactly one controller")
 	RootCmd.PersistentFlags().Bool("target-all", false, "search for targets, operate on all found within timeout")
-	RootCmd.MarkFlagsMutuallyExclusive("target", "target-any", "target-all")
 
 	RootCmd.PersistentFlags().String("ssh-proxyjump-identity", "", "specify private key file for ssh-proxyjump authentication")
 	RootCmd.PersistentFlags().Bool("ssh-proxyjump-insecure", false, "skip host verification of ssh-proxyjump")
@@ -253,10 +459,19 @@ func init() {
 	RootCmd.MarkFlagsMutuallyExclusive("ssh-proxyjump", "target-any", "target-all")
 
 	RootCmd.PersistentFlags().Duration("target-timeout", time.Second, "timeout for --target-all and --target-any")
-
-	RootCmd.PersistentFlags().StringP("username", "u", "admin", "specify username")
-	RootCmd.PersistentFlags().StringP("password", "p", "admin", "specify username")
-	RootCmd.PersistentFlags().Bool("insecure", false, "do not verify connection certificates")
+	RootCmd.PersistentFlags().StringSlice("target-scan", []string{}, "probe network(s) in CIDR notation for targets instead of using mDNS, use with --target-any or --target-all")
+
+	// --group and --selector narrow down each other, --target-scan tells
+	// where --target-any and --target-all look - anything else is ambiguous
+	RootCmd.MarkFlagsMutuallyExclusive("target", "group", "target-any", "target-all")
+	RootCmd.MarkFlagsMutuallyExclusive("target", "selector", "target-any", "target-all")
+	RootCmd.MarkFlagsMutuallyExclusive("target", "group", "target-scan")
+	RootCmd.MarkFlagsMutuallyExclusive("target", "selector", "target-scan")
+	RootCmd.PersistentFlags().Bool("target-use-ip", false, "connect to discovered targets by ip address instead of hostname")
+	AddBrowserFlags(RootCmd.PersistentFlags())
+
+	AddLoginFlags(RootCmd.PersistentFlags(), "admin")
+	AddTLSFlags(RootCmd.PersistentFlags())
 	RootCmd.AddCommand(service.RootCmd)
 	RootCmd.AddCommand(sshkey.RootCmd)
 	RootCmd.AddCommand(debug.RootCmd)
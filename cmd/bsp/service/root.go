@@ -1,6 +1,13 @@
 package service
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
+	"github.com/deif/iectl/target"
 	"github.com/spf13/cobra"
 )
 
@@ -8,3 +15,63 @@ var RootCmd = &cobra.Command{
 	Use:   "service",
 	Short: "Collection of service commands",
 }
+
+// serviceRunE returns a RunE that gets the status of service s, or
+// enables/disables it depending on args.
+func serviceRunE(s bsp.Service, name string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		// no arguments? - receive service status
+		if len(args) == 0 || args[0] == "status" {
+			return getStatus(cmd, s, name)
+		}
+
+		enable := args[0] == "enable"
+
+		targets := target.FromContext(cmd.Context())
+		cmd.SilenceUsage = true
+		return fleet.FromContext(cmd.Context()).Run(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+			return bsp.New(t).SetServiceRunning(ctx, s, enable)
+		})
+	}
+}
+
+// status is whether a service runs on a single target
+type status struct {
+	Host    string `json:"host"`
+	Service string `json:"service"`
+	Running bool   `json:"running"`
+}
+
+func getStatus(cmd *cobra.Command, s bsp.Service, name string) error {
+	out, err := output.FromFlags(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	targets := target.FromContext(cmd.Context())
+	results := make([]status, 0, len(targets))
+	for _, t := range targets {
+		running, err := bsp.New(t).ServiceRunning(cmd.Context(), s)
+		if err != nil {
+			return err
+		}
+
+		if out.Structured() {
+			results = append(results, status{t.Hostname, string(s), running})
+			continue
+		}
+
+		if running {
+			fmt.Printf("%s: %s Service: enabled", t.Hostname, name)
+		} else {
+			fmt.Printf("%s: %s Service: disabled", t.Hostname, name)
+		}
+		fmt.Println()
+	}
+
+	if !out.Structured() {
+		return nil
+	}
+
+	return out.Print(results)
+}
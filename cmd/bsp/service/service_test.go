@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestSSH(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	err := bsptest.Execute(t, RootCmd, srv, "ssh", "disable")
+	if err != nil {
+		t.Fatalf("ssh disable failed: %s", err)
+	}
+
+	if srv.ServiceRunning(bsp.ServiceSSH) {
+		t.Fatalf("ssh should be disabled")
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv, "ssh", "status")
+	if err != nil {
+		t.Fatalf("ssh status failed: %s", err)
+	}
+}
+
+func TestRDP(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	err := bsptest.Execute(t, RootCmd, srv, "rdp", "enable")
+	if err != nil {
+		t.Fatalf("rdp enable failed: %s", err)
+	}
+
+	if !srv.ServiceRunning(bsp.ServiceRDP) {
+		t.Fatalf("rdp should be enabled")
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv, "rdp")
+	if err != nil {
+		t.Fatalf("rdp status failed: %s", err)
+	}
+}
+
+func TestServiceFault(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+	srv.InjectFault(bsptest.Fault{Method: "PUT", Path: "/bsp/service/*", StatusCode: http.StatusForbidden})
+
+	err := bsptest.Execute(t, RootCmd, srv, "rdp", "enable")
+	if bsp.StatusCode(err) != http.StatusForbidden {
+		t.Fatalf("expected 403, got: %v", err)
+	}
+}
+
+func TestInvalidArgs(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	err := bsptest.Execute(t, RootCmd, srv, "ssh", "restart")
+	if err == nil {
+		t.Fatalf("expected restart to be rejected")
+	}
+}
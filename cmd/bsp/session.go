@@ -26,7 +26,8 @@ var sessionCmd = &cobra.Command{
 	Short: "Manages session, targets and variables",
 	Long: `Manage sessions in various ways, the simplest being exporting IECTL_* environment variables.
 
-The exported values include IECTL_BSP_TARGET, IECTL_BSP_USERNAME, and IECTL_BSP_PASSWORD.
+The exported values include IECTL_BSP_TARGET and IECTL_BSP_USERNAME, but
+never passwords - keep those in the credentials file, see bsp credentials.
 
 If these values are set in the environment where iectl is executed,
 iectl can automatically determine the appropriate targets.
@@ -71,18 +72,11 @@ Examples:
 
 		writer := io.MultiWriter(fds...)
 
-		// TODO: we should properly support different passwords
-		//		 for different devices...
-		// TODO: at some point, we should properly store refresh tokens somewhere, and
-		//       and then throw away password.
 		fmt.Fprintf(writer, "export IECTL_BSP_TARGET=%q\n", strings.Join(t, ","))
 
 		user, _ := cmd.Flags().GetString("username")
 		fmt.Fprintf(writer, "export IECTL_BSP_USERNAME=%q\n", user)
 
-		password, _ := cmd.Flags().GetString("password")
-		fmt.Fprintf(writer, "export IECTL_BSP_PASSWORD=%q\n", password)
-
 		// close things that can be closed
 		for _, v := range fds {
 			closer, ok := v.(io.Closer)
@@ -0,0 +1,41 @@
+package bsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestSessionExport(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	file := filepath.Join(t.TempDir(), "session")
+
+	out, err := execute(t, []*bsptest.Server{a, b}, "session", "--export", "--export-to-file", file)
+	if err != nil {
+		t.Fatalf("session failed: %s", err)
+	}
+
+	assertContains(t, out, `export IECTL_BSP_TARGET="`+a.Host()+","+b.Host()+`"`)
+	assertContains(t, out, `export IECTL_BSP_USERNAME="admin"`)
+
+	if strings.Contains(out, "PASSWORD") {
+		t.Fatalf("expected no password to be exported:\n%s", out)
+	}
+
+	p, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read exported file: %s", err)
+	}
+
+	if string(p) != out {
+		t.Fatalf("exported file differs from stdout:\n%s", p)
+	}
+
+	// nothing is asked of the targets, so there is no need to log in
+	if a.Logins() != 0 || b.Logins() != 0 {
+		t.Fatalf("expected no logins, got %d and %d", a.Logins(), b.Logins())
+	}
+}
@@ -25,51 +25,60 @@ var ssh = &cobra.Command{
 	Use:   "ssh",
 	Short: "Open ssh sessions to one or many targets",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// TODO: work on targets - in this use-case they should
-		// not try to authenticate as we have no use for an authenticated http client
-		// - which gets annoying because we have to add --insecure
-		//   even though no insecure communication needs to happen
-		//
-		// possible solutions
-		//  * dont to the authentication before a target is acturally getting
-		// 	  used to do http
-		//  * maybe provide some sort of WithAuthentication option to FromContext
-		//  * maybe time will show a nicer solution...
+		// targets are only logged in to once used, which ssh never does
 		targets := target.FromContext(cmd.Context())
+		hosts := make([]string, 0, len(targets))
+		for _, t := range targets {
+			hosts = append(hosts, t.Hostname)
+		}
 
-		var (
-			executable string
-			eArgs      []string
-			err        error
-		)
+		return ExecSSH(user, hosts)
+	},
+}
 
-		// if more then one target, jump into tmux
-		if len(targets) > 1 {
-			executable, err = exec.LookPath("tmux")
-			if err != nil {
-				return fmt.Errorf("tmux not found: %w", err)
-			}
+// ExecSSH replaces iectl with an ssh session to each of hosts, as sshUser.
+// More than one host is shown using tmux.
+func ExecSSH(sshUser string, hosts []string) error {
+	c, err := SSHCommand(sshUser, hosts)
+	if err != nil {
+		return err
+	}
 
-			eArgs = tmuxCommandFromTargets(targets)
+	// replace current process with tmux
+	err = syscall.Exec(c.Path, c.Args, os.Environ())
+	if err != nil {
+		return fmt.Errorf("exec failed: %w", err)
+	}
 
-			// if we only have one host, just exec directly to ssh
-		} else {
-			executable, err = exec.LookPath("ssh")
-			if err != nil {
-				return fmt.Errorf("ssh not found: %w", err)
-			}
+	return nil
+}
 
-			eArgs = []string{"ssh", fmt.Sprintf("%s@%s", user, targets[0].Hostname)}
-		}
+// SSHCommand returns a command opening an ssh session to each of hosts,
+// as sshUser. More than one host is shown using tmux.
+func SSHCommand(sshUser string, hosts []string) (*exec.Cmd, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts to ssh to")
+	}
 
-		// replace current process with tmux
-		err = syscall.Exec(executable, eArgs, os.Environ())
+	// if more then one target, jump into tmux
+	if len(hosts) > 1 {
+		executable, err := exec.LookPath("tmux")
 		if err != nil {
-			return fmt.Errorf("exec failed: %w", err)
+			return nil, fmt.Errorf("tmux not found: %w", err)
 		}
 
-		return nil
-	},
+		args := tmuxCommandFromTargets(sshUser, hosts)
+		return &exec.Cmd{Path: executable, Args: args}, nil
+	}
+
+	// if we only have one host, just ssh directly
+	executable, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, fmt.Errorf("ssh not found: %w", err)
+	}
+
+	args := []string{"ssh", fmt.Sprintf("%s@%s", sshUser, hosts[0])}
+	return &exec.Cmd{Path: executable, Args: args}, nil
 }
 
 func init() {
@@ -88,7 +97,7 @@ func init() {
 	RootCmd.AddCommand(ssh)
 }
 
-func tmuxCommandFromTargets(targets target.Collection) []string {
+func tmuxCommandFromTargets(user string, hosts []string) []string {
 	// sessions should be unique enough that running multiple sessions
 	// does not collide
 	// we take a random number from 0 to MaxInt encoded as base36
@@ -106,13 +115,13 @@ func tmuxCommandFromTargets(targets target.Collection) []string {
 		"new-session", "-d", "-s", session,
 		// make the detached session big enough for a handful of pane's
 		"-x", "1200", "-y", "1200",
-		fmt.Sprintf(sshCmd, user, targets[0].Hostname),
+		fmt.Sprintf(sshCmd, user, hosts[0]),
 	}
 
-	for _, t := range targets[1:] {
+	for _, h := range hosts[1:] {
 		targs = append(targs,
 			";", "split-window", "-t", session,
-			fmt.Sprintf(sshCmd, user, t.Hostname),
+			fmt.Sprintf(sshCmd, user, h),
 		)
 	}
 
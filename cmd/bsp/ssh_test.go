@@ -0,0 +1,27 @@
+package bsp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTmuxCommandFromTargets(t *testing.T) {
+	hosts := []string{"iE250-0bad0c.local", "iE250-0bad0d.local"}
+
+	args := tmuxCommandFromTargets("root", hosts)
+	if args[0] != "tmux" {
+		t.Fatalf("first argument should be tmux, got %s", args[0])
+	}
+
+	joined := strings.Join(args, " ")
+	for _, v := range hosts {
+		if !strings.Contains(joined, "root@"+v) {
+			t.Fatalf("missing ssh to %s in %s", v, joined)
+		}
+	}
+
+	if !slices.Contains(args, "split-window") {
+		t.Fatalf("expected a split-window for the second target")
+	}
+}
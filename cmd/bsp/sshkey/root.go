@@ -1,13 +1,11 @@
 package sshkey
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"os"
 
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/output"
 	"github.com/deif/iectl/target"
 	"github.com/spf13/cobra"
 )
@@ -17,58 +15,50 @@ var RootCmd = &cobra.Command{
 	Short: "Get, set or remove ssh public key(s) for the root user",
 	Args:  cobra.MatchAll(cobra.NoArgs),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
 		targets := target.FromContext(cmd.Context())
-		for _, target := range targets {
-			u := url.URL{
-				Scheme: "https",
-				Host:   target.Hostname,
-				Path:   "/bsp/keys/ssh",
+		results := make([]result, 0, len(targets))
+		for _, t := range targets {
+			keys, err := bsp.New(t).SSHKeys(cmd.Context())
+			if bsp.StatusCode(err) == http.StatusNotFound {
+				// not having keys is not an error, just empty
+				err = nil
 			}
-
-			resp, err := target.Client.Get(u.String())
 			if err != nil {
-				return fmt.Errorf("%s: unable to http post: %w", target.Hostname, err)
+				return err
 			}
-			defer resp.Body.Close()
 
-			asJson, _ := cmd.Flags().GetBool("json")
-
-			switch resp.StatusCode {
-			case http.StatusOK:
-			case http.StatusNotFound:
-				if asJson {
-					fmt.Printf("\"%s %s\"\n", target.Hostname, "has no authorized_key.")
-					continue
-				}
-				fmt.Println(target.Hostname, "has no authorized_key.")
+			if out.Structured() {
+				results = append(results, result{t.Hostname, keys})
 				continue
-			default:
-				return fmt.Errorf("%s: unexpected statuscode: %d", target.Hostname, resp.StatusCode)
 			}
 
-			if asJson {
-				_, err := io.Copy(os.Stdout, resp.Body)
-				if err != nil {
-					return err
-				}
+			if keys == "" {
+				fmt.Println(t.Hostname, "has no authorized_key.")
 				continue
 			}
 
-			wrap := struct {
-				Certificate string `json:"certificate"`
-			}{}
-
-			dec := json.NewDecoder(resp.Body)
-			err = dec.Decode(&wrap)
-			if err != nil {
-				return fmt.Errorf("%s: unable to unmarshal json: %w", target.Hostname, err)
-			}
+			fmt.Print(keys)
+		}
 
-			fmt.Print(wrap.Certificate)
+		if !out.Structured() {
+			return nil
 		}
-		return nil
+
+		return out.Print(results)
 	},
 }
 
+// result holds the authorized keys of a single target,
+// empty if the target has none.
+type result struct {
+	Host string `json:"host"`
+	Keys string `json:"authorized_keys"`
+}
+
 func init() {
 }
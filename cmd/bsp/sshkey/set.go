@@ -1,14 +1,14 @@
 package sshkey
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
 
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/fleet"
 	"github.com/deif/iectl/target"
 	"github.com/spf13/cobra"
 )
@@ -36,41 +36,15 @@ var setCmd = &cobra.Command{
 			}
 		}
 
-		payload := struct {
-			Certificate string `json:"certificate"`
-		}{
-			Certificate: keymaterial.String(),
-		}
-
-		jsonPayload, err := json.Marshal(payload)
-		if err != nil {
-			return fmt.Errorf("unable to marshal json payload: %w", err)
-		}
-
 		targets := target.FromContext(cmd.Context())
-		for _, target := range targets {
-			u := url.URL{
-				Scheme: "https",
-				Host:   target.Hostname,
-				Path:   "/bsp/keys/ssh",
-			}
-
-			resp, err := target.Client.Post(u.String(), "application/json", bytes.NewReader(jsonPayload))
-			if err != nil {
-				return fmt.Errorf("%s: unable to http post: %w", target.Hostname, err)
+		cmd.SilenceUsage = true
+		return fleet.FromContext(cmd.Context()).Run(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+			err := bsp.New(t).SetSSHKeys(ctx, keymaterial.String())
+			if bsp.StatusCode(err) == http.StatusBadRequest {
+				return fmt.Errorf("%s: bad SSH key, server responded with 400 Bad Request: %w", t.Hostname, err)
 			}
-			defer resp.Body.Close()
-
-			switch resp.StatusCode {
-			case http.StatusOK:
-			case http.StatusAccepted:
-			case http.StatusBadRequest:
-				return fmt.Errorf("%s: bad SSH key, server responded with 400 Bad Request", target.Hostname)
-			default:
-				return fmt.Errorf("%s: unexpected statuscode: %d", target.Hostname, resp.StatusCode)
-			}
-		}
-		return nil
+			return err
+		})
 	},
 }
 
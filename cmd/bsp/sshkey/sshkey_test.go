@@ -0,0 +1,73 @@
+package sshkey
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+const publicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDkP test@iectl"
+
+func keyFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write key: %s", err)
+	}
+
+	return path
+}
+
+func TestSSHKey(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	// no keys is not an error
+	err := bsptest.Execute(t, RootCmd, srv)
+	if err != nil {
+		t.Fatalf("sshkey failed: %s", err)
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv, "set", keyFile(t, publicKey))
+	if err != nil {
+		t.Fatalf("sshkey set failed: %s", err)
+	}
+
+	// a trailing newline should have been added
+	if srv.SSHKeys() != publicKey+"\n" {
+		t.Fatalf("unexpected keys on device: %q", srv.SSHKeys())
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv)
+	if err != nil {
+		t.Fatalf("sshkey failed: %s", err)
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv, "remove")
+	if err != nil {
+		t.Fatalf("sshkey remove failed: %s", err)
+	}
+
+	if srv.SSHKeys() != "" {
+		t.Fatalf("keys were not removed")
+	}
+}
+
+func TestSSHKeySetInvalid(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	err := bsptest.Execute(t, RootCmd, srv, "set", keyFile(t, "not a key"))
+	if err == nil {
+		t.Fatalf("expected bad key to be rejected")
+	}
+
+	err = bsptest.Execute(t, RootCmd, srv, "set", keyFile(t, ""))
+	if err == nil {
+		t.Fatalf("expected empty key file to be rejected")
+	}
+}
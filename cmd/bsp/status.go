@@ -1,14 +1,15 @@
 package bsp
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/fleet"
+	"github.com/deif/iectl/output"
 	"github.com/deif/iectl/target"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -29,93 +30,121 @@ Examples:
   Query firmware versions of a network of DEIF controllers, with jq:
   
     iectl bsp status --target-all \
-      --json | jq ".hostname,.software"
+      --output ndjson | jq ".hostname,.software"
+
+  Or without:
+
+    iectl bsp status --target-all \
+      --template '{{.host}} {{.software.active}}'
+
+  Overview of a fleet, a row per controller, fullest disks first:
+
+    iectl bsp status --group rig3 \
+      --table --sort=-rootfs
+
+  --table can be combined with --output, e.g. to get the same columns as csv.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		targets := target.FromContext(cmd.Context())
-		for _, target := range targets {
-			u := url.URL{
-				Scheme: "https",
-				Host:   target.Hostname,
-				Path:   "/bsp/system/status",
-			}
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		// picking columns or sorting only makes sense for tables
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		sortBy, _ := cmd.Flags().GetString("sort")
+		table, _ := cmd.Flags().GetBool("table")
+		table = table || len(columns) > 0 || sortBy != ""
+
+		// no need to ask anyone about status, if we cant show it
+		_, err = statusTable(nil, columns, sortBy)
+		if err != nil {
+			return err
+		}
+
+		cmd.SilenceUsage = true
 
-			resp, err := target.Client.Get(u.String())
+		var (
+			mu      sync.Mutex
+			devices = make(map[string]*bsp.Device)
+		)
+
+		targets := target.FromContext(cmd.Context())
+		executed := fleet.FromContext(cmd.Context()).Execute(cmd.Context(), targets, func(ctx context.Context, t target.Endpoint) error {
+			d, err := bsp.New(t).Status(ctx)
 			if err != nil {
-				return fmt.Errorf("unable to http get: %w", err)
+				return err
 			}
-			defer resp.Body.Close()
 
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("unexpected statuscode: %d", resp.StatusCode)
+			mu.Lock()
+			defer mu.Unlock()
+			devices[t.Hostname] = d
+			return nil
+		})
+
+		// targets that failed are told about on stderr, keeping
+		// stdout for the ones that did not.
+		results := make([]statusResult, 0, len(targets))
+		for _, v := range executed {
+			d, ok := devices[v.Hostname]
+			if !ok {
+				continue
 			}
 
-			asJson, _ := cmd.Flags().GetBool("json")
-			if asJson {
-				_, err = io.Copy(os.Stdout, resp.Body)
-				if err != nil {
-					return fmt.Errorf("unable to copy to stdout: %w", err)
-				}
+			if !out.Structured() && !table {
+				printDeviceInfo(d)
 				continue
 			}
 
-			dec := json.NewDecoder(resp.Body)
-			d := &Device{}
-			err = dec.Decode(d)
-			if err != nil {
-				return fmt.Errorf("unable to unmarshal status message: %w", err)
-			}
+			results = append(results, statusResult{Host: v.Hostname, Device: d})
+		}
 
-			printDeviceInfo(d)
+		err = printStatus(out, results, table, columns, sortBy)
+		if err != nil {
+			return err
 		}
 
-		return nil
+		return fleet.Failures(os.Stderr, executed)
 	},
 }
 
-type Interface struct {
-	Description string `json:"description"`
-	Ifname      string `json:"ifname"`
-	Kind        string `json:"kind"`
-	Status      struct {
-		LinkState  string `json:"link_state"`
-		MacAddress string `json:"mac_address"`
-		IPv4       *struct {
-			IP           string `json:"ip"`
-			PrefixLength int    `json:"prefix_length"`
-		} `json:"ipv4,omitempty"`
-		IPv6 *struct {
-			IP           string `json:"ip"`
-			PrefixLength int    `json:"prefix_length"`
-		} `json:"ipv6,omitempty"`
-	} `json:"status"`
-}
+// printStatus prints results, as --table or --output tells
+func printStatus(out *output.Printer, results []statusResult, table bool, columns []string, sortBy string) error {
+	if !table {
+		if !out.Structured() {
+			return nil
+		}
+		return out.Print(results)
+	}
 
-type MountPoint struct {
-	MountPoint string `json:"mountPoint"`
-	Size       uint64 `json:"size"`
-	Used       uint64 `json:"used"`
-}
+	rows, err := statusTable(results, columns, sortBy)
+	if err != nil {
+		return err
+	}
+
+	if out.Structured() {
+		return out.Print(rows)
+	}
 
-type Software struct {
-	A      string `json:"A"`
-	B      string `json:"B"`
-	Active string `json:"active"`
+	return printStatusTable(rows)
 }
 
-type Device struct {
-	Hostname    string       `json:"hostname"`
-	Interfaces  []Interface  `json:"interfaces"`
-	Mountpoints []MountPoint `json:"mountpoints"`
-	Serial      string       `json:"serialnumber"`
-	Software    Software     `json:"software"`
+// statusResult is the status of a single target, host is the
+// address used to reach it.
+type statusResult struct {
+	Host string `json:"host"`
+	*bsp.Device
 }
 
 func init() {
+	statusCmd.Long += "\nColumns of --table:\n\n" + statusColumnsHelp()
+	statusCmd.Flags().Bool("table", false, "a row per target with the most important status")
+	statusCmd.Flags().StringSlice("columns", nil, "columns of --table, in order (default "+strings.Join(defaultStatusColumns, ",")+")")
+	statusCmd.Flags().String("sort", "", "sort --table by a column, prefix with - for descending order e.g. --sort=-rootfs")
 	RootCmd.AddCommand(statusCmd)
 }
 
-func printDeviceInfo(d *Device) {
+func printDeviceInfo(d *bsp.Device) {
 	fmt.Println("========================")
 	fmt.Printf("Device Hostname: %s\n", d.Hostname)
 	fmt.Printf("Serial Number: %s\n", d.Serial)
@@ -0,0 +1,197 @@
+package bsp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/fleet"
+)
+
+func TestStatus(t *testing.T) {
+	srv := newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{srv}, "status")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	d := srv.Device()
+	assertContains(t, out, "Serial Number: "+d.Serial)
+	assertContains(t, out, "Active Version: A ("+d.Software.A+")")
+}
+
+func TestStatusPartialFailure(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	b.InjectFault(bsptest.Fault{Path: "/bsp/system/status", StatusCode: http.StatusInternalServerError})
+	b.InjectFault(bsptest.Fault{Path: "/bsp/hostname", StatusCode: http.StatusInternalServerError})
+
+	// the targets answering are shown, no matter where the other one is
+	for _, order := range [][]*bsptest.Server{{a, b}, {b, a}} {
+		for _, args := range [][]string{{"status"}, {"hostname"}} {
+			out, err := execute(t, order, append(args, "--continue-on-error")...)
+
+			var fleetErr *fleet.Error
+			if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 2 {
+				t.Fatalf("%s: expected partial failure, got %v", args[0], err)
+			}
+
+			if strings.Count(out, a.Device().Hostname) != 1 || !strings.Contains(failure(err), "500") {
+				t.Fatalf("%s: expected the answer of a and the error of b, got %v:\n%s", args[0], err, out)
+			}
+		}
+	}
+
+	_, err := execute(t, []*bsptest.Server{b}, "status")
+
+	var fleetErr *fleet.Error
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 1 {
+		t.Fatalf("expected complete failure, got %v", err)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	out, err := execute(t, []*bsptest.Server{a, b}, "status", "--json")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	// a single document, with a status per host
+	var results []struct {
+		Host string `json:"host"`
+		bsp.Device
+	}
+	err = json.Unmarshal([]byte(out), &results)
+	if err != nil {
+		t.Fatalf("unable to decode status: %s\n%s", err, out)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected two results, got %d", len(results))
+	}
+
+	for i, srv := range []*bsptest.Server{a, b} {
+		if results[i].Host != srv.Host() {
+			t.Fatalf("expected host %s, got %s", srv.Host(), results[i].Host)
+		}
+
+		if results[i].Serial != srv.Device().Serial {
+			t.Fatalf("unexpected serial: %s", results[i].Serial)
+		}
+	}
+}
+
+func TestStatusOutput(t *testing.T) {
+	srv := newServer(t)
+	d := srv.Device()
+
+	out, err := execute(t, []*bsptest.Server{srv}, "status", "-o", "csv")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	assertContains(t, out, "host,hostname,interfaces.0.description,interfaces.0.ifname")
+	assertContains(t, out, srv.Host()+","+d.Hostname+",")
+
+	out, err = execute(t, []*bsptest.Server{srv}, "status", "-o", "yaml")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	assertContains(t, out, "- host: "+srv.Host())
+	assertContains(t, out, "  serialnumber: \""+d.Serial+"\"")
+
+	out, err = execute(t, []*bsptest.Server{srv}, "status", "--template", "{{.host}} {{.software.active}}")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+	if out != srv.Host()+" A\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestStatusFault(t *testing.T) {
+	srv := newServer(t)
+	srv.InjectFault(bsptest.Fault{Path: "/bsp/system/status", StatusCode: http.StatusInternalServerError})
+
+	_, err := execute(t, []*bsptest.Server{srv}, "status")
+	if bsp.StatusCode(err) != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got: %v", err)
+	}
+}
+
+func TestStatusTable(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+
+	d := b.Device()
+	d.Hostname = "rig3-b"
+	d.Serial = "2300000002"
+	d.Software.Active = "B"
+	d.Software.B = "2.0.10.0"
+	d.Mountpoints[0].Used = d.Mountpoints[0].Size / 2
+	b.SetDevice(d)
+
+	servers := []*bsptest.Server{a, b}
+
+	out, err := execute(t, servers, "status", "--table")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and a row per target, got:\n%s", out)
+	}
+	if strings.Join(strings.Fields(lines[0]), " ") != "HOSTNAME SERIAL ACTIVE OTHER IPV4 LINK ROOTFS" {
+		t.Fatalf("unexpected header: %s", lines[0])
+	}
+	if strings.Join(strings.Fields(lines[2]), " ") != "rig3-b 2300000002 B (2.0.10.0) 2.0.9.0 192.168.2.21 up 50.0%" {
+		t.Fatalf("unexpected row: %s", lines[2])
+	}
+
+	// newest version first, only the columns asked for
+	out, err = execute(t, servers, "status", "--columns", "serial,rootfs", "--sort=-active", "-o", "csv")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	expected := "serial,rootfs\n2300000002,50\n" + a.Device().Serial + ",25\n"
+	if out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	_, err = execute(t, servers, "status", "--columns", "hostname,uptime")
+	if err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Fatalf("expected unknown column to be refused, got %v", err)
+	}
+}
+
+func TestStatusTargetScan(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+	file := filepath.Join(t.TempDir(), "credentials")
+
+	srv := newServer(t)
+	srv.Password = "alpha"
+	setCredentials(t, file, "127.0.0.1:*", "alpha")
+
+	addr := netip.MustParseAddrPort(srv.Host())
+	out, err := execute(t, nil, "status", "--target-scan", addr.Addr().String(), "--scan-port", strconv.Itoa(int(addr.Port())),
+		"--target-all", "--credentials", file, "--no-token-cache")
+	if err != nil {
+		t.Fatalf("status failed: %s", err)
+	}
+
+	assertContains(t, out, "Serial Number: "+srv.Device().Serial)
+
+	// one login for the details of the scan, and one for status
+	if srv.Logins() != 2 {
+		t.Fatalf("expected the stored credentials to be used twice, got %d logins", srv.Logins())
+	}
+}
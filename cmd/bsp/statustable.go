@@ -0,0 +1,211 @@
+package bsp
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/deif/iectl/filter"
+	"github.com/deif/iectl/output"
+)
+
+// statusColumn is a column of bsp status --table, value returns
+// nil if the device does not have whatever the column shows.
+type statusColumn struct {
+	name        string
+	description string
+	value       func(r statusResult) any
+
+	// key is what is sorted by, value if nil
+	key func(r statusResult) any
+}
+
+func (c statusColumn) sortKey(r statusResult) any {
+	if c.key != nil {
+		return c.key(r)
+	}
+	return c.value(r)
+}
+
+var statusColumns = []statusColumn{
+	{"host", "address used to reach the device", func(r statusResult) any {
+		return r.Host
+	}, nil},
+	{"hostname", "hostname of the device", func(r statusResult) any {
+		return r.Hostname
+	}, nil},
+	{"serial", "serial number", func(r statusResult) any {
+		return r.Serial
+	}, nil},
+	{"active", "active software slot and its version", func(r statusResult) any {
+		return fmt.Sprintf("%s (%s)", r.Software.Active, r.Software.ActiveVersion())
+	}, func(r statusResult) any {
+		return r.Software.ActiveVersion()
+	}},
+	{"other", "version in the other software slot", func(r statusResult) any {
+		return r.Software.InactiveVersion()
+	}, nil},
+	{"ipv4", "IPv4 address of the primary interface", func(r statusResult) any {
+		iface, ok := r.PrimaryInterface()
+		if !ok || iface.Status.IPv4 == nil {
+			return nil
+		}
+		return iface.Status.IPv4.IP
+	}, nil},
+	{"link", "link state of the primary interface", func(r statusResult) any {
+		iface, ok := r.PrimaryInterface()
+		if !ok {
+			return nil
+		}
+		return iface.Status.LinkState
+	}, nil},
+	{"rootfs", "root filesystem usage in percent", func(r statusResult) any {
+		mp, ok := r.Mountpoint("/")
+		if !ok {
+			return nil
+		}
+		// a single decimal is plenty
+		return math.Round(mp.Usage()*10) / 10
+	}, nil},
+}
+
+// defaultStatusColumns leaves out host, which is usually the same as hostname
+var defaultStatusColumns = []string{"hostname", "serial", "active", "other", "ipv4", "link", "rootfs"}
+
+func statusColumnNames() string {
+	names := make([]string, 0, len(statusColumns))
+	for _, c := range statusColumns {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func findStatusColumn(name string) (statusColumn, error) {
+	for _, c := range statusColumns {
+		if strings.EqualFold(c.name, name) {
+			return c, nil
+		}
+	}
+	return statusColumn{}, fmt.Errorf("unknown column %q, use one of %s", name, statusColumnNames())
+}
+
+// statusTable turns results into rows of columns, sorted by the column
+// named by sortBy - prefixed with - for descending order.
+func statusTable(results []statusResult, names []string, sortBy string) ([]output.Row, error) {
+	if len(names) == 0 {
+		names = defaultStatusColumns
+	}
+
+	columns := make([]statusColumn, 0, len(names))
+	headers := make([]string, 0, len(names))
+	for _, n := range names {
+		c, err := findStatusColumn(strings.TrimSpace(n))
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+		headers = append(headers, c.name)
+	}
+
+	rows := make([]output.Row, 0, len(results))
+	for _, r := range results {
+		values := make([]any, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, c.value(r))
+		}
+		rows = append(rows, output.Row{Columns: headers, Values: values})
+	}
+
+	if sortBy == "" {
+		return rows, nil
+	}
+
+	descending := strings.HasPrefix(sortBy, "-")
+	sortColumn, err := findStatusColumn(strings.TrimPrefix(sortBy, "-"))
+	if err != nil {
+		return nil, fmt.Errorf("--sort: %w", err)
+	}
+
+	// sort the results, the column might not be shown
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+
+	slices.SortStableFunc(order, func(a, b int) int {
+		c := compareValues(sortColumn.sortKey(results[a]), sortColumn.sortKey(results[b]))
+		if descending {
+			return -c
+		}
+		return c
+	})
+
+	sorted := make([]output.Row, 0, len(rows))
+	for _, i := range order {
+		sorted = append(sorted, rows[i])
+	}
+
+	return sorted, nil
+}
+
+// compareValues compares numbers as numbers and everything else using
+// filter.Compare, so versions sort as versions. Missing values go first.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	x, okA := a.(float64)
+	y, okB := b.(float64)
+	if okA && okB {
+		return cmp.Compare(x, y)
+	}
+
+	return filter.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// printStatusTable prints rows as an aligned table, one row per device
+func printStatusTable(rows []output.Row) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, r := range rows {
+		if i == 0 {
+			fmt.Fprintln(w, strings.ToUpper(strings.Join(r.Columns, "\t")))
+		}
+
+		cells := make([]string, 0, len(r.Values))
+		for _, v := range r.Values {
+			cells = append(cells, formatCell(v))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func formatCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case float64:
+		return fmt.Sprintf("%.1f%%", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// statusColumnsHelp lists the columns for the help text of bsp status
+func statusColumnsHelp() string {
+	var b strings.Builder
+	for _, c := range statusColumns {
+		fmt.Fprintf(&b, "  %-9s %s\n", c.name, c.description)
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package bsp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deif/iectl/auth"
+	"github.com/spf13/pflag"
+)
+
+// AddTLSFlags adds the flags telling how device certificates are
+// verified, and which certificate is presented to them.
+func AddTLSFlags(flags *pflag.FlagSet) {
+	flags.Bool("insecure", false, "do not verify connection certificates")
+	flags.String("known-hosts", "", "file trusted device certificates are kept in, defaults to known_hosts in the iectl config directory")
+	flags.Bool("no-trust-on-first-use", false, "refuse devices whose certificate is not trusted already, see bsp trust")
+	flags.String("ca-bundle", "", "pem file of CAs device certificates are issued by, instead of the system CAs")
+	flags.Bool("ca-bundle-with-system", false, "trust the system CAs as well as --ca-bundle")
+	flags.String("client-cert", "", "pem file of a client certificate, for mutual TLS")
+	flags.String("client-key", "", "pem file of the private key of --client-cert, if it is not in the same file")
+	flags.String("tls-server-name", "", "verify device certificates against this name, rather than the address connected to")
+}
+
+// TLS tells how the certificates of devices are verified
+type TLS struct {
+	// Known are the pinned certificates, nil if
+	// certificates are not verified at all
+	Known *auth.KnownHosts
+
+	// ServerName is what certificates are verified against,
+	// unless a device tells otherwise
+	ServerName string
+
+	options []auth.Option
+}
+
+// TLSFromFlags returns how certificates are verified, as told by the flags
+// of AddTLSFlags.
+func TLSFromFlags(flags *pflag.FlagSet) (*TLS, error) {
+	t := &TLS{}
+	t.ServerName, _ = flags.GetString("tls-server-name")
+
+	bundle, _ := flags.GetString("ca-bundle")
+	system, _ := flags.GetBool("ca-bundle-with-system")
+	if bundle != "" {
+		o, err := auth.WithCABundle(bundle, system)
+		if err != nil {
+			return nil, err
+		}
+		t.options = append(t.options, o)
+	}
+
+	cert, _ := flags.GetString("client-cert")
+	key, _ := flags.GetString("client-key")
+	if key != "" && cert == "" {
+		return nil, fmt.Errorf("--client-key given without --client-cert")
+	}
+
+	if cert != "" {
+		// the key might be in the same file
+		if key == "" {
+			key = cert
+		}
+
+		o, err := auth.WithClientCertificate(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		t.options = append(t.options, o)
+	}
+
+	insecure, _ := flags.GetBool("insecure")
+	if insecure {
+		return t, nil
+	}
+
+	var err error
+	t.Known, err = knownHosts(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Options returns the options connecting to host, serverName
+// overrides the ServerName of t if not empty.
+func (t *TLS) Options(host, serverName string) []auth.Option {
+	options := append([]auth.Option{}, t.options...)
+
+	if serverName == "" {
+		serverName = t.ServerName
+	}
+	if serverName != "" {
+		options = append(options, auth.WithServerName(serverName))
+	}
+
+	if t.Known == nil {
+		return append(options, auth.WithInsecure)
+	}
+
+	return append(options, auth.WithKnownHosts(t.Known, host))
+}
+
+// knownHosts returns the pins of --known-hosts, or the default file
+func knownHosts(flags *pflag.FlagSet) (*auth.KnownHosts, error) {
+	path, _ := flags.GetString("known-hosts")
+	if path == "" {
+		var err error
+		path, err = auth.DefaultKnownHostsPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	known := auth.NewKnownHosts(path)
+	known.Strict, _ = flags.GetBool("no-trust-on-first-use")
+	known.Pinned = func(host, fingerprint string) {
+		fmt.Fprintf(os.Stderr, "Trusting %s on first use, its certificate is %s\n", host, fingerprint)
+	}
+
+	return known, nil
+}
@@ -0,0 +1,71 @@
+package bsp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestServerNameFromInventory(t *testing.T) {
+	cert, err := bsptest.SelfSignedCertificate("rig3-genset1.local")
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+
+	srv := bsptest.NewUnstartedServer()
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	certPEM, _, err := bsptest.EncodePEM(cert)
+	if err != nil {
+		t.Fatalf("unable to encode certificate: %s", err)
+	}
+
+	bundle := filepath.Join(dir, "ca.pem")
+	err = os.WriteFile(bundle, certPEM, 0o600)
+	if err != nil {
+		t.Fatalf("unable to write ca bundle: %s", err)
+	}
+
+	path := filepath.Join(dir, "inventory.yaml")
+	inventory := fmt.Sprintf(`
+devices:
+  genset1:
+    address: %s
+    servername: rig3-genset1.local
+`, srv.Host())
+
+	err = os.WriteFile(path, []byte(inventory), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write inventory: %s", err)
+	}
+
+	// nothing is trusted on first use, the certificate has to verify
+	args := []string{"hostname", "--inventory", path, "--target", "genset1", "--ca-bundle", bundle,
+		"--known-hosts", filepath.Join(dir, "known_hosts"), "--no-trust-on-first-use"}
+
+	out, err := run(t, args...)
+	if err != nil {
+		t.Fatalf("expected the certificate to verify against the server name, got %s", err)
+	}
+	assertContains(t, out, "iE250-0bad0c")
+
+	// the inventory knows better than the flags
+	_, err = run(t, append(args, "--tls-server-name", "someone.else")...)
+	if err != nil {
+		t.Fatalf("expected the inventory to win over --tls-server-name, got %s", err)
+	}
+
+	// without the server name, the address is not in the certificate
+	_, err = run(t, "hostname", "--target", srv.Host(), "--ca-bundle", bundle,
+		"--known-hosts", filepath.Join(dir, "known_hosts"), "--no-trust-on-first-use")
+	if err == nil {
+		t.Fatalf("expected the certificate to be refused for %s", srv.Host())
+	}
+}
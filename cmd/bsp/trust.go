@@ -0,0 +1,167 @@
+package bsp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/output"
+	"github.com/spf13/cobra"
+)
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "List, add or remove trusted device certificates",
+	Long: `List, add or remove trusted device certificates
+
+Devices use self-signed certificates, which cannot be verified. Instead the
+certificate of a device is trusted the first time it is seen, and refused
+should it ever change - just like ssh does with host keys. Fingerprints are
+kept in known_hosts in the iectl config directory, or the file given by
+--known-hosts.
+
+Certificates that can be verified are always trusted, use
+--no-trust-on-first-use to refuse devices not added using bsp trust add.`,
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		known, err := knownHosts(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		pins, err := known.All()
+		if err != nil {
+			return err
+		}
+
+		if out.Structured() {
+			if pins == nil {
+				pins = []auth.Pin{}
+			}
+			return out.Print(pins)
+		}
+
+		if len(pins) == 0 {
+			fmt.Println("no trusted devices")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tFINGERPRINT")
+		for _, v := range pins {
+			fmt.Fprintf(w, "%s\t%s\n", v.Host, v.Fingerprint)
+		}
+		return w.Flush()
+	},
+}
+
+var trustAddCmd = &cobra.Command{
+	Use:   "add <host>...",
+	Short: "Trust the current certificate of host(s)",
+	Long: `Trust the current certificate of host(s)
+
+The certificate is fetched from the host, and trusted from now on - replacing
+any certificate trusted before. Compare the fingerprint with the one shown on
+the device, or give the expected one using --fingerprint:
+
+  iectl bsp trust add iE250-0bad0c.local --fingerprint SHA256:...`,
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		known, err := knownHosts(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		expected, _ := cmd.Flags().GetString("fingerprint")
+		cmd.SilenceUsage = true
+
+		for _, host := range args {
+			fingerprint, err := fetchFingerprint(host)
+			if err != nil {
+				return err
+			}
+
+			if expected != "" && fingerprint != expected {
+				return fmt.Errorf("%s presented %s, not %s", host, fingerprint, expected)
+			}
+
+			err = known.Add(host, fingerprint)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s trusted, %s\n", host, fingerprint)
+		}
+
+		return nil
+	},
+}
+
+var trustRemoveCmd = &cobra.Command{
+	Use:         "remove <host>...",
+	Aliases:     []string{"delete"},
+	Short:       "Stop trusting the certificate of host(s)",
+	Annotations: map[string]string{skipTargets: ""},
+	Args:        cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		known, err := knownHosts(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		for _, host := range args {
+			removed, err := known.Remove(host)
+			if err != nil {
+				return err
+			}
+
+			if !removed {
+				return fmt.Errorf("%s is not trusted", host)
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	trustAddCmd.Flags().String("fingerprint", "", "only trust the certificate if it has this fingerprint")
+	trustCmd.AddCommand(trustAddCmd)
+	trustCmd.AddCommand(trustRemoveCmd)
+	RootCmd.AddCommand(trustCmd)
+}
+
+// fetchFingerprint connects to host, and returns the fingerprint
+// of the certificate it presents.
+func fetchFingerprint(host string) (string, error) {
+	addr := host
+	_, _, err := net.SplitHostPort(host)
+	if err != nil {
+		addr = net.JoinHostPort(host, "443")
+	}
+
+	// verifying the certificate is what we are about to do
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", fmt.Errorf("unable to connect to %s: %w", host, err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("%s presented no certificate", host)
+	}
+
+	return auth.Fingerprint(certs[0]), nil
+}
@@ -0,0 +1,87 @@
+package bsp
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp/bsptest"
+)
+
+func TestTrustOnFirstUse(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	srv := newServer(t)
+
+	// first contact pins the certificate
+	_, err := executeVerified(t, []*bsptest.Server{srv}, "status", "--known-hosts", file)
+	if err != nil {
+		t.Fatalf("expected the certificate to be trusted on first use, got %s", err)
+	}
+
+	out, err := run(t, "trust", "--known-hosts", file)
+	if err != nil {
+		t.Fatalf("unable to list trusted devices: %s", err)
+	}
+	assertContains(t, out, srv.Host())
+	assertContains(t, out, auth.Fingerprint(srv.Certificate()))
+
+	// another certificate is refused
+	err = auth.NewKnownHosts(file).Add(srv.Host(), "SHA256:somethingelse")
+	if err != nil {
+		t.Fatalf("unable to pin: %s", err)
+	}
+
+	_, err = executeVerified(t, []*bsptest.Server{srv}, "status", "--known-hosts", file)
+	var mismatch *auth.CertificateMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a certificate mismatch, got %v", err)
+	}
+
+	// adding it again trusts the new one
+	_, err = run(t, "trust", "add", srv.Host(), "--known-hosts", file)
+	if err != nil {
+		t.Fatalf("unable to trust: %s", err)
+	}
+
+	_, err = executeVerified(t, []*bsptest.Server{srv}, "status", "--known-hosts", file)
+	if err != nil {
+		t.Fatalf("expected the added certificate to be trusted, got %s", err)
+	}
+
+	_, err = run(t, "trust", "remove", srv.Host(), "--known-hosts", file)
+	if err != nil {
+		t.Fatalf("unable to remove: %s", err)
+	}
+
+	_, err = run(t, "trust", "remove", srv.Host(), "--known-hosts", file)
+	if err == nil {
+		t.Fatalf("expected removing twice to fail")
+	}
+}
+
+func TestTrustStrict(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	srv := newServer(t)
+
+	_, err := executeVerified(t, []*bsptest.Server{srv}, "status", "--known-hosts", file, "--no-trust-on-first-use")
+	var unknown *auth.UnknownHostError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected an unknown host, got %v", err)
+	}
+
+	_, err = run(t, "trust", "add", srv.Host(), "--known-hosts", file, "--fingerprint", "SHA256:somethingelse")
+	if err == nil {
+		t.Fatalf("expected a fingerprint mismatch to be refused")
+	}
+
+	_, err = run(t, "trust", "add", srv.Host(), "--known-hosts", file, "--fingerprint", auth.Fingerprint(srv.Certificate()))
+	if err != nil {
+		t.Fatalf("unable to trust: %s", err)
+	}
+
+	_, err = executeVerified(t, []*bsptest.Server{srv}, "status", "--known-hosts", file, "--no-trust-on-first-use")
+	if err != nil {
+		t.Fatalf("expected the added certificate to be trusted, got %s", err)
+	}
+}
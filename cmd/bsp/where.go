@@ -0,0 +1,92 @@
+package bsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/filter"
+	"github.com/deif/iectl/target"
+	"golang.org/x/sync/errgroup"
+)
+
+// deviceFields turns the status of a device into fields for --where,
+// with a few derived ones which are handy to filter on.
+func deviceFields(d *bsp.Device) (map[string]any, error) {
+	p, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal status: %w", err)
+	}
+
+	fields := make(map[string]any)
+	err = json.Unmarshal(p, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal status: %w", err)
+	}
+
+	software, _ := fields["software"].(map[string]any)
+	if software != nil {
+		software["active_version"] = d.Software.ActiveVersion()
+		software["inactive_version"] = d.Software.InactiveVersion()
+	}
+
+	return fields, nil
+}
+
+// filterTargets keeps the targets whose status matches expr, asking at most
+// parallel of them at once. Targets which cannot tell their status are left
+// out, with a warning. The targets left out are closed, all of them if
+// filtering fails.
+func filterTargets(ctx context.Context, targets target.Collection, expr filter.Expression, parallel int) (target.Collection, error) {
+	matches := make([]bool, len(targets))
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(parallel, 1))
+	for i, t := range targets {
+		g.Go(func() error {
+			d, err := bsp.New(t).Status(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: leaving out %s, unable to get status: %s\n", t.Hostname, err)
+				return nil
+			}
+
+			fields, err := deviceFields(d)
+			if err != nil {
+				return err
+			}
+
+			matches[i], err = expr.Match(fields)
+			if err != nil {
+				return fmt.Errorf("--where: %w", err)
+			}
+
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	if err != nil {
+		targets.Close()
+		return nil, err
+	}
+
+	// those left out might have logged in already
+	filtered := make(target.Collection, 0, len(targets))
+	left := make(target.Collection, 0)
+	for i, t := range targets {
+		if matches[i] {
+			filtered = append(filtered, t)
+		} else {
+			left = append(left, t)
+		}
+	}
+	left.Close()
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("none of the %d target(s) matches --where", len(targets))
+	}
+
+	return filtered, nil
+}
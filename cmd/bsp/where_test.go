@@ -0,0 +1,112 @@
+package bsp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/filter"
+	"github.com/deif/iectl/target"
+)
+
+func TestWhere(t *testing.T) {
+	old, updated := newServer(t), newServer(t)
+
+	d := old.Device()
+	d.Hostname = "old"
+	old.SetDevice(d)
+
+	d.Hostname = "updated"
+	d.Software.B = "2.0.10.0"
+	d.Software.Active = "B"
+	updated.SetDevice(d)
+
+	servers := []*bsptest.Server{old, updated}
+
+	out, err := execute(t, servers, "hostname", "--where", "software.active_version < 2.0.10")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+	assertContains(t, out, "old")
+	if strings.Contains(out, "updated") {
+		t.Fatalf("expected only the old device, got:\n%s", out)
+	}
+
+	out, err = execute(t, servers, "hostname", "--where", "software.active == B && software.inactive_version == 2.0.9.0")
+	if err != nil {
+		t.Fatalf("hostname failed: %s", err)
+	}
+	assertContains(t, out, "updated")
+	if strings.Contains(out, "old") {
+		t.Fatalf("expected only the updated device, got:\n%s", out)
+	}
+
+	_, err = execute(t, servers, "hostname", "--where", "software.active_version > 3")
+	if err == nil {
+		t.Fatalf("expected an error when nothing matches")
+	}
+
+	_, err = execute(t, servers, "hostname", "--where", "software.version > 3")
+	if err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Fatalf("expected an unknown field error, got %v", err)
+	}
+}
+
+func TestFilterTargets(t *testing.T) {
+	matching, other := newServer(t), newServer(t)
+	d := other.Device()
+	d.Hostname = "other"
+	other.SetDevice(d)
+
+	// logging in takes a while, long enough to tell how many log in at once
+	var running, peak atomic.Int32
+	lazy := func(srv *bsptest.Server) target.Endpoint {
+		return target.Endpoint{Hostname: srv.Host(), Client: auth.Lazy(func() (*http.Client, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			e, err := srv.Endpoint()
+			return e.Client, err
+		})}
+	}
+
+	targets := target.Collection{lazy(matching), lazy(other), lazy(other), lazy(other), lazy(other)}
+	expr, err := filter.Parse("hostname != other")
+	if err != nil {
+		t.Fatalf("unable to parse: %s", err)
+	}
+
+	filtered, err := filterTargets(context.Background(), targets, expr, 2)
+	if err != nil || len(filtered) != 1 {
+		t.Fatalf("expected a single target, got %d: %v", len(filtered), err)
+	}
+	defer filtered.Close()
+
+	if peak.Load() != 2 {
+		t.Fatalf("expected 2 targets at once, got %d", peak.Load())
+	}
+
+	// those left out are closed
+	_, err = bsp.New(targets[1]).Status(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("expected the target left out to be closed, got %v", err)
+	}
+
+	_, err = bsp.New(filtered[0]).Status(context.Background())
+	if err != nil {
+		t.Fatalf("expected the matching target to be usable, got %s", err)
+	}
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/deif/iectl/auth"
+	bspapi "github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/cmd/bsp"
+	"github.com/deif/iectl/mdns"
+	"github.com/deif/iectl/target"
+	"github.com/deif/iectl/tui"
+	"github.com/spf13/cobra"
+)
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "live overview of DEIF devices on the network",
+	Long: `live overview of DEIF devices on the network
+
+Devices are discovered like discover and browse does, and the status of every
+device is polled continuously: reachability, firmware slots, disk usage and
+whether ssh and rdp is enabled.
+
+Devices that went offline are shown in red, those running another firmware
+version than the rest (or --version) in yellow.
+
+Mark devices with space, and restart them (r), ssh into them (s) or install
+firmware on them (i) - without marks, the highlighted device is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networks, _ := cmd.Flags().GetStringSlice("scan")
+		d, err := bsp.DiscovererFromFlags(cmd.Flags(), networks, nil)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, err := d.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to discover devices: %w", err)
+		}
+
+		useIP, _ := cmd.Flags().GetBool("use-ip")
+		sshUser, _ := cmd.Flags().GetString("ssh-user")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		version, _ := cmd.Flags().GetString("version")
+
+		logins, err := bsp.LoginsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		// printing would mess up the dashboard
+		if logins.TLS().Known != nil {
+			logins.TLS().Known.Pinned = nil
+		}
+
+		c := &dashboardClients{logins: logins, useIP: useIP}
+		defer c.close()
+
+		m := tui.DashboardModel(events, tui.Dashboard{
+			Interval: interval,
+			Version:  version,
+			Poll: func(ctx context.Context, t mdns.Target) (tui.DeviceStatus, error) {
+				e, err := c.endpoint(ctx, t)
+				if err != nil {
+					return tui.DeviceStatus{}, err
+				}
+
+				s, err := poll(ctx, e)
+				c.forget(e.Hostname, err)
+				return s, err
+			},
+			Restart: func(ctx context.Context, t mdns.Target) error {
+				e, err := c.endpoint(ctx, t)
+				if err != nil {
+					return err
+				}
+
+				return bspapi.New(e).Restart(ctx, 0)
+			},
+			SSH: func(targets []mdns.Target) (*exec.Cmd, error) {
+				hosts := make([]string, 0, len(targets))
+				for _, t := range targets {
+					host := t.Hostname
+					if useIP && len(t.IPv4) > 0 {
+						host = t.IPv4[0].String()
+					}
+					hosts = append(hosts, host)
+				}
+
+				return bsp.SSHCommand(sshUser, hosts)
+			},
+			Install: func(targets []mdns.Target, file string) error {
+				collection := make(target.Collection, 0, len(targets))
+				for _, t := range targets {
+					e, err := c.endpoint(context.Background(), t)
+					if err != nil {
+						return err
+					}
+					collection = append(collection, e)
+				}
+
+				_, err := bsp.InstallFirmware(collection, file)
+				return err
+			},
+		})
+
+		p := tea.NewProgram(m, tea.WithAltScreen())
+		_, err = p.Run()
+		return err
+	},
+}
+
+// poll fetches everything the dashboard shows about e
+func poll(ctx context.Context, e target.Endpoint) (tui.DeviceStatus, error) {
+	c := bspapi.New(e)
+
+	d, err := c.Status(ctx)
+	if err != nil {
+		return tui.DeviceStatus{}, err
+	}
+
+	s := tui.DeviceStatus{Device: d}
+	s.SSH, err = c.ServiceRunning(ctx, bspapi.ServiceSSH)
+	if err != nil {
+		return tui.DeviceStatus{}, err
+	}
+
+	s.RDP, err = c.ServiceRunning(ctx, bspapi.ServiceRDP)
+	if err != nil {
+		return tui.DeviceStatus{}, err
+	}
+
+	return s, nil
+}
+
+// dashboardClients logs in to every device once, and keeps the
+// client around for as long as it is accepted.
+type dashboardClients struct {
+	logins *bsp.Logins
+	useIP  bool
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// endpoint returns the endpoint of t, logging in unless done already
+func (c *dashboardClients) endpoint(ctx context.Context, t mdns.Target) (target.Endpoint, error) {
+	host := t.Address(c.useIP)
+
+	c.mu.Lock()
+	client, exists := c.clients[host]
+	c.mu.Unlock()
+
+	if exists {
+		return target.Endpoint{Hostname: host, Client: client}, nil
+	}
+
+	// a device not answering should not hold up the others,
+	// logging in gives up along with the poll.
+	client, err := c.logins.Client(ctx, t, c.useIP)
+	if err != nil {
+		return target.Endpoint{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// someone else might have logged in meanwhile
+	existing, exists := c.clients[host]
+	if exists {
+		auth.Close(client)
+		return target.Endpoint{Hostname: host, Client: existing}, nil
+	}
+
+	if c.clients == nil {
+		c.clients = make(map[string]*http.Client)
+	}
+	c.clients[host] = client
+
+	return target.Endpoint{Hostname: host, Client: client}, nil
+}
+
+// forget drops the client of host if err tells it is no longer accepted,
+// so the next poll logs in again - devices forget sessions when restarting.
+func (c *dashboardClients) forget(host string, err error) {
+	if bspapi.StatusCode(err) != http.StatusUnauthorized {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, exists := c.clients[host]
+	if exists {
+		auth.Close(client)
+		delete(c.clients, host)
+	}
+}
+
+// close releases every client
+func (c *dashboardClients) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, client := range c.clients {
+		auth.Close(client)
+		delete(c.clients, host)
+	}
+}
+
+func init() {
+	bsp.AddBrowserFlags(dashboardCmd.Flags())
+	dashboardCmd.Flags().StringSlice("scan", []string{}, "probe network(s) in CIDR notation for devices instead of using mDNS")
+	dashboardCmd.Flags().Bool("use-ip", false, "connect to devices by ip address instead of hostname")
+	dashboardCmd.Flags().Duration("interval", 10*time.Second, "time between status polls of each device")
+	dashboardCmd.Flags().String("version", "", "firmware version devices should run, defaults to whatever most devices run")
+	dashboardCmd.Flags().String("ssh-user", "root", "ssh username")
+	bsp.AddLoginFlags(dashboardCmd.Flags(), "admin")
+	bsp.AddTLSFlags(dashboardCmd.Flags())
+	rootCmd.AddCommand(dashboardCmd)
+}
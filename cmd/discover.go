@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 
+	"github.com/deif/iectl/cmd/bsp"
 	"github.com/deif/iectl/mdns"
+	"github.com/deif/iectl/output"
 
-	"github.com/miekg/dns"
 	"github.com/spf13/cobra"
 )
 
@@ -17,13 +19,35 @@ var discoverCmd = &cobra.Command{
 	Long: `discover deif devices on the network
 
 Continuously scans and reports discovered devices in real time.
-Default: Displays each discovered host only once, writing a new line as new hosts appear.
- --json: Emits the full list of all discovered devices as a JSON array every time a new device is found.`,
+Default: Displays each discovered host only once, writing a new line as new hosts appear (or reappear).
+ --json: Emits the full list of all discovered devices as a JSON array every time a device is found, changes or goes away.
+ --events, --output ndjson: Emits one JSON object per line for each device added, updated or removed, e.g.
+   {"event":"added","target":{"hostname":"iE250-0bad0c.local",...},"time":"..."}
+ --template: Renders each device as it is discovered, e.g. --template '{{.hostname}} {{.ipv4}}'
+ --output yaml, csv or table: Renders the devices known once discovery ends, needs --timeout or --scan.
+
+With --scan, networks are probed for devices instead of listening for mDNS,
+for sites where multicast is blocked. The command ends when the scan is done.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		q := dns.Question{Name: dns.Fqdn("_base-unit-deif._tcp.local"), Qtype: dns.TypePTR}
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		networks, _ := cmd.Flags().GetStringSlice("scan")
+		d, err := bsp.DiscovererFromFlags(cmd.Flags(), networks, nil)
+		if err != nil {
+			return err
+		}
 
-		browser := mdns.Browser{Question: q}
 		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		// these formats are rendered once, when we are done
+		final := out.Format == output.YAML || out.Format == output.CSV || out.Format == output.Table
+		if final && timeout == 0 && len(networks) == 0 {
+			return fmt.Errorf("discover never ends on its own, --output %s needs --timeout or --scan", out.Format)
+		}
+
 		ctx := context.Background()
 		if timeout != 0 {
 			var cancel context.CancelFunc
@@ -31,21 +55,51 @@ Default: Displays each discovered host only once, writing a new line as new host
 			defer cancel()
 		}
 
-		updates, err := browser.Run(ctx)
+		events, err := d.Run(ctx)
 		if err != nil {
-			return fmt.Errorf("unable to browse mdns: %w", err)
+			return fmt.Errorf("unable to discover devices: %w", err)
+		}
+
+		// a stream of changes, one object per line
+		asEvents, _ := cmd.Flags().GetBool("events")
+		if asEvents || out.Format == output.NDJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for e := range events {
+				err := enc.Encode(e)
+				if err != nil {
+					return fmt.Errorf("unable to marshal json: %w", err)
+				}
+			}
+
+			return nil
+		}
+
+		// errors go to stderr, and only once while they persist,
+		// the browser keeps retrying in the background.
+		var lastErr string
+		warn := func(err error) {
+			if err.Error() == lastErr {
+				return
+			}
+			lastErr = err.Error()
+			fmt.Fprintf(os.Stderr, "discover: %s, retrying...\n", err)
 		}
 
 		// if running with json output, just dump
 		// everthing from the browser.
-		asJson, _ := cmd.Flags().GetBool("json")
-		if asJson {
+		if out.Format == output.JSON {
 			for {
-				u, ok := <-updates
+				e, ok := <-events
 				if !ok {
 					break
 				}
-				p, err := json.Marshal(u)
+				if e.Type == mdns.Error {
+					warn(e.Err)
+					continue
+				}
+				lastErr = ""
+
+				p, err := json.Marshal(e.Targets)
 				if err != nil {
 					return fmt.Errorf("unable to marshal json: %w", err)
 				}
@@ -54,21 +108,47 @@ Default: Displays each discovered host only once, writing a new line as new host
 			}
 		}
 
+		var targets []*mdns.Target
 		known := make(map[string]struct{})
 		for {
-			u, ok := <-updates
+			e, ok := <-events
 			if !ok {
 				break
 			}
-			for _, v := range u {
-				_, exists := known[v.Hostname]
-				if exists {
-					continue
-				}
+			if e.Type == mdns.Error {
+				warn(e.Err)
+				continue
+			}
+			lastErr = ""
+			targets = e.Targets
 
-				fmt.Println(v.Hostname)
-				known[v.Hostname] = struct{}{}
+			// a host that leaves and rejoins is displayed again
+			if e.Type == mdns.Removed {
+				delete(known, e.Target.Hostname)
+				continue
 			}
+
+			_, exists := known[e.Target.Hostname]
+			if exists {
+				continue
+			}
+
+			known[e.Target.Hostname] = struct{}{}
+
+			switch {
+			case final:
+			case out.Structured():
+				err := out.Print(e.Target)
+				if err != nil {
+					return err
+				}
+			default:
+				fmt.Println(e.Target.Hostname)
+			}
+		}
+
+		if final {
+			return out.Print(targets)
 		}
 
 		return nil
@@ -77,6 +157,9 @@ Default: Displays each discovered host only once, writing a new line as new host
 
 func init() {
 	discoverCmd.Flags().Duration("timeout", 0, "timeout, zero-value disables timeout")
+	discoverCmd.Flags().Bool("events", false, "stream added, updated and removed events as newline delimited json")
+	bsp.AddBrowserFlags(discoverCmd.Flags())
+	discoverCmd.Flags().StringSlice("scan", []string{}, "probe network(s) in CIDR notation for devices instead of using mDNS")
 	rootCmd.AddCommand(discoverCmd)
 
 }
@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/deif/iectl/cmd/bsp"
+	"github.com/deif/iectl/output"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 
@@ -27,12 +29,22 @@ var rootCmd = &cobra.Command{
 			}()
 		}
 
-		return nil
+		// catch unknown formats before doing anything
+		_, err := output.FromFlags(cmd.Flags())
+		return err
 	},
 }
 
 func Execute() {
 	err := rootCmd.Execute()
+
+	// commands operating on many targets, tell partial
+	// failure apart from complete failure.
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+
 	if err != nil {
 		os.Exit(1)
 	}
@@ -46,7 +58,7 @@ func init() {
 
 	rootCmd.AddCommand(bsp.RootCmd)
 	rootCmd.PersistentFlags().Bool("enable-pprof", false, "enable debug pprof server on 0.0.0.0:6060")
-	rootCmd.PersistentFlags().BoolP("json", "j", false, "output as json")
+	output.AddFlags(rootCmd.PersistentFlags())
 	rootCmd.PersistentFlags().BoolP(
 		"interactive", "i", term.IsTerminal(int(os.Stdout.Fd())),
 		"interactive mode, ask for passwords, display pretty ascii")
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/deif/iectl/output"
 	"github.com/spf13/cobra"
 )
 
@@ -23,27 +24,39 @@ var (
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version info on iectl",
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		asJson, _ := cmd.Flags().GetBool("json")
-		if asJson {
-			return fmt.Errorf("version can't do --json")
+	Long: `Print version info on iectl, and check if a newer version is available.
+
+Structured output, e.g. --json, holds the version info only - no update check is done.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := output.FromFlags(cmd.Flags())
+		if err != nil {
+			return err
 		}
-		return nil
-	},
-	Run: func(cmd *cobra.Command, args []string) {
+
+		if out.Structured() {
+			return out.Print(versionInfo{version, commit, date})
+		}
+
 		interactive, _ := cmd.Flags().GetBool("interactive")
 		fmt.Printf("iectl %s, commit %s (%s)\n", version, commit, date)
 		fmt.Printf("interactive terminal: %t\n", interactive)
 
 		if runtime.GOOS == "windows" {
 			doWindowsThings()
-			return
+			return nil
 		}
 
 		checkGithubVersion()
+		return nil
 	},
 }
 
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
@@ -0,0 +1,286 @@
+// Package credentials keeps the usernames and passwords of devices in an
+// encrypted file. Entries are matched by hostname, serial number or a glob
+// of either, e.g.
+//
+//	iE250-*         every device with a default hostname
+//	10.20.3.*       every device of a subnet
+//	2300000001      the device with that serial number
+//
+// The file is encrypted using XChaCha20-Poly1305, with a key derived from a
+// passphrase using scrypt.
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrWrongPassphrase is returned when the file cannot be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase, or the credentials file is damaged")
+
+// Entry is the credentials of the devices matching Match
+type Entry struct {
+	Match    string `json:"match"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+// Store is an unlocked credentials file, changes are
+// written once Save is called.
+type Store struct {
+	Path    string
+	Entries []Entry
+
+	salt []byte
+	key  []byte
+
+	// the scrypt parameters key was derived with, files written
+	// using others keep theirs
+	n, r, p int
+}
+
+// scrypt parameters, the recommended ones for interactive logins in 2017
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	saltSize     = 16
+	fileVersion  = 1
+	keyDerivator = "scrypt"
+)
+
+// limits of the scrypt parameters of files, a damaged one should
+// not make us spend a gigabyte of memory on deriving its key
+const (
+	maxScryptN      = 1 << 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 256 << 20
+)
+
+// file is what is written to disk
+type file struct {
+	Version int `json:"version"`
+	KDF     struct {
+		Name string `json:"name"`
+		Salt []byte `json:"salt"`
+		N    int    `json:"n"`
+		R    int    `json:"r"`
+		P    int    `json:"p"`
+	} `json:"kdf"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// DefaultPath is where credentials are kept, unless told otherwise
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "iectl", "credentials"), nil
+}
+
+// Exists tells if there is a credentials file at path
+func Exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to stat credentials: %w", err)
+	}
+
+	return true, nil
+}
+
+// New returns an empty store to be saved at path, encrypted using passphrase
+func New(path string, passphrase []byte) (*Store, error) {
+	return newStore(path, passphrase, scryptN, scryptR, scryptP)
+}
+
+// newStore is New, deriving the key using the scrypt parameters n, r and p
+func newStore(path string, passphrase []byte, n, r, p int) (*Store, error) {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create salt: %w", err)
+	}
+
+	key, err := scrypt.Key(passphrase, salt, n, r, p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %w", err)
+	}
+
+	return &Store{Path: path, salt: salt, key: key, n: n, r: r, p: p}, nil
+}
+
+// Open decrypts the credentials file at path using passphrase
+func Open(path string, passphrase []byte) (*Store, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials: %w", err)
+	}
+
+	f := file{}
+	err = json.Unmarshal(p, &f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials %s: %w", path, err)
+	}
+
+	if f.Version != fileVersion || f.KDF.Name != keyDerivator {
+		return nil, fmt.Errorf("%s: unsupported credentials file version %d (%s)", path, f.Version, f.KDF.Name)
+	}
+
+	kdf := f.KDF
+	if kdf.N < 2 || kdf.N > maxScryptN || kdf.R < 1 || kdf.R > maxScryptR || kdf.P < 1 || kdf.P > maxScryptP || 128*kdf.N*kdf.R > maxScryptMemory {
+		return nil, fmt.Errorf("%s: unsupported scrypt parameters n=%d r=%d p=%d", path, kdf.N, kdf.R, kdf.P)
+	}
+
+	key, err := scrypt.Key(passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%s: %w", path, ErrWrongPassphrase)
+	}
+
+	plain, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrWrongPassphrase)
+	}
+
+	s := &Store{Path: path, salt: kdf.Salt, key: key, n: kdf.N, r: kdf.R, p: kdf.P}
+	err = json.Unmarshal(plain, &s.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Save encrypts and writes the store, the file is only readable by the user
+func (s *Store) Save() error {
+	plain, err := json.Marshal(s.Entries)
+	if err != nil {
+		return fmt.Errorf("unable to marshal credentials: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(s.key)
+	if err != nil {
+		return err
+	}
+
+	f := file{Version: fileVersion}
+	f.KDF.Name = keyDerivator
+	f.KDF.Salt = s.salt
+	f.KDF.N, f.KDF.R, f.KDF.P = s.n, s.r, s.p
+
+	// a fresh nonce every time, never reuse one with the same key
+	f.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(f.Nonce)
+	if err != nil {
+		return fmt.Errorf("unable to create nonce: %w", err)
+	}
+	f.Data = aead.Seal(nil, f.Nonce, plain, nil)
+
+	p, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal credentials: %w", err)
+	}
+
+	dir := filepath.Dir(s.Path)
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("unable to create credentials directory: %w", err)
+	}
+
+	// CreateTemp creates files only readable by us, renaming it
+	// replaces the old file in one go.
+	fd, err := os.CreateTemp(dir, ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("unable to write credentials: %w", err)
+	}
+	defer os.Remove(fd.Name())
+
+	_, err = fd.Write(p)
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("unable to write credentials: %w", err)
+	}
+
+	err = fd.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write credentials: %w", err)
+	}
+
+	err = os.Rename(fd.Name(), s.Path)
+	if err != nil {
+		return fmt.Errorf("unable to write credentials: %w", err)
+	}
+
+	return nil
+}
+
+// Set adds e, replacing the entry with the same match if any
+func (s *Store) Set(e Entry) {
+	i := slices.IndexFunc(s.Entries, func(v Entry) bool { return v.Match == e.Match })
+	if i >= 0 {
+		s.Entries[i] = e
+		return
+	}
+
+	s.Entries = append(s.Entries, e)
+}
+
+// Remove removes the entry matching match, and tells if there was one
+func (s *Store) Remove(match string) bool {
+	before := len(s.Entries)
+	s.Entries = slices.DeleteFunc(s.Entries, func(v Entry) bool { return v.Match == match })
+	return len(s.Entries) != before
+}
+
+// Lookup returns the entry for a device known by names, e.g. its hostname,
+// address and serial number. Entries naming the device exactly are preferred
+// over globs, otherwise the first one matching wins.
+func (s *Store) Lookup(names ...string) (Entry, bool) {
+	for _, e := range s.Entries {
+		if slices.Contains(names, e.Match) {
+			return e, true
+		}
+	}
+
+	for _, e := range s.Entries {
+		for _, n := range names {
+			if n == "" {
+				continue
+			}
+
+			// bad patterns are simply not matching, Set could refuse them
+			// but a typo should not lock anyone out.
+			ok, _ := path.Match(e.Match, n)
+			if ok {
+				return e, true
+			}
+		}
+	}
+
+	return Entry{}, false
+}
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "iectl", "credentials")
+
+	s, err := New(path, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+
+	s.Set(Entry{Match: "iE250-*", Username: "admin", Password: "hunter2"})
+	err = s.Save()
+	if err != nil {
+		t.Fatalf("unable to save: %s", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unable to stat: %s", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the file to be private, got %s", fi.Mode())
+	}
+
+	p, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+	if strings.Contains(string(p), "hunter2") {
+		t.Fatalf("password written in plaintext:\n%s", p)
+	}
+
+	_, err = Open(path, []byte("wrong"))
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected wrong passphrase, got %v", err)
+	}
+
+	s, err = Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatalf("unable to open: %s", err)
+	}
+
+	e, ok := s.Lookup("iE250-0bad0c")
+	if !ok || e.Password != "hunter2" {
+		t.Fatalf("expected entry to survive a roundtrip, got %+v", e)
+	}
+}
+
+func TestScryptParameters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+
+	// files written using other parameters keep them, or they
+	// could not be opened again after saving
+	s, err := newStore(path, []byte("secret"), 1<<10, 8, 1)
+	if err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+
+	for i := range 2 {
+		s.Set(Entry{Match: "iE250-*", Password: fmt.Sprint(i)})
+		err = s.Save()
+		if err != nil {
+			t.Fatalf("unable to save: %s", err)
+		}
+
+		s, err = Open(path, []byte("secret"))
+		if err != nil {
+			t.Fatalf("unable to open after saving %d time(s): %s", i+1, err)
+		}
+	}
+
+	p, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read: %s", err)
+	}
+
+	// and files asking for too much are refused
+	for _, v := range []string{`"n": 1048576`, `"n": 0`, `"r": 1024`, `"p": -1`} {
+		key, _, _ := strings.Cut(v, ":")
+		damaged := regexp.MustCompile(key+`: -?\d+`).ReplaceAllString(string(p), v)
+
+		err = os.WriteFile(path, []byte(damaged), 0o600)
+		if err != nil {
+			t.Fatalf("unable to write: %s", err)
+		}
+
+		_, err = Open(path, []byte("secret"))
+		if err == nil || !strings.Contains(err.Error(), "unsupported scrypt parameters") {
+			t.Errorf("%s: expected the parameters to be refused, got %v", v, err)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s := &Store{Entries: []Entry{
+		{Match: "10.20.3.*", Password: "subnet"},
+		{Match: "iE250-*", Password: "default"},
+		{Match: "2300000001", Password: "serial"},
+		{Match: "10.20.3.21", Password: "exact"},
+	}}
+
+	cases := []struct {
+		names    []string
+		password string
+	}{
+		{[]string{"10.20.3.21"}, "exact"},
+		{[]string{"10.20.3.22"}, "subnet"},
+		{[]string{"iE250-0bad0c.local", "iE250-0bad0c"}, "default"},
+		{[]string{"iE250-0bad0c", "2300000001"}, "serial"},
+		{[]string{"controller.example", ""}, ""},
+	}
+
+	for _, c := range cases {
+		e, _ := s.Lookup(c.names...)
+		if e.Password != c.password {
+			t.Errorf("%v: expected %q, got %q", c.names, c.password, e.Password)
+		}
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	s := &Store{}
+	s.Set(Entry{Match: "a", Password: "1"})
+	s.Set(Entry{Match: "a", Password: "2"})
+
+	if len(s.Entries) != 1 || s.Entries[0].Password != "2" {
+		t.Fatalf("expected the entry to be replaced, got %+v", s.Entries)
+	}
+
+	if !s.Remove("a") || s.Remove("a") {
+		t.Fatalf("expected a single removal")
+	}
+}
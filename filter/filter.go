@@ -0,0 +1,299 @@
+// Package filter evaluates simple expressions against structured data,
+// e.g. the status of a device:
+//
+//	software.active_version < 2.0.10 && software.active == B
+//
+// Conditions compare a dotted field path with a value using one of
+// ==, =, !=, <, <=, >, >= or =~ (regular expression). Conditions are
+// combined with && (and) and || (or), && binds tighter - there are no
+// parentheses. Values are quoted using " or ', e.g. to contain && or ||.
+// Numbers are compared as numbers, strings that look like
+// versions as versions (2.0.9.0 < 2.0.10) and everything else as strings.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type condition struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Expression is a parsed filter, it is a disjunction of conjunctions
+type Expression [][]condition
+
+// operators, longest first so <= is not mistaken for <
+var operators = []string{"==", "!=", "<=", ">=", "=~", "=", "<", ">"}
+
+// Parse parses a filter expression
+func Parse(expr string) (Expression, error) {
+	var e Expression
+	for _, or := range splitAny(expr, "||", " or ") {
+		var conjunction []condition
+		for _, and := range splitAny(or, "&&", " and ") {
+			c, err := parseCondition(and)
+			if err != nil {
+				return nil, err
+			}
+			conjunction = append(conjunction, c)
+		}
+		e = append(e, conjunction)
+	}
+
+	return e, nil
+}
+
+// splitAny splits s at any of seps, except within quoted values
+func splitAny(s string, seps ...string) []string {
+	var (
+		parts []string
+		start int
+		quote byte
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+			continue
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+			continue
+		}
+
+		for _, sep := range seps {
+			if strings.HasPrefix(s[i:], sep) {
+				parts = append(parts, s[start:i])
+				start = i + len(sep)
+				i = start - 1
+				break
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func parseCondition(s string) (condition, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return condition{}, fmt.Errorf("empty condition")
+	}
+
+	// find the first operator, preferring the longest at that position
+	at, op := -1, ""
+	for _, o := range operators {
+		i := strings.Index(s, o)
+		if i == -1 {
+			continue
+		}
+		if at == -1 || i < at || (i == at && len(o) > len(op)) {
+			at, op = i, o
+		}
+	}
+
+	if at == -1 {
+		return condition{}, fmt.Errorf("%q: expected a comparison, e.g. hostname == rig3", s)
+	}
+
+	c := condition{
+		field: strings.TrimSpace(s[:at]),
+		op:    op,
+		value: unquote(strings.TrimSpace(s[at+len(op):])),
+	}
+
+	if c.field == "" {
+		return condition{}, fmt.Errorf("%q: missing field", s)
+	}
+
+	if c.op == "=" {
+		c.op = "=="
+	}
+
+	if c.op == "=~" {
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return condition{}, fmt.Errorf("%q: invalid regular expression: %w", s, err)
+		}
+		c.re = re
+	}
+
+	return c, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Match evaluates e against fields, which is usually the result of
+// unmarshalling json into a map[string]any. An error is returned if
+// the expression refers to a field that does not exist.
+func (e Expression) Match(fields map[string]any) (bool, error) {
+	for _, conjunction := range e {
+		matches := true
+		for _, c := range conjunction {
+			ok, err := c.match(fields)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c condition) match(fields map[string]any) (bool, error) {
+	v, err := lookup(fields, c.field)
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		actual string
+		cmp    int
+	)
+
+	switch v := v.(type) {
+	case nil:
+	case float64:
+		actual = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		actual = fmt.Sprint(v)
+	}
+
+	if c.re != nil {
+		return c.re.MatchString(actual), nil
+	}
+
+	// numbers are numbers, strings may be versions
+	n, isNumber := v.(float64)
+	expected, err := strconv.ParseFloat(c.value, 64)
+	if isNumber && err == nil {
+		cmp = cmpFloat(n, expected)
+	} else {
+		cmp = Compare(actual, c.value)
+	}
+
+	switch c.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return false, fmt.Errorf("unknown operator %s", c.op)
+}
+
+// lookup finds the value at a dotted path, list elements are
+// addressed by their index e.g. interfaces.0.ifname.
+func lookup(fields map[string]any, path string) (any, error) {
+	var current any = fields
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]any:
+			next, exists := v[segment]
+			if !exists {
+				return nil, fmt.Errorf("unknown field %s", path)
+			}
+			current = next
+
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("unknown field %s", path)
+			}
+			current = v[i]
+
+		default:
+			return nil, fmt.Errorf("unknown field %s", path)
+		}
+	}
+
+	return current, nil
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compare compares a and b as versions if both are, otherwise as strings.
+// It returns -1, 0 or 1 like strings.Compare.
+func Compare(a, b string) int {
+	va, okA := version(a)
+	vb, okB := version(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+
+	for i := range max(len(va), len(vb)) {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// version parses dot separated numbers, a plain number is a version too
+func version(s string) ([]int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if s == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(s, ".")
+	v := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		v = append(v, n)
+	}
+
+	return v, true
+}
@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const status = `{
+	"hostname": "rig3-genset1",
+	"serialnumber": "2300000001",
+	"interfaces": [{"ifname": "eth0", "status": {"link_state": "up"}}],
+	"mountpoints": [{"mountPoint": "/", "size": 1000000, "used": 250000}],
+	"software": {"A": "2.0.9.0", "B": "2.0.8.0", "active": "A", "active_version": "2.0.9.0"}
+}`
+
+func TestMatch(t *testing.T) {
+	fields := make(map[string]any)
+	err := json.Unmarshal([]byte(status), &fields)
+	if err != nil {
+		t.Fatalf("unable to unmarshal: %s", err)
+	}
+
+	cases := map[string]bool{
+		"software.active_version < 2.0.10":                   true,
+		"software.active_version < '2.0.9'":                  false,
+		"software.active_version >= 2.0.9":                   true,
+		"software.active_version == 2.0.9":                   true,
+		"software.active == B":                               false,
+		"software.active = A":                                true,
+		"software.active != B && hostname =~ ^rig3-":         true,
+		"software.active == B || hostname == rig3-genset1":   true,
+		"software.active == B or hostname == rig4-genset1":   false,
+		"interfaces.0.status.link_state == up":               true,
+		"mountpoints.0.used > 200000":                        true,
+		"mountpoints.0.size <= 999999":                       false,
+		`hostname == "rig3-genset1" and serialnumber > 23`:   true,
+		"hostname > rig3-genset0 && hostname < rig3-genset2": true,
+	}
+
+	for expr, expected := range cases {
+		e, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%s: unable to parse: %s", expr, err)
+			continue
+		}
+
+		got, err := e.Match(fields)
+		if err != nil {
+			t.Errorf("%s: unable to match: %s", expr, err)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("%s: expected %t, got %t", expr, expected, got)
+		}
+	}
+}
+
+func TestQuotedSeparators(t *testing.T) {
+	fields := map[string]any{"hostname": "rig and test || lab", "serialnumber": "2300000001"}
+
+	cases := map[string]bool{
+		`hostname == "rig and test || lab"`:                          true,
+		`hostname == 'rig and test || lab' && serialnumber > 23`:     true,
+		`hostname == "rig and test" or hostname == 'lab && rig'`:     false,
+		`serialnumber == 1 || hostname =~ "^rig and test \|\| lab$"`: true,
+	}
+
+	for expr, expected := range cases {
+		e, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%s: unable to parse: %s", expr, err)
+			continue
+		}
+
+		got, err := e.Match(fields)
+		if err != nil {
+			t.Errorf("%s: unable to match: %s", expr, err)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("%s: expected %t, got %t", expr, expected, got)
+		}
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	e, err := Parse("software.version < 2.0.10")
+	if err != nil {
+		t.Fatalf("unable to parse: %s", err)
+	}
+
+	_, err = e.Match(map[string]any{"software": map[string]any{}})
+	if err == nil {
+		t.Fatalf("expected an error for an unknown field")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "hostname", "== rig3", "hostname =~ (", "a == 1 &&"} {
+		_, err := Parse(expr)
+		if err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"2.0.9.0", "2.0.10", -1},
+		{"2.0.10.0", "2.0.10", 0},
+		{"v2.1", "2.0.99", 1},
+		{"abc", "abd", -1},
+		{"2.0.9-rc1", "2.0.10", 1}, // not a version, compared as strings
+	}
+
+	for _, c := range cases {
+		got := Compare(c.a, c.b)
+		if got != c.want {
+			t.Errorf("Compare(%s, %s): expected %d, got %d", c.a, c.b, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package fleet
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, value *Executor) context.Context {
+	return context.WithValue(ctx, contextKey{}, value)
+}
+
+// FromContext returns the executor of ctx, or an executor
+// running a single target at a time if there is none.
+func FromContext(ctx context.Context) *Executor {
+	v, ok := ctx.Value(contextKey{}).(*Executor)
+	if !ok {
+		return &Executor{Parallel: 1}
+	}
+	return v
+}
@@ -0,0 +1,241 @@
+// Package fleet runs an action on many targets at once, collecting
+// the outcome for each of them.
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deif/iectl/auth"
+	"github.com/deif/iectl/output"
+	"github.com/deif/iectl/target"
+)
+
+// Action is run once for every target
+type Action func(ctx context.Context, t target.Endpoint) error
+
+// Result is the outcome of an action on a single target
+type Result struct {
+	Hostname string        `json:"host"`
+	Err      error         `json:"-"`
+	Skipped  bool          `json:"-"`
+	Duration time.Duration `json:"-"`
+}
+
+func (r Result) status() string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Err != nil:
+		return "failed"
+	}
+	return "ok"
+}
+
+// message is the error without the hostname prefix, the
+// summary already tells which host it is about.
+func (r Result) message() string {
+	if r.Err == nil {
+		return ""
+	}
+	return strings.TrimPrefix(r.Err.Error(), r.Hostname+": ")
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Host     string  `json:"host"`
+		Result   string  `json:"result"`
+		Error    string  `json:"error,omitempty"`
+		Duration float64 `json:"duration"`
+	}{r.Hostname, r.status(), r.message(), r.Duration.Seconds()})
+}
+
+// Error is returned when the action failed on one or more targets,
+// it wraps the error of each failed target.
+type Error struct {
+	Results []Result
+}
+
+func (e *Error) count() (failed, skipped int) {
+	for _, r := range e.Results {
+		if r.Skipped {
+			skipped++
+		} else if r.Err != nil {
+			failed++
+		}
+	}
+	return
+}
+
+func (e *Error) Error() string {
+	failed, skipped := e.count()
+	if skipped > 0 {
+		return fmt.Sprintf("%d of %d target(s) failed, %d skipped", failed, len(e.Results), skipped)
+	}
+	return fmt.Sprintf("%d of %d target(s) failed", failed, len(e.Results))
+}
+
+func (e *Error) Unwrap() []error {
+	errs := make([]error, 0)
+	for _, r := range e.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// ExitCode is 2 if the action succeeded on some targets, telling
+// partial failure apart from complete failure (1).
+func (e *Error) ExitCode() int {
+	failed, skipped := e.count()
+	if failed+skipped == len(e.Results) {
+		return 1
+	}
+	return 2
+}
+
+// Executor runs actions on targets, Parallel at a time. Unless
+// ContinueOnError is set, no new targets are started after the first
+// failure - the remaining ones are reported as skipped.
+type Executor struct {
+	Parallel        int
+	ContinueOnError bool
+
+	// Printer renders the summary, a table is printed if it is
+	// nil or asks for human readable text.
+	Printer *output.Printer
+
+	// Output receives the summary table, os.Stdout if nil
+	Output io.Writer
+}
+
+// Run runs action on every target and prints a summary, it returns an
+// *Error if the action failed on any of them.
+func (e *Executor) Run(ctx context.Context, targets target.Collection, action Action) error {
+	results := e.Execute(ctx, targets, action)
+
+	err := e.Summary(results)
+	if err != nil {
+		return err
+	}
+
+	return failure(results)
+}
+
+// failure returns an *Error if any of results failed or was skipped
+func failure(results []Result) error {
+	for _, r := range results {
+		if r.Err != nil || r.Skipped {
+			return &Error{Results: results}
+		}
+	}
+
+	return nil
+}
+
+// Execute runs action on every target, results are in the order of targets
+func (e *Executor) Execute(ctx context.Context, targets target.Collection, action Action) []Result {
+	parallel := max(e.Parallel, 1)
+	results := make([]Result, len(targets))
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+
+	sem := make(chan struct{}, parallel)
+	for i, t := range targets {
+		results[i].Hostname = t.Hostname
+
+		sem <- struct{}{}
+
+		mu.Lock()
+		stop := failed && !e.ContinueOnError
+		mu.Unlock()
+
+		if stop || ctx.Err() != nil {
+			<-sem
+			results[i].Skipped = true
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// targets log in once used, which is now
+			start := time.Now()
+			err := auth.Authenticate(t.Client)
+			if err == nil {
+				err = action(ctx, t)
+			}
+			results[i].Err = err
+			results[i].Duration = time.Since(start)
+
+			if err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// Summary prints the outcome for each target
+func (e *Executor) Summary(results []Result) error {
+	out := e.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if e.Printer != nil && e.Printer.Structured() {
+		return e.Printer.Print(results)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tRESULT\tDURATION\tERROR")
+	for _, r := range results {
+		duration := "-"
+		if !r.Skipped {
+			duration = r.Duration.Round(time.Millisecond).String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Hostname, r.status(), duration, r.message())
+	}
+
+	return w.Flush()
+}
+
+// Failures writes a line to w for each target that failed or was skipped,
+// returning an *Error if there were any. It is for commands printing what
+// they got from targets themselves, rather than a summary.
+func Failures(w io.Writer, results []Result) error {
+	for _, r := range results {
+		if r.Err == nil && !r.Skipped {
+			continue
+		}
+
+		if r.Skipped {
+			fmt.Fprintf(w, "%s: skipped\n", r.Hostname)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", r.Hostname, r.message())
+	}
+
+	return failure(results)
+}
@@ -0,0 +1,193 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deif/iectl/output"
+	"github.com/deif/iectl/target"
+)
+
+var errBroken = errors.New("broken")
+
+func collection(hosts ...string) target.Collection {
+	c := make(target.Collection, 0, len(hosts))
+	for _, h := range hosts {
+		c = append(c, target.Endpoint{Hostname: h})
+	}
+	return c
+}
+
+// failOn fails the action on the given host
+func failOn(host string) Action {
+	return func(ctx context.Context, t target.Endpoint) error {
+		if t.Hostname == host {
+			return fmt.Errorf("%s: %w", t.Hostname, errBroken)
+		}
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	e := Executor{Parallel: 4, Output: &out}
+
+	err := e.Run(context.Background(), collection("a", "b", "c"), failOn(""))
+	if err != nil {
+		t.Fatalf("expected success, got %s", err)
+	}
+
+	if strings.Count(out.String(), " ok ") != 3 {
+		t.Fatalf("expected three ok hosts in summary, got:\n%s", out.String())
+	}
+}
+
+func TestStopOnError(t *testing.T) {
+	var out bytes.Buffer
+	e := Executor{Parallel: 1, Output: &out}
+
+	err := e.Run(context.Background(), collection("a", "b", "c"), failOn("b"))
+
+	var fleetErr *Error
+	if !errors.As(err, &fleetErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("expected the error of b to be wrapped")
+	}
+
+	if fleetErr.ExitCode() != 2 {
+		t.Fatalf("expected partial failure, got exit code %d", fleetErr.ExitCode())
+	}
+
+	r := fleetErr.Results
+	if r[0].status() != "ok" || r[1].status() != "failed" || r[2].status() != "skipped" {
+		t.Fatalf("unexpected results: %+v", r)
+	}
+
+	// the hostname is not repeated in the error column
+	if !strings.Contains(out.String(), "failed  ") || strings.Contains(out.String(), "b: broken") {
+		t.Fatalf("unexpected summary:\n%s", out.String())
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	e := Executor{Parallel: 1, ContinueOnError: true, Output: &bytes.Buffer{}}
+
+	err := e.Run(context.Background(), collection("a", "b", "c"), failOn("a"))
+
+	var fleetErr *Error
+	if !errors.As(err, &fleetErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+
+	r := fleetErr.Results
+	if r[0].status() != "failed" || r[1].status() != "ok" || r[2].status() != "ok" {
+		t.Fatalf("unexpected results: %+v", r)
+	}
+
+	if err.Error() != "1 of 3 target(s) failed" {
+		t.Fatalf("unexpected error message: %s", err)
+	}
+}
+
+func TestCompleteFailure(t *testing.T) {
+	e := Executor{Output: &bytes.Buffer{}}
+
+	err := e.Run(context.Background(), collection("a"), failOn("a"))
+
+	var fleetErr *Error
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1, got %v", err)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	var running, peak atomic.Int32
+	action := func(ctx context.Context, t target.Endpoint) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	e := Executor{Parallel: 3}
+	e.Execute(context.Background(), collection("a", "b", "c", "d", "e", "f", "g"), action)
+
+	if peak.Load() != 3 {
+		t.Fatalf("expected 3 targets at once, got %d", peak.Load())
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	var out bytes.Buffer
+	e := Executor{Parallel: 1, Printer: &output.Printer{Format: output.NDJSON, Out: &out}}
+
+	e.Run(context.Background(), collection("a", "b", "c"), failOn("b"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a line per host, got:\n%s", out.String())
+	}
+
+	expected := []string{"ok", "failed", "skipped"}
+	for i, l := range lines {
+		var r struct {
+			Host   string `json:"host"`
+			Result string `json:"result"`
+			Error  string `json:"error"`
+		}
+
+		err := json.Unmarshal([]byte(l), &r)
+		if err != nil {
+			t.Fatalf("unable to unmarshal %s: %s", l, err)
+		}
+
+		if r.Result != expected[i] {
+			t.Errorf("%s: expected %s, got %s", r.Host, expected[i], r.Result)
+		}
+	}
+
+	if !strings.Contains(lines[1], `"error":"broken"`) {
+		t.Fatalf("expected error of b, got %s", lines[1])
+	}
+}
+
+func TestFailures(t *testing.T) {
+	e := Executor{Parallel: 1}
+	results := e.Execute(context.Background(), collection("a", "b", "c"), failOn("b"))
+
+	var out bytes.Buffer
+	err := Failures(&out, results)
+
+	var fleetErr *Error
+	if !errors.As(err, &fleetErr) || fleetErr.ExitCode() != 2 {
+		t.Fatalf("expected partial failure, got %v", err)
+	}
+
+	if out.String() != "b: broken\nc: skipped\n" {
+		t.Fatalf("unexpected failures:\n%s", out.String())
+	}
+
+	out.Reset()
+	results = e.Execute(context.Background(), collection("a"), failOn(""))
+	if Failures(&out, results) != nil || out.Len() != 0 {
+		t.Fatalf("expected no failures, got:\n%s", out.String())
+	}
+}
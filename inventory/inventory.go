@@ -0,0 +1,180 @@
+// Package inventory reads the device inventory, a yaml file naming the
+// controllers of a site along with how to reach them, e.g.
+//
+//	devices:
+//	  rig3-genset1:
+//	    address: 10.20.3.21
+//	    username: admin
+//	    credentials: env:RIG3_PASSWORD
+//	    proxyjump: [jump@bastion.aarhus.example]
+//	    servername: rig3-genset1.local
+//	    labels:
+//	      site: aarhus
+//	      rig: "3"
+//	groups:
+//	  rig3: [rig3-genset1, rig3-genset2]
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Device is a single controller of the inventory
+type Device struct {
+	// Name is the key of the device in the inventory
+	Name string `yaml:"-"`
+
+	// Address is the host[:port] of the bsp rest api
+	Address string `yaml:"address"`
+
+	// Username and Credentials override the ones given on the command line,
+	// see Password for the format of Credentials.
+	Username    string `yaml:"username,omitempty"`
+	Credentials string `yaml:"credentials,omitempty"`
+
+	// ProxyJump overrides the ssh jump hosts given on the command line
+	ProxyJump []string `yaml:"proxyjump,omitempty"`
+
+	// ServerName overrides the name the certificate of the device is verified
+	// against, e.g. its .local hostname when it is reached by ip address.
+	ServerName string `yaml:"servername,omitempty"`
+
+	// Serial is the serial number of the device, if known. It is
+	// used to look up credentials.
+	Serial string `yaml:"serial,omitempty"`
+
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// Password resolves the credentials reference of the device, references
+// are either env:NAME, reading the environment variable NAME, or file:PATH
+// reading the first line of the file at PATH. The password is empty if
+// the device has no credentials reference.
+func (d *Device) Password() (string, error) {
+	if d.Credentials == "" {
+		return "", nil
+	}
+
+	kind, ref, _ := strings.Cut(d.Credentials, ":")
+	switch kind {
+	case "env":
+		p, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", d.Name, ref)
+		}
+		return p, nil
+
+	case "file":
+		p, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("%s: unable to read credentials: %w", d.Name, err)
+		}
+		line, _, _ := strings.Cut(string(p), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+
+	return "", fmt.Errorf("%s: unknown credentials reference %q, expected env:NAME or file:PATH", d.Name, d.Credentials)
+}
+
+type Inventory struct {
+	Devices map[string]*Device  `yaml:"devices"`
+	Groups  map[string][]string `yaml:"groups,omitempty"`
+}
+
+// DefaultPath is where the inventory is read from, unless told otherwise
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "iectl", "inventory.yaml"), nil
+}
+
+// Load reads and validates the inventory at path
+func Load(path string) (*Inventory, error) {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory: %w", err)
+	}
+
+	inv := &Inventory{}
+	err = yaml.Unmarshal(p, inv)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse inventory %s: %w", path, err)
+	}
+
+	errs := make([]error, 0)
+	for name, d := range inv.Devices {
+		if d == nil {
+			d = &Device{}
+			inv.Devices[name] = d
+		}
+		d.Name = name
+
+		if d.Address == "" {
+			errs = append(errs, fmt.Errorf("device %s has no address", name))
+		}
+	}
+
+	for group, members := range inv.Groups {
+		for _, name := range members {
+			_, exists := inv.Devices[name]
+			if !exists {
+				errs = append(errs, fmt.Errorf("group %s: unknown device %s", group, name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid inventory %s: %w", path, errors.Join(errs...))
+	}
+
+	return inv, nil
+}
+
+// Device returns the device called name
+func (i *Inventory) Device(name string) (*Device, bool) {
+	d, exists := i.Devices[name]
+	return d, exists
+}
+
+// All returns every device, sorted by name
+func (i *Inventory) All() []*Device {
+	devices := make([]*Device, 0, len(i.Devices))
+	for _, name := range slices.Sorted(maps.Keys(i.Devices)) {
+		devices = append(devices, i.Devices[name])
+	}
+
+	return devices
+}
+
+// Group returns the devices of the named groups, sorted by name
+func (i *Inventory) Group(names ...string) ([]*Device, error) {
+	members := make(map[string]struct{})
+	for _, group := range names {
+		devices, exists := i.Groups[group]
+		if !exists {
+			return nil, fmt.Errorf("unknown group %s", group)
+		}
+
+		for _, d := range devices {
+			members[d] = struct{}{}
+		}
+	}
+
+	devices := make([]*Device, 0, len(members))
+	for _, name := range slices.Sorted(maps.Keys(members)) {
+		devices = append(devices, i.Devices[name])
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,179 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const example = `
+devices:
+  rig3-genset1:
+    address: 10.20.3.21
+    credentials: env:IECTL_TEST_PASSWORD
+    proxyjump: [jump@bastion.aarhus.example]
+    labels:
+      site: aarhus
+      rig: "3"
+  rig3-genset2:
+    address: 10.20.3.22
+    labels:
+      site: aarhus
+      rig: "3"
+  lab:
+    address: ie250-0bad0c.local
+    username: service
+    labels:
+      site: lab
+groups:
+  rig3: [rig3-genset1, rig3-genset2]
+  everything: [rig3-genset1, rig3-genset2, lab]
+`
+
+func write(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write inventory: %s", err)
+	}
+
+	return path
+}
+
+func names(devices []*Device) string {
+	n := make([]string, 0, len(devices))
+	for _, d := range devices {
+		n = append(n, d.Name)
+	}
+	return strings.Join(n, ",")
+}
+
+func TestLoad(t *testing.T) {
+	inv, err := Load(write(t, example))
+	if err != nil {
+		t.Fatalf("unable to load: %s", err)
+	}
+
+	d, exists := inv.Device("rig3-genset1")
+	if !exists {
+		t.Fatalf("expected rig3-genset1 to exist")
+	}
+
+	if d.Name != "rig3-genset1" || d.Address != "10.20.3.21" || d.ProxyJump[0] != "jump@bastion.aarhus.example" || d.Labels["rig"] != "3" {
+		t.Fatalf("unexpected device: %+v", d)
+	}
+
+	if names(inv.All()) != "lab,rig3-genset1,rig3-genset2" {
+		t.Fatalf("expected all devices sorted, got %s", names(inv.All()))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load(write(t, `
+devices:
+  nowhere: {}
+groups:
+  rig3: [ghost]
+`))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, v := range []string{"nowhere has no address", "unknown device ghost"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Errorf("expected error to contain %q, got %s", v, err)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	inv, err := Load(write(t, example))
+	if err != nil {
+		t.Fatalf("unable to load: %s", err)
+	}
+
+	devices, err := inv.Group("rig3", "everything")
+	if err != nil {
+		t.Fatalf("unable to get groups: %s", err)
+	}
+
+	if names(devices) != "lab,rig3-genset1,rig3-genset2" {
+		t.Fatalf("expected devices once each, got %s", names(devices))
+	}
+
+	_, err = inv.Group("rig4")
+	if err == nil {
+		t.Fatalf("expected an error for an unknown group")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	inv, err := Load(write(t, example))
+	if err != nil {
+		t.Fatalf("unable to load: %s", err)
+	}
+
+	cases := map[string]string{
+		"site=aarhus":        "rig3-genset1,rig3-genset2",
+		"site=aarhus,rig=3":  "rig3-genset1,rig3-genset2",
+		"site==lab":          "lab",
+		"site!=aarhus":       "lab",
+		"rig":                "rig3-genset1,rig3-genset2",
+		"!rig":               "lab",
+		"site=aarhus, rig=4": "",
+	}
+
+	for selector, expected := range cases {
+		s, err := ParseSelector(selector)
+		if err != nil {
+			t.Errorf("%s: unable to parse: %s", selector, err)
+			continue
+		}
+
+		got := names(s.Select(inv.All()))
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", selector, expected, got)
+		}
+	}
+
+	for _, v := range []string{"", "=aarhus", ",,"} {
+		_, err := ParseSelector(v)
+		if err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	t.Setenv("IECTL_TEST_PASSWORD", "from-env")
+	d := Device{Name: "a", Credentials: "env:IECTL_TEST_PASSWORD"}
+	p, err := d.Password()
+	if err != nil || p != "from-env" {
+		t.Fatalf("expected password from env, got %q %v", p, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(path, []byte("from-file\n"), 0o600)
+	d = Device{Name: "a", Credentials: "file:" + path}
+	p, err = d.Password()
+	if err != nil || p != "from-file" {
+		t.Fatalf("expected password from file, got %q %v", p, err)
+	}
+
+	d = Device{Name: "a"}
+	p, err = d.Password()
+	if err != nil || p != "" {
+		t.Fatalf("expected no password, got %q %v", p, err)
+	}
+
+	for _, v := range []string{"env:IECTL_TEST_UNSET", "hunter2"} {
+		d = Device{Name: "a", Credentials: v}
+		_, err = d.Password()
+		if err == nil {
+			t.Errorf("%s: expected an error", v)
+		}
+	}
+}
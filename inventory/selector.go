@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+)
+
+type requirement struct {
+	key    string
+	value  string
+	negate bool
+
+	// exists only checks for the presence of the label
+	exists bool
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	if r.exists {
+		return ok != r.negate
+	}
+
+	return (ok && v == r.value) != r.negate
+}
+
+// Selector matches devices by their labels, much like kubernetes
+// equality based label selectors.
+type Selector []requirement
+
+// ParseSelector parses a comma separated list of requirements, which all
+// have to match. Requirements are key=value, key!=value, key (the label
+// is set) and !key (the label is not set) e.g. site=aarhus,rig!=3
+func ParseSelector(s string) (Selector, error) {
+	selector := make(Selector, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		var r requirement
+		switch {
+		case strings.Contains(v, "!="):
+			r.key, r.value, _ = strings.Cut(v, "!=")
+			r.negate = true
+		case strings.Contains(v, "="):
+			r.key, r.value, _ = strings.Cut(v, "=")
+			r.value = strings.TrimPrefix(r.value, "=")
+		case strings.HasPrefix(v, "!"):
+			r.key = strings.TrimPrefix(v, "!")
+			r.exists = true
+			r.negate = true
+		default:
+			r.key = v
+			r.exists = true
+		}
+
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if r.key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing label name", v)
+		}
+
+		selector = append(selector, r)
+	}
+
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	return selector, nil
+}
+
+// Matches reports if d satisfies every requirement of s
+func (s Selector) Matches(d *Device) bool {
+	for _, r := range s {
+		if !r.matches(d.Labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Select returns the devices matching s
+func (s Selector) Select(devices []*Device) []*Device {
+	selected := make([]*Device, 0)
+	for _, d := range devices {
+		if s.Matches(d) {
+			selected = append(selected, d)
+		}
+	}
+
+	return selected
+}
@@ -3,96 +3,273 @@ package mdns
 import (
 	"context"
 	"errors"
-	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
+// retryInterval is how often a failing browser retries
+const retryInterval = 5 * time.Second
+
+// listen is Listen, tests replace it
+var listen = Listen
+
+const (
+	// DefaultService is the service type announced by DEIF controllers
+	DefaultService = "_base-unit-deif._tcp"
+
+	// DefaultDomain is where mDNS lives
+	DefaultDomain = "local"
+)
+
 type Browser struct {
-	Question dns.Question
+	// Service is the service type to browse for, DefaultService if empty.
+	Service string
+
+	// Domain to browse, DefaultDomain if empty. Other domains than
+	// local are browsed using unicast dns only (wide-area DNS-SD).
+	Domain string
+
+	// Interfaces limits browsing to the named network interfaces,
+	// all multicast capable interfaces are used if empty.
+	Interfaces []string
+
+	// Server is a unicast dns server, host or host:port, which is
+	// browsed in addition to mDNS. Other domains than local default
+	// to the first server of the system resolver.
+	Server string
+}
+
+func (b *Browser) domain() string {
+	if b.Domain == "" {
+		return DefaultDomain
+	}
+
+	return strings.Trim(b.Domain, ".")
+}
+
+// name is the fully qualified name browsed, e.g. _base-unit-deif._tcp.local.
+func (b *Browser) name() string {
+	service := b.Service
+	if service == "" {
+		service = DefaultService
+	}
+
+	return dns.Fqdn(strings.Trim(service, ".") + "." + b.domain())
 }
 
-func (b *Browser) Run(ctx context.Context) (chan []*Target, error) {
-	dnsChan, err := Listen(ctx)
+func (b *Browser) multicast() bool {
+	return strings.EqualFold(b.domain(), DefaultDomain)
+}
+
+// Run browses for instances of the service until ctx is cancelled,
+// every change to the set of known targets is emitted as an Event.
+//
+// Failing to send queries or listen for answers is reported as Error
+// events, the browser keeps retrying until ctx is cancelled - network
+// interfaces may come and go while browsing.
+func (b *Browser) Run(ctx context.Context) (chan Event, error) {
+	server, err := b.unicastServer()
 	if err != nil {
 		return nil, err
 	}
 
+	var dnsChan chan Message
+	if b.multicast() {
+		dnsChan, err = listen(ctx, b.Interfaces...)
+		if err != nil && !errors.Is(err, ErrNoInterfaces) {
+			return nil, err
+		}
+	}
+
+	// the query routine hands over listeners and errors
+	// to the event routine, which owns the events channel.
+	// if we could not listen, the query routine will keep trying.
+	listeners := make(chan chan Message)
+	errs := make(chan error)
+	listening := dnsChan != nil
+
+	// the event routine tells the query routine to listen
+	// again, once the listener fails.
+	relisten := make(chan struct{}, 1)
+
 	queryMsg := dns.Msg{}
-	queryMsg.SetQuestion(b.Question.Name, b.Question.Qtype)
-	go func() {
+	queryMsg.SetQuestion(b.name(), dns.TypePTR)
+	query := func() {
 		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+
 		round := 1
 		for {
-			err := Query(queryMsg)
-			if err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					continue
+			var err error
+			if !listening {
+				var c chan Message
+				c, err = listen(ctx, b.Interfaces...)
+				if err == nil {
+					listening = true
+					select {
+					case listeners <- c:
+					case <-ctx.Done():
+						return
+					}
 				}
+			}
 
-				panic(err) // FIXME: not optimal
+			if err == nil {
+				err = Query(queryMsg, b.Interfaces...)
 			}
 
-			timer.Reset(expDuration(round))
+			wait := expDuration(round)
 			round++
 
+			if err != nil {
+				// retry at a steady pace, once we are back in
+				// business, start over with the quick rounds.
+				wait = retryInterval
+				round = 1
+
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			timer.Reset(wait)
+
 			// Wait until the timer fires or the context is cancelled
 			select {
 			case <-ctx.Done():
 				return
+			case <-relisten:
+				// the interface might be back already, try right away
+				listening = false
+				round = 1
 			case <-timer.C:
-				continue
 			}
 
 		}
-	}()
+	}
+
+	if b.multicast() {
+		go query()
+	}
+
+	// unicast servers are walked periodically, as there is
+	// nobody announcing changes.
+	unicastChan := make(chan Message)
+	if server != "" {
+		go func() {
+			timer := time.NewTimer(0)
+			defer timer.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+
+				err := unicastBrowse(ctx, server, b.name(), unicastChan)
+				if err != nil && ctx.Err() == nil {
+					select {
+					case errs <- err:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				timer.Reset(unicastInterval)
+			}
+		}()
+	}
 
-	targets := make([]*Target, 0)
-	index := make(map[string]*Target)
-	updates := make(chan []*Target)
+	events := make(chan Event)
 
 	go func() {
-		for {
-			msg, ok := <-dnsChan
-			if !ok {
-				close(updates)
-				break
+		defer close(events)
+
+		c := newCache(b.name())
+
+		// records are expired at this interval
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		// nobody might be listening anymore, the listener
+		// still needs to be drained to shut down properly.
+		drain := func() {
+			if dnsChan == nil {
+				return
 			}
-			for _, a := range msg.Answer {
-				switch answer := a.(type) {
-				case *dns.PTR:
-					for _, v := range msg.Answer {
-						if v.Header().Name == b.Question.Name {
-							q := dns.Msg{}
-							q.SetQuestion(dns.Fqdn(answer.Ptr), dns.TypeSRV)
-							Query(q)
-						}
-					}
-				case *dns.SRV:
-					if !strings.HasSuffix(answer.Header().Name, b.Question.Name) {
-						// We didnt ask for this
-						continue
-					}
-					name := strings.TrimRight(answer.Target, ".")
-					t, exists := index[name]
-					if exists {
-						continue
+			go func() {
+				for range dnsChan {
+				}
+			}()
+		}
+
+		for {
+			var batch []Event
+			select {
+			case msg, ok := <-dnsChan:
+				if !ok {
+					// reading failed, we are told why before the
+					// channel is closed - listen again.
+					dnsChan = nil
+					select {
+					case relisten <- struct{}{}:
+					default:
 					}
+					continue
+				}
+
+				if msg.Err != nil {
+					batch = []Event{{Type: Error, Err: msg.Err, Time: time.Now()}}
+					break
+				}
+
+				var queries []dns.Msg
+				batch, queries = c.handle(msg, time.Now())
+				for _, q := range queries {
+					Query(q, b.Interfaces...)
+				}
+
+			case msg := <-unicastChan:
+				// the unicast routine asks for everything by itself
+				batch, _ = c.handle(msg, time.Now())
+
+			case l := <-listeners:
+				dnsChan = l
 
-					t = &Target{Hostname: name}
-					index[name] = t
-					targets = append(targets, t)
+			case err := <-errs:
+				batch = []Event{{Type: Error, Err: err, Time: time.Now()}}
+
+			case now := <-ticker.C:
+				batch = c.expire(now)
+
+			case <-ctx.Done():
+				drain()
+				return
+			}
+
+			if len(batch) == 0 {
+				continue
+			}
 
-					updates <- targets
+			targets := c.snapshot()
+			for _, e := range batch {
+				e.Targets = targets
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					drain()
+					return
 				}
 			}
 		}
 	}()
 
-	return updates, nil
+	return events, nil
 }
 
 // expDuration targets a sequence like
@@ -110,25 +287,3 @@ func expDuration(i int) time.Duration {
 	return backoff
 
 }
-
-type Target struct {
-	Hostname string
-
-	Marked bool
-}
-
-func (t *Target) Title() string {
-	if !t.Marked {
-		return t.Hostname
-	}
-
-	return fmt.Sprintf(">> %s", t.Hostname)
-}
-
-func (t *Target) Description() string {
-	return fmt.Sprintf("https://%s/", t.Hostname)
-}
-
-func (t *Target) FilterValue() string {
-	return t.Hostname
-}
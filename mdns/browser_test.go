@@ -0,0 +1,170 @@
+package mdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTargetAddress(t *testing.T) {
+	cases := []struct {
+		target Target
+		useIP  bool
+		want   string
+	}{
+		{Target{Hostname: "iE250-0bad0c.local", Port: 443}, false, "iE250-0bad0c.local"},
+		{Target{Hostname: "iE250-0bad0c.local", Port: 8443}, false, "iE250-0bad0c.local:8443"},
+		{Target{Hostname: "iE250-0bad0c.local"}, true, "iE250-0bad0c.local"},
+		{Target{
+			Hostname: "iE250-0bad0c.local",
+			Port:     443,
+			IPv4:     []netip.Addr{netip.MustParseAddr("192.168.2.21")},
+		}, true, "192.168.2.21"},
+		{Target{
+			Hostname: "iE250-0bad0c.local",
+			Port:     8443,
+			IPv6:     []netip.Addr{netip.MustParseAddr("fe80::1%eth0")},
+		}, true, "[fe80::1%eth0]:8443"},
+		{Target{
+			Hostname: "iE250-0bad0c.local",
+			IPv6:     []netip.Addr{netip.MustParseAddr("fd00::2")},
+		}, true, "[fd00::2]"},
+	}
+
+	for _, c := range cases {
+		got := c.target.Address(c.useIP)
+		if got != c.want {
+			t.Errorf("%+v: expected %s, got %s", c.target, c.want, got)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	text := parseText([]string{"Model=iE250", "serial=2300000001", "model=ignored", "flag", "=novalue"})
+
+	if text["model"] != "iE250" {
+		t.Errorf("expected first model to win, got %q", text["model"])
+	}
+
+	if text["serial"] != "2300000001" {
+		t.Errorf("unexpected serial %q", text["serial"])
+	}
+
+	v, exists := text["flag"]
+	if !exists || v != "" {
+		t.Errorf("expected boolean attribute flag")
+	}
+
+	if len(text) != 3 {
+		t.Errorf("expected 3 keys, got %v", text)
+	}
+}
+
+func TestSelectedInterface(t *testing.T) {
+	if !selected(nil, "") || !selected(nil, "eth0") {
+		t.Fatalf("everything should be selected when no interfaces are named")
+	}
+
+	if !selected([]string{"eth0", "eth1"}, "eth1") {
+		t.Fatalf("eth1 should be selected")
+	}
+
+	if selected([]string{"eth0"}, "docker0") || selected([]string{"eth0"}, "") {
+		t.Fatalf("only eth0 should be selected")
+	}
+}
+
+func TestLookupUnknownInterface(t *testing.T) {
+	_, err := lookupInterfaces([]string{"does-not-exist0"})
+	if err == nil {
+		t.Fatalf("expected an error looking up an unknown interface")
+	}
+}
+
+func TestNoInterfaces(t *testing.T) {
+	ifaces := []net.Interface{
+		{Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Name: "usb0", Flags: net.FlagMulticast},
+	}
+
+	err := usable(ifaces)
+	if !errors.Is(err, ErrNoInterfaces) {
+		t.Fatalf("expected ErrNoInterfaces, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "usb0: interface is not up") {
+		t.Fatalf("expected the reason for skipping usb0, got %q", err)
+	}
+
+	ifaces = append(ifaces, net.Interface{Name: "eth0", Flags: net.FlagUp | net.FlagMulticast})
+	err = usable(ifaces)
+	if err != nil {
+		t.Fatalf("eth0 should be usable, got %s", err)
+	}
+}
+
+func TestErrorEventJSON(t *testing.T) {
+	e := Event{Type: Error, Err: ErrNoInterfaces, Time: time.Unix(0, 0).UTC()}
+	p, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("unable to marshal: %s", err)
+	}
+
+	expected := `{"event":"error","error":"no multicast-capable interfaces","time":"1970-01-01T00:00:00Z"}`
+	if string(p) != expected {
+		t.Fatalf("expected %s, got %s", expected, p)
+	}
+}
+
+func TestBrowserListensAgain(t *testing.T) {
+	// the listener reads from a plain socket, closing it is
+	// what happens when an interface goes away.
+	conns := make(chan *net.UDPConn, 2)
+	listen = func(ctx context.Context, interfaces ...string) (chan Message, error) {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return nil, err
+		}
+		conns <- conn
+		return receive(ctx, interfaces, []*net.UDPConn{conn}, []packetReader{ipv4Reader(conn)}), nil
+	}
+	t.Cleanup(func() { listen = Listen })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := Browser{}
+	events, err := b.Run(ctx)
+	if err != nil {
+		t.Fatalf("unable to browse: %s", err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	select {
+	case conn := <-conns:
+		conn.Close()
+	case <-deadline:
+		t.Fatalf("browser never listened")
+	}
+
+	// events have to be read, for the browser to carry on
+	var reported, listening bool
+	for !reported || !listening {
+		select {
+		case e := <-events:
+			if e.Type == Error && strings.Contains(e.Err.Error(), "unable to read mDNS packet") {
+				reported = true
+			}
+		case conn := <-conns:
+			conn.Close()
+			listening = true
+		case <-deadline:
+			t.Fatalf("expected the read error reported (%t), and to listen again (%t)", reported, listening)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package mdns
+
+import (
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxStaleness caps the lifetime of cached records. Shared records like PTR
+// usually live for 75 minutes, which is a long time to show a controller
+// that was unplugged - as we keep querying at least every minute, anything
+// that stays quiet for a few rounds is considered gone.
+const maxStaleness = 3 * time.Minute
+
+// instance is a single service instance, e.g.
+// iE250-0bad0c._base-unit-deif._tcp.local.
+type instance struct {
+	target  Target
+	expires time.Time
+
+	// added is set once an Added event have been emitted
+	added bool
+}
+
+func (i *instance) refresh(now time.Time, ttl time.Duration) {
+	i.expires = now.Add(min(ttl, maxStaleness))
+}
+
+// cache keeps track of the records answering the service question,
+// honouring ttl's and goodbye packets (records with a ttl of zero).
+type cache struct {
+	service string
+
+	// instances are kept in the order they were found, and
+	// indexed by their lowercase instance name.
+	instances []*instance
+	index     map[string]*instance
+
+	// addresses are announced per hostname, not per instance
+	hosts     map[string]map[netip.Addr]time.Time
+	resolving map[string]struct{}
+}
+
+func newCache(service string) *cache {
+	return &cache{
+		service:   dns.Fqdn(service),
+		index:     make(map[string]*instance),
+		hosts:     make(map[string]map[netip.Addr]time.Time),
+		resolving: make(map[string]struct{}),
+	}
+}
+
+func (c *cache) ours(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), strings.ToLower(c.service))
+}
+
+func (c *cache) instance(name string) *instance {
+	key := strings.ToLower(name)
+	i, exists := c.index[key]
+	if exists {
+		return i
+	}
+
+	i = &instance{}
+	c.index[key] = i
+	c.instances = append(c.instances, i)
+
+	return i
+}
+
+// handle applies the records of msg, it returns the resulting events
+// and any queries needed to fully resolve the instances found.
+func (c *cache) handle(msg Message, now time.Time) ([]Event, []dns.Msg) {
+	events := make([]Event, 0)
+	queries := make([]dns.Msg, 0)
+	changed := make(map[*instance]bool)
+	pointed := make(map[string]*instance)
+	located := make(map[string]struct{})
+
+	// answers are handled before additional records, as these
+	// often hold addresses of the host in the answer.
+	records := append(slices.Clone(msg.Answer), msg.Extra...)
+	for _, rr := range records {
+		ttl := time.Duration(rr.Header().Ttl) * time.Second
+		name := rr.Header().Name
+
+		switch record := rr.(type) {
+		case *dns.PTR:
+			if !strings.EqualFold(name, c.service) {
+				continue
+			}
+
+			if ttl == 0 {
+				events = append(events, c.remove(record.Ptr, now)...)
+				continue
+			}
+
+			i := c.instance(record.Ptr)
+			i.refresh(now, ttl)
+			pointed[record.Ptr] = i
+
+		case *dns.SRV:
+			if !c.ours(name) {
+				// We didnt ask for this
+				continue
+			}
+
+			if ttl == 0 {
+				events = append(events, c.remove(name, now)...)
+				continue
+			}
+
+			i := c.instance(name)
+			i.refresh(now, ttl)
+
+			hostname := strings.TrimRight(record.Target, ".")
+			if i.target.Hostname != hostname || i.target.Port != record.Port {
+				i.target.Hostname = hostname
+				i.target.Port = record.Port
+				i.target.Interface = msg.Interface
+				changed[i] = true
+			}
+
+			located[hostname] = struct{}{}
+
+		case *dns.TXT:
+			if !c.ours(name) || ttl == 0 {
+				continue
+			}
+
+			i := c.instance(name)
+			text := parseText(record.Txt)
+			if !maps.Equal(i.target.Text, text) {
+				i.target.Text = text
+				changed[i] = true
+			}
+
+		case *dns.A, *dns.AAAA:
+			hostname := strings.TrimRight(name, ".")
+			addr, ok := recordAddr(rr, msg.Interface)
+			if !ok {
+				continue
+			}
+
+			addrs := c.hosts[hostname]
+			if addrs == nil {
+				addrs = make(map[netip.Addr]time.Time)
+				c.hosts[hostname] = addrs
+			}
+
+			_, known := addrs[addr]
+			if ttl == 0 {
+				delete(addrs, addr)
+			} else {
+				addrs[addr] = now.Add(min(ttl, maxStaleness))
+			}
+
+			// new addresses and goodbyes to known ones are changes,
+			// refreshes and goodbyes to unknown ones are not.
+			if known == (ttl == 0) {
+				c.touchHost(hostname, changed)
+			}
+		}
+	}
+
+	// ask for whatever the responder did not include
+	for name, i := range pointed {
+		if i.target.Hostname != "" {
+			continue
+		}
+
+		q := dns.Msg{}
+		q.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
+		q.Question = append(q.Question, dns.Question{Name: dns.Fqdn(name), Qtype: dns.TypeTXT, Qclass: dns.ClassINET})
+		queries = append(queries, q)
+	}
+
+	for hostname := range located {
+		_, asked := c.resolving[hostname]
+		if len(c.hosts[hostname]) > 0 || asked {
+			continue
+		}
+
+		c.resolving[hostname] = struct{}{}
+		q := dns.Msg{}
+		q.SetQuestion(dns.Fqdn(hostname), dns.TypeA)
+		q.Question = append(q.Question, dns.Question{Name: dns.Fqdn(hostname), Qtype: dns.TypeAAAA, Qclass: dns.ClassINET})
+		queries = append(queries, q)
+	}
+
+	return append(events, c.events(changed, now)...), queries
+}
+
+// expire removes instances and addresses that have outlived their ttl
+func (c *cache) expire(now time.Time) []Event {
+	events := make([]Event, 0)
+	for _, i := range slices.Clone(c.instances) {
+		if now.After(i.expires) {
+			events = append(events, c.removeInstance(i, now)...)
+		}
+	}
+
+	changed := make(map[*instance]bool)
+	for hostname, addrs := range c.hosts {
+		for addr, expires := range addrs {
+			if now.After(expires) {
+				delete(addrs, addr)
+				c.touchHost(hostname, changed)
+			}
+		}
+
+		// forget that we asked, so we ask again
+		if len(addrs) == 0 {
+			delete(c.resolving, hostname)
+		}
+	}
+
+	return append(events, c.events(changed, now)...)
+}
+
+// touchHost marks every instance on hostname as changed
+func (c *cache) touchHost(hostname string, changed map[*instance]bool) {
+	for _, i := range c.instances {
+		if i.target.Hostname == hostname {
+			changed[i] = true
+		}
+	}
+}
+
+// events turns changed instances into Added or Updated events,
+// instances are only reported once they have a hostname.
+func (c *cache) events(changed map[*instance]bool, now time.Time) []Event {
+	events := make([]Event, 0)
+	for _, i := range c.instances {
+		if !changed[i] || i.target.Hostname == "" {
+			continue
+		}
+
+		e := Event{Type: Updated, Target: c.target(i), Time: now}
+		if !i.added {
+			e.Type = Added
+			i.added = true
+		}
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func (c *cache) remove(name string, now time.Time) []Event {
+	i, exists := c.index[strings.ToLower(name)]
+	if !exists {
+		return nil
+	}
+
+	return c.removeInstance(i, now)
+}
+
+func (c *cache) removeInstance(i *instance, now time.Time) []Event {
+	for k, v := range c.index {
+		if v == i {
+			delete(c.index, k)
+		}
+	}
+
+	c.instances = slices.DeleteFunc(c.instances, func(v *instance) bool { return v == i })
+
+	if !i.added {
+		return nil
+	}
+
+	return []Event{{Type: Removed, Target: c.target(i), Time: now}}
+}
+
+// target returns a copy of the target of i, with its current addresses
+func (c *cache) target(i *instance) Target {
+	t := i.target
+	t.Text = maps.Clone(i.target.Text)
+
+	addrs := slices.SortedFunc(maps.Keys(c.hosts[t.Hostname]), netip.Addr.Compare)
+	for _, a := range addrs {
+		if a.Is4() {
+			t.IPv4 = append(t.IPv4, a)
+		} else {
+			t.IPv6 = append(t.IPv6, a)
+		}
+	}
+
+	return t
+}
+
+// snapshot returns copies of every target that have been resolved
+func (c *cache) snapshot() []*Target {
+	s := make([]*Target, 0, len(c.instances))
+	for _, i := range c.instances {
+		if !i.added {
+			continue
+		}
+
+		t := c.target(i)
+		s = append(s, &t)
+	}
+
+	return s
+}
+
+func recordAddr(rr dns.RR, iface string) (netip.Addr, bool) {
+	var ip net.IP
+	switch v := rr.(type) {
+	case *dns.A:
+		ip = v.A
+	case *dns.AAAA:
+		ip = v.AAAA
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return addr, false
+	}
+	addr = addr.Unmap()
+
+	// link-local addresses are useless without knowing the interface
+	if addr.Is6() && addr.IsLinkLocalUnicast() && iface != "" {
+		addr = addr.WithZone(iface)
+	}
+
+	return addr, true
+}
+
+// parseText turns key=value pairs of a TXT record into a map,
+// keys are case insensitive and the first occurrence wins (RFC 6763 6.4).
+func parseText(txt []string) map[string]string {
+	text := make(map[string]string)
+	for _, v := range txt {
+		key, value, _ := strings.Cut(v, "=")
+		key = strings.ToLower(key)
+		if key == "" {
+			continue
+		}
+
+		_, exists := text[key]
+		if exists {
+			continue
+		}
+		text[key] = value
+	}
+
+	return text
+}
@@ -0,0 +1,155 @@
+package mdns
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const service = "_base-unit-deif._tcp.local."
+
+func announcement(ttl uint32) Message {
+	instance := "iE250-0bad0c." + service
+	msg := dns.Msg{}
+	msg.Response = true
+	msg.Answer = []dns.RR{
+		&dns.PTR{Hdr: dns.RR_Header{Name: service, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl}, Ptr: instance},
+	}
+	msg.Extra = []dns.RR{
+		&dns.SRV{Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: ttl}, Target: "iE250-0bad0c.local.", Port: 443},
+		&dns.TXT{Hdr: dns.RR_Header{Name: instance, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl}, Txt: []string{"model=iE250"}},
+		&dns.A{Hdr: dns.RR_Header{Name: "iE250-0bad0c.local.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}, A: net.ParseIP("192.168.2.21")},
+	}
+
+	return Message{Msg: msg, Interface: "eth0"}
+}
+
+func TestCacheAdded(t *testing.T) {
+	c := newCache(service)
+	now := time.Now()
+
+	events, queries := c.handle(announcement(120), now)
+	if len(events) != 1 || events[0].Type != Added {
+		t.Fatalf("expected a single added event, got %+v", events)
+	}
+
+	target := events[0].Target
+	if target.Hostname != "iE250-0bad0c.local" || target.Interface != "eth0" || target.Text["model"] != "iE250" {
+		t.Fatalf("unexpected target: %+v", target)
+	}
+
+	if len(target.IPv4) != 1 || target.IPv4[0].String() != "192.168.2.21" {
+		t.Fatalf("unexpected addresses: %+v", target.IPv4)
+	}
+
+	// everything was in the additional records, no need to ask for more
+	if len(queries) != 0 {
+		t.Fatalf("expected no queries, got %d", len(queries))
+	}
+
+	// the same announcement again is not a change
+	events, _ = c.handle(announcement(120), now.Add(time.Second))
+	if len(events) != 0 {
+		t.Fatalf("expected no events on refresh, got %+v", events)
+	}
+}
+
+func TestCacheResolve(t *testing.T) {
+	c := newCache(service)
+
+	msg := announcement(120)
+	msg.Extra = nil
+
+	events, queries := c.handle(msg, time.Now())
+	if len(events) != 0 {
+		t.Fatalf("an instance without SRV should not be reported, got %+v", events)
+	}
+
+	if len(queries) != 1 || queries[0].Question[0].Qtype != dns.TypeSRV {
+		t.Fatalf("expected a SRV query, got %+v", queries)
+	}
+}
+
+func TestCacheUpdated(t *testing.T) {
+	c := newCache(service)
+	now := time.Now()
+	c.handle(announcement(120), now)
+
+	msg := announcement(120)
+	msg.Extra[1].(*dns.TXT).Txt = []string{"model=iE250", "version=2.0.10.0"}
+
+	events, _ := c.handle(msg, now)
+	if len(events) != 1 || events[0].Type != Updated || events[0].Target.Text["version"] != "2.0.10.0" {
+		t.Fatalf("expected an updated event, got %+v", events)
+	}
+}
+
+func TestCacheGoodbye(t *testing.T) {
+	c := newCache(service)
+	now := time.Now()
+	c.handle(announcement(120), now)
+
+	events, _ := c.handle(announcement(0), now)
+	if len(events) != 1 || events[0].Type != Removed {
+		t.Fatalf("expected a removed event, got %+v", events)
+	}
+
+	if len(c.snapshot()) != 0 {
+		t.Fatalf("expected no targets after goodbye")
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	c := newCache(service)
+	now := time.Now()
+	c.handle(announcement(10), now)
+
+	events := c.expire(now.Add(5 * time.Second))
+	if len(events) != 0 {
+		t.Fatalf("nothing should expire yet, got %+v", events)
+	}
+
+	events = c.expire(now.Add(11 * time.Second))
+	if len(events) != 1 || events[0].Type != Removed {
+		t.Fatalf("expected a removed event, got %+v", events)
+	}
+}
+
+func TestCacheMaxStaleness(t *testing.T) {
+	c := newCache(service)
+	now := time.Now()
+	c.handle(announcement(4500), now)
+
+	events := c.expire(now.Add(maxStaleness + time.Second))
+	if len(events) != 1 || events[0].Type != Removed {
+		t.Fatalf("expected a removed event, got %+v", events)
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	c := newCache(service)
+	events, _ := c.handle(announcement(120), time.Now())
+
+	p, err := json.Marshal(events[0])
+	if err != nil {
+		t.Fatalf("unable to marshal: %s", err)
+	}
+
+	var e Event
+	err = json.Unmarshal(p, &e)
+	if err != nil {
+		t.Fatalf("unable to unmarshal %s: %s", p, err)
+	}
+
+	if e.Type != Added || e.Target.Hostname != "iE250-0bad0c.local" || e.Target.IPv4[0] != events[0].Target.IPv4[0] {
+		t.Fatalf("unexpected event after roundtrip: %s", p)
+	}
+
+	if !strings.HasPrefix(string(p), `{"event":"added","target":{"hostname":"iE250-0bad0c.local"`) {
+		t.Fatalf("unexpected json: %s", p)
+	}
+}
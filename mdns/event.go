@@ -0,0 +1,81 @@
+package mdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type EventType int
+
+const (
+	// Added is emitted the first time a target is fully resolved
+	Added EventType = iota + 1
+	// Updated is emitted when anything about a known target changes
+	Updated
+	// Removed is emitted when a target says goodbye or its records expire
+	Removed
+	// Error is emitted when browsing fails, the browser keeps retrying
+	Error
+)
+
+func (e EventType) String() string {
+	switch e {
+	case Added:
+		return "added"
+	case Updated:
+		return "updated"
+	case Removed:
+		return "removed"
+	case Error:
+		return "error"
+	}
+
+	return fmt.Sprintf("EventType(%d)", int(e))
+}
+
+func (e EventType) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *EventType) UnmarshalText(text []byte) error {
+	for _, t := range []EventType{Added, Updated, Removed, Error} {
+		if t.String() == string(text) {
+			*e = t
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown event type: %q", text)
+}
+
+// Event describes a change to the set of targets known by a Browser
+type Event struct {
+	Type   EventType `json:"event"`
+	Target Target    `json:"target"`
+	Time   time.Time `json:"time"`
+
+	// Err is set on Error events, Target is empty on those.
+	Err error `json:"-"`
+
+	// Targets holds every target known, after the event
+	Targets []*Target `json:"-"`
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	if e.Type != Error {
+		return json.Marshal(event(e))
+	}
+
+	var msg string
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Type  EventType `json:"event"`
+		Error string    `json:"error"`
+		Time  time.Time `json:"time"`
+	}{e.Type, msg, e.Time})
+}
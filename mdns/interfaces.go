@@ -0,0 +1,91 @@
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// ErrNoInterfaces is returned when there is nothing to send or receive
+// mDNS on, e.g. when the only network adapter was unplugged.
+var ErrNoInterfaces = errors.New("no multicast-capable interfaces")
+
+// lookupInterfaces looks up the named interfaces, if no names are given
+// every interface on the system is returned.
+func lookupInterfaces(names []string) ([]net.Interface, error) {
+	if len(names) == 0 {
+		return net.Interfaces()
+	}
+
+	ifaces := make([]net.Interface, 0, len(names))
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		ifaces = append(ifaces, *iface)
+	}
+
+	return ifaces, nil
+}
+
+// multicastCapable returns an error describing why iface cannot be used
+// for mDNS, or nil if it can.
+func multicastCapable(iface net.Interface) error {
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("%s: interface is not up", iface.Name)
+	}
+
+	if iface.Flags&net.FlagLoopback != 0 {
+		return fmt.Errorf("%s: loopback interface", iface.Name)
+	}
+
+	if iface.Flags&net.FlagPointToPoint != 0 {
+		return fmt.Errorf("%s: interface is point to point", iface.Name)
+	}
+
+	return nil
+}
+
+// usable returns an error wrapping ErrNoInterfaces, if none of
+// ifaces are multicast capable.
+func usable(ifaces []net.Interface) error {
+	skipped := make([]error, 0, len(ifaces))
+	for _, iface := range ifaces {
+		err := multicastCapable(iface)
+		if err == nil {
+			return nil
+		}
+		skipped = append(skipped, err)
+	}
+
+	return noInterfaces(skipped)
+}
+
+// noInterfaces wraps ErrNoInterfaces with the reasons every
+// interface was skipped.
+func noInterfaces(errs []error) error {
+	if len(errs) == 0 {
+		return ErrNoInterfaces
+	}
+
+	reasons := make([]string, 0, len(errs))
+	for _, err := range errs {
+		reasons = append(reasons, err.Error())
+	}
+
+	return fmt.Errorf("%w: %s", ErrNoInterfaces, strings.Join(reasons, ", "))
+}
+
+// selected reports if a message received on iface should be used,
+// when interfaces are named, messages from unknown interfaces are dropped.
+func selected(names []string, iface string) bool {
+	if len(names) == 0 {
+		return true
+	}
+
+	return slices.Contains(names, iface)
+}
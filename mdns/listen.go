@@ -9,6 +9,8 @@ import (
 	"sync"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 type ErrListen struct {
@@ -32,58 +34,185 @@ func (e *ErrListen) Error() string {
 	return "No error.... go figure"
 }
 
-func Listen(ctx context.Context) (chan dns.Msg, error) {
+// Message is a dns message as received by Listen
+type Message struct {
+	dns.Msg
+
+	// Source is the address of the sender
+	Source *net.UDPAddr
+
+	// Interface is the name of the interface the message
+	// was received on, it is empty if unknown.
+	Interface string
+
+	// Err is set if reading failed, it is the last message
+	// before the channel is closed.
+	Err error
+}
+
+// packetReader reads a single packet, returning the index of the
+// interface it was received on or zero if unknown.
+type packetReader func(b []byte) (n int, ifIndex int, src net.Addr, err error)
+
+func ipv4Reader(conn *net.UDPConn) packetReader {
+	p := ipv4.NewPacketConn(conn)
+
+	// not every platform supports this, the interface will
+	// be guessed from the source address instead.
+	_ = p.SetControlMessage(ipv4.FlagInterface, true)
+
+	return func(b []byte) (int, int, net.Addr, error) {
+		n, cm, src, err := p.ReadFrom(b)
+		if cm == nil {
+			return n, 0, src, err
+		}
+		return n, cm.IfIndex, src, err
+	}
+}
+
+func ipv6Reader(conn *net.UDPConn) packetReader {
+	p := ipv6.NewPacketConn(conn)
+	_ = p.SetControlMessage(ipv6.FlagInterface, true)
+
+	return func(b []byte) (int, int, net.Addr, error) {
+		n, cm, src, err := p.ReadFrom(b)
+		if cm == nil {
+			return n, 0, src, err
+		}
+		return n, cm.IfIndex, src, err
+	}
+}
+
+// listenMulticast joins the mDNS group on the given interfaces with a
+// single socket, or on the system default interface if none are given.
+func listenMulticast(network string, group net.IP, ifaces []net.Interface) (*net.UDPConn, error) {
+	addr := net.UDPAddr{IP: group, Port: 5353}
+	if len(ifaces) == 0 {
+		return net.ListenMulticastUDP(network, nil, &addr)
+	}
+
+	var (
+		conn *net.UDPConn
+		errs []error
+	)
+
+	for _, iface := range ifaces {
+		err := multicastCapable(iface)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// the first usable interface creates the socket
+		if conn == nil {
+			conn, err = net.ListenMulticastUDP(network, &iface, &addr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", iface.Name, err))
+			}
+			continue
+		}
+
+		if network == "udp4" {
+			err = ipv4.NewPacketConn(conn).JoinGroup(&iface, &addr)
+		} else {
+			err = ipv6.NewPacketConn(conn).JoinGroup(&iface, &addr)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", iface.Name, err))
+		}
+	}
+
+	if conn == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	return conn, nil
+}
+
+// Listen receives mDNS messages until ctx is cancelled. If interfaces are
+// named, only messages received on those are passed on.
+func Listen(ctx context.Context, interfaces ...string) (chan Message, error) {
 	listeners := make([]*net.UDPConn, 0, 2)
+	readers := make([]packetReader, 0, 2)
 	listenErr := ErrListen{}
 
-	// try to listen for udp4 mDNS packets
-	addr := net.UDPAddr{
-		IP:   net.ParseIP("224.0.0.251"),
-		Port: 5353,
+	var ifaces []net.Interface
+	if len(interfaces) > 0 {
+		var err error
+		ifaces, err = lookupInterfaces(interfaces)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find interface: %w", err)
+		}
 	}
 
-	conn, err := net.ListenMulticastUDP("udp4", nil, &addr)
+	// try to listen for udp4 mDNS packets
+	conn, err := listenMulticast("udp4", net.ParseIP("224.0.0.251"), ifaces)
 	if err != nil {
 		listenErr.udp4 = err
 	} else {
 		listeners = append(listeners, conn)
+		readers = append(readers, ipv4Reader(conn))
 	}
 
 	// try to listen for udp6 mDNS packets
-	addr = net.UDPAddr{
-		IP:   net.ParseIP("ff02::fb"),
-		Port: 5353,
-	}
-
-	conn, err = net.ListenMulticastUDP("udp6", nil, &addr)
+	conn, err = listenMulticast("udp6", net.ParseIP("ff02::fb"), ifaces)
 	if err != nil {
 		listenErr.udp6 = err
 	} else {
 		listeners = append(listeners, conn)
+		readers = append(readers, ipv6Reader(conn))
 	}
 
 	// if both failed, we cannot continue
 	if len(listeners) == 0 {
+		if len(ifaces) == 0 {
+			ifaces, _ = net.Interfaces()
+		}
+
+		// tell the user if there was nothing to listen on to begin with
+		err := usable(ifaces)
+		if err != nil {
+			return nil, err
+		}
+
 		return nil, fmt.Errorf("no mDNS listeners made it: %w", &listenErr)
 	}
 
+	return receive(ctx, interfaces, listeners, readers), nil
+}
+
+// receive passes on the messages read from listeners until ctx is cancelled.
+// Should reading fail, e.g. the interface went away, the error is passed on
+// as the last message and the channel is closed - Listen again to carry on.
+func receive(ctx context.Context, interfaces []string, listeners []*net.UDPConn, readers []packetReader) chan Message {
+	// a failing reader takes down the others too
+	ctx, cancel := context.WithCancel(ctx)
+
 	// we need the ability to wait for parsers to be shutdown
 	// as simply closing the channel might cause a panic if a
 	// parser tries to send on it
 	var wg sync.WaitGroup
 
-	c := make(chan dns.Msg)
-	parse := func(c chan dns.Msg, conn *net.UDPConn) {
+	c := make(chan Message)
+	parse := func(c chan Message, read packetReader) {
+		defer wg.Done()
+
 		buffer := make([]byte, 65536)
 		for {
-			n, _, err := conn.ReadFromUDP(buffer)
-			if errors.Is(err, net.ErrClosed) {
-				break
-			}
+			n, ifIndex, src, err := read(buffer)
 			if err != nil {
-				log.Printf("Error reading packet: %v", err)
-				break
+				// we closed it ourselves
+				if ctx.Err() != nil {
+					return
+				}
 
+				select {
+				case c <- Message{Err: fmt.Errorf("unable to read mDNS packet: %w", err)}:
+				case <-ctx.Done():
+				}
+				cancel()
+				return
 			}
 
 			var msg dns.Msg
@@ -92,12 +221,24 @@ func Listen(ctx context.Context) (chan dns.Msg, error) {
 				continue
 			}
 
-			c <- msg
+			udpAddr, _ := src.(*net.UDPAddr)
+			iface := interfaceName(ifIndex, udpAddr)
+
+			// the socket is bound to the mDNS port on every interface,
+			// so it may see packets from groups joined by others.
+			if !selected(interfaces, iface) {
+				continue
+			}
+
+			c <- Message{
+				Msg:       msg,
+				Source:    udpAddr,
+				Interface: iface,
+			}
 		}
-		wg.Done()
 	}
 
-	for _, v := range listeners {
+	for _, v := range readers {
 		wg.Add(1)
 		go parse(c, v)
 	}
@@ -106,7 +247,7 @@ func Listen(ctx context.Context) (chan dns.Msg, error) {
 		<-ctx.Done()
 		for _, v := range listeners {
 			err := v.Close()
-			if err != nil {
+			if err != nil && !errors.Is(err, net.ErrClosed) {
 				log.Printf("could not close mDNS listener: %s", err)
 			}
 		}
@@ -118,5 +259,47 @@ func Listen(ctx context.Context) (chan dns.Msg, error) {
 		close(c)
 	}()
 
-	return c, nil
+	return c
+}
+
+// interfaceName finds the name of the interface a packet from src
+// was received on. If the platform did not tell us the interface index,
+// we settle for the zone of ipv6 link-local addresses, or the interface
+// having a network containing src.
+func interfaceName(ifIndex int, src *net.UDPAddr) string {
+	if ifIndex > 0 {
+		iface, err := net.InterfaceByIndex(ifIndex)
+		if err == nil {
+			return iface.Name
+		}
+	}
+
+	if src == nil {
+		return ""
+	}
+
+	if src.Zone != "" {
+		return src.Zone
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if ok && ipNet.Contains(src.IP) {
+				return iface.Name
+			}
+		}
+	}
+
+	return ""
 }
@@ -7,11 +7,15 @@ import (
 	"sync"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 // Query will emit dns messages to the mDNS multicast addresses
 // it is up to the caller to listen for anwsers beforhand.
-func Query(msg dns.Msg) error {
+// The message is sent on the named interfaces, or on every
+// multicast capable interface if none are named.
+func Query(msg dns.Msg, interfaces ...string) error {
 	payload, err := msg.Pack()
 	if err != nil {
 		return fmt.Errorf("unable to marshal dns message: %w", err)
@@ -26,13 +30,13 @@ func Query(msg dns.Msg) error {
 
 	wg.Add(1)
 	go func() {
-		ipv4Err = queryIPv4(payload)
+		ipv4Err = queryIPv4(payload, interfaces)
 		wg.Done()
 	}()
 
 	wg.Add(1)
 	go func() {
-		ipv6Err = queryIPv6(payload)
+		ipv6Err = queryIPv6(payload, interfaces)
 		wg.Done()
 	}()
 
@@ -40,6 +44,11 @@ func Query(msg dns.Msg) error {
 
 	// only return error if everything fails ...
 	// time will tell if: this was a good choice :)
+	if errors.Is(ipv4Err, ErrNoInterfaces) && errors.Is(ipv6Err, ErrNoInterfaces) {
+		// the reasons are the same for both
+		return ipv4Err
+	}
+
 	if ipv4Err != nil && ipv6Err != nil {
 		return fmt.Errorf("both ipv4 and ipv6 failed on all interfaces\nipv4:%w\nipv6:%w", ipv4Err, ipv6Err)
 	}
@@ -47,7 +56,7 @@ func Query(msg dns.Msg) error {
 	return nil
 }
 
-func queryIPv6(payload []byte) error {
+func queryIPv6(payload []byte, names []string) error {
 	multicastAddr := "[ff02::fb]:5353"
 	udpAddr, err := net.ResolveUDPAddr("udp", multicastAddr)
 	if err != nil {
@@ -55,28 +64,22 @@ func queryIPv6(payload []byte) error {
 
 	}
 
-	// Get all available network interfaces
-	interfaces, err := net.Interfaces()
+	// Get the selected, or all available network interfaces
+	ifaces, err := lookupInterfaces(names)
 	if err != nil {
 		return fmt.Errorf("error getting interfaces: %w", err)
 
 	}
 
-	errs := make([]error, 0, len(interfaces))
-	for _, iface := range interfaces {
-		// Skip down or loopback interfaces
-		if iface.Flags&net.FlagUp == 0 {
-			errs = append(errs, fmt.Errorf("%s: interface is not up", iface.Name))
-			continue
-		}
-
-		if iface.Flags&net.FlagLoopback != 0 {
-			errs = append(errs, fmt.Errorf("%s: loopback interface", iface.Name))
-			continue
-		}
-
-		if iface.Flags&net.FlagPointToPoint != 0 {
-			errs = append(errs, fmt.Errorf("%s: interface is point to point", iface.Name))
+	// interfaces not even worth trying are kept apart, so we
+	// can tell the user when there is nothing to query on.
+	skipped := make([]error, 0, len(ifaces))
+	errs := make([]error, 0, len(ifaces))
+	for _, iface := range ifaces {
+		// Skip down, loopback and point to point interfaces
+		err := multicastCapable(iface)
+		if err != nil {
+			skipped = append(skipped, err)
 			continue
 		}
 
@@ -89,6 +92,10 @@ func queryIPv6(payload []byte) error {
 
 		defer conn.Close()
 
+		// ListenMulticastUDP disables multicast loopback, but we want
+		// listeners on this host (e.g. mock-device) to hear us as well.
+		_ = ipv6.NewPacketConn(conn).SetMulticastLoopback(true)
+
 		_, err = conn.WriteToUDP(payload, udpAddr)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("%s: failed to send udp4 dns query: %w", iface.Name, err))
@@ -96,14 +103,18 @@ func queryIPv6(payload []byte) error {
 		}
 	}
 
-	if len(errs) == len(interfaces) {
-		return fmt.Errorf("all interfaces failed\n%w", errors.Join(errs...))
+	if len(skipped) == len(ifaces) {
+		return noInterfaces(skipped)
+	}
+
+	if len(errs)+len(skipped) == len(ifaces) {
+		return fmt.Errorf("all interfaces failed\n%w", errors.Join(append(errs, skipped...)...))
 	}
 
 	return nil
 }
 
-func queryIPv4(payload []byte) error {
+func queryIPv4(payload []byte, names []string) error {
 	multicastAddr := "224.0.0.251:5353"
 	udpAddr, err := net.ResolveUDPAddr("udp", multicastAddr)
 	if err != nil {
@@ -111,28 +122,22 @@ func queryIPv4(payload []byte) error {
 
 	}
 
-	// Get all available network interfaces
-	interfaces, err := net.Interfaces()
+	// Get the selected, or all available network interfaces
+	ifaces, err := lookupInterfaces(names)
 	if err != nil {
 		return fmt.Errorf("error getting interfaces: %w", err)
 
 	}
 
-	errs := make([]error, 0, len(interfaces))
-	for _, iface := range interfaces {
-		// Skip down or loopback interfaces
-		if iface.Flags&net.FlagUp == 0 {
-			errs = append(errs, fmt.Errorf("%s: interface is not up", iface.Name))
-			continue
-		}
-
-		if iface.Flags&net.FlagLoopback != 0 {
-			errs = append(errs, fmt.Errorf("%s: loopback interface", iface.Name))
-			continue
-		}
-
-		if iface.Flags&net.FlagPointToPoint != 0 {
-			errs = append(errs, fmt.Errorf("%s: interface is point to point", iface.Name))
+	// interfaces not even worth trying are kept apart, so we
+	// can tell the user when there is nothing to query on.
+	skipped := make([]error, 0, len(ifaces))
+	errs := make([]error, 0, len(ifaces))
+	for _, iface := range ifaces {
+		// Skip down, loopback and point to point interfaces
+		err := multicastCapable(iface)
+		if err != nil {
+			skipped = append(skipped, err)
 			continue
 		}
 
@@ -145,6 +150,10 @@ func queryIPv4(payload []byte) error {
 
 		defer conn.Close()
 
+		// ListenMulticastUDP disables multicast loopback, but we want
+		// listeners on this host (e.g. mock-device) to hear us as well.
+		_ = ipv4.NewPacketConn(conn).SetMulticastLoopback(true)
+
 		_, err = conn.WriteToUDP(payload, udpAddr)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("%s: failed to send udp4 dns query: %w", iface.Name, err))
@@ -152,8 +161,12 @@ func queryIPv4(payload []byte) error {
 		}
 	}
 
-	if len(errs) == len(interfaces) {
-		return fmt.Errorf("all interfaces failed\n%w", errors.Join(errs...))
+	if len(skipped) == len(ifaces) {
+		return noInterfaces(skipped)
+	}
+
+	if len(errs)+len(skipped) == len(ifaces) {
+		return fmt.Errorf("all interfaces failed\n%w", errors.Join(append(errs, skipped...)...))
 	}
 
 	return nil
@@ -0,0 +1,227 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Responder answers mDNS queries for a single service instance,
+// making it discoverable by Browser.
+type Responder struct {
+	// Service is the fully qualified service type, e.g. _base-unit-deif._tcp.local.
+	Service string
+
+	// Instance is the instance name, without the service suffix
+	Instance string
+
+	// Hostname is the fully qualified host name, e.g. iE250-0bad0c.local.
+	Hostname string
+
+	Port uint16
+	Text []string
+
+	// IPs announced for Hostname, if empty - the addresses of all
+	// multicast capable interfaces are announced.
+	IPs []net.IP
+}
+
+const responderTTL = 120
+
+func (r *Responder) instanceName() string {
+	return dns.Fqdn(r.Instance + "." + r.Service)
+}
+
+func (r *Responder) ips() ([]net.IP, error) {
+	if len(r.IPs) != 0 {
+		return r.IPs, nil
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("error getting interfaces: %w", err)
+	}
+
+	ips := make([]net.IP, 0)
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	return ips, nil
+}
+
+func (r *Responder) ptr(ttl uint32) dns.RR {
+	return &dns.PTR{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(r.Service), Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: ttl},
+		Ptr: r.instanceName(),
+	}
+}
+
+func (r *Responder) srv(ttl uint32) dns.RR {
+	return &dns.SRV{
+		Hdr:    dns.RR_Header{Name: r.instanceName(), Rrtype: dns.TypeSRV, Class: dns.ClassINET | cacheFlush, Ttl: ttl},
+		Target: dns.Fqdn(r.Hostname),
+		Port:   r.Port,
+	}
+}
+
+func (r *Responder) txt(ttl uint32) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: r.instanceName(), Rrtype: dns.TypeTXT, Class: dns.ClassINET | cacheFlush, Ttl: ttl},
+		Txt: r.Text,
+	}
+}
+
+func (r *Responder) addresses(ttl uint32, qtype uint16) ([]dns.RR, error) {
+	ips, err := r.ips()
+	if err != nil {
+		return nil, err
+	}
+
+	rrs := make([]dns.RR, 0, len(ips))
+	for _, ip := range ips {
+		hdr := dns.RR_Header{Name: dns.Fqdn(r.Hostname), Class: dns.ClassINET | cacheFlush, Ttl: ttl}
+		if ip4 := ip.To4(); ip4 != nil && qtype != dns.TypeAAAA {
+			hdr.Rrtype = dns.TypeA
+			rrs = append(rrs, &dns.A{Hdr: hdr, A: ip4})
+		}
+		if ip.To4() == nil && qtype != dns.TypeA {
+			hdr.Rrtype = dns.TypeAAAA
+			rrs = append(rrs, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+
+	return rrs, nil
+}
+
+// cacheFlush is the mDNS cache-flush bit of the class field, it tells
+// receivers that this record replaces whatever they had cached.
+const cacheFlush = 1 << 15
+
+// announcement holds every record we are authoritative for
+func (r *Responder) announcement(ttl uint32) (dns.Msg, error) {
+	msg := dns.Msg{}
+	msg.Response = true
+	msg.Authoritative = true
+	msg.Answer = []dns.RR{r.ptr(ttl), r.srv(ttl), r.txt(ttl)}
+
+	addrs, err := r.addresses(ttl, dns.TypeANY)
+	if err != nil {
+		return msg, err
+	}
+	msg.Answer = append(msg.Answer, addrs...)
+
+	return msg, nil
+}
+
+// answer returns a response to the questions of q that we know the answer to
+func (r *Responder) answer(q dns.Msg) (dns.Msg, bool) {
+	msg := dns.Msg{}
+	msg.Response = true
+	msg.Authoritative = true
+
+	for _, question := range q.Question {
+		name := question.Name
+		qtype := question.Qtype
+		switch {
+		case strings.EqualFold(name, dns.Fqdn(r.Service)) && (qtype == dns.TypePTR || qtype == dns.TypeANY):
+			msg.Answer = append(msg.Answer, r.ptr(responderTTL))
+			msg.Extra = append(msg.Extra, r.srv(responderTTL), r.txt(responderTTL))
+			addrs, _ := r.addresses(responderTTL, dns.TypeANY)
+			msg.Extra = append(msg.Extra, addrs...)
+
+		case strings.EqualFold(name, r.instanceName()) && qtype == dns.TypeSRV:
+			msg.Answer = append(msg.Answer, r.srv(responderTTL))
+			addrs, _ := r.addresses(responderTTL, dns.TypeANY)
+			msg.Extra = append(msg.Extra, addrs...)
+
+		case strings.EqualFold(name, r.instanceName()) && qtype == dns.TypeTXT:
+			msg.Answer = append(msg.Answer, r.txt(responderTTL))
+
+		case strings.EqualFold(name, r.instanceName()) && qtype == dns.TypeANY:
+			msg.Answer = append(msg.Answer, r.srv(responderTTL), r.txt(responderTTL))
+
+		case strings.EqualFold(name, dns.Fqdn(r.Hostname)):
+			addrs, _ := r.addresses(responderTTL, qtype)
+			msg.Answer = append(msg.Answer, addrs...)
+		}
+	}
+
+	return msg, len(msg.Answer) > 0
+}
+
+// Run announces the instance and answers queries until ctx is cancelled,
+// at which point a goodbye is sent, telling browsers we are gone.
+func (r *Responder) Run(ctx context.Context) error {
+	dnsChan, err := Listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	announcement, err := r.announcement(responderTTL)
+	if err != nil {
+		return fmt.Errorf("unable to build announcement: %w", err)
+	}
+
+	// mDNS responses are sent the same way as queries
+	err = Query(announcement)
+	if err != nil {
+		return fmt.Errorf("unable to announce: %w", err)
+	}
+
+	var readErr error
+	for msg := range dnsChan {
+		if msg.Err != nil {
+			readErr = msg.Err
+			continue
+		}
+
+		if msg.Response {
+			continue
+		}
+
+		resp, ok := r.answer(msg.Msg)
+		if !ok {
+			continue
+		}
+
+		err := Query(resp)
+		if err != nil {
+			log.Printf("unable to answer mDNS query: %s", err)
+		}
+	}
+
+	goodbye, err := r.announcement(0)
+	if err != nil {
+		return fmt.Errorf("unable to build goodbye: %w", err)
+	}
+
+	err = Query(goodbye)
+	if readErr != nil {
+		return readErr
+	}
+
+	return err
+}
@@ -0,0 +1,54 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestResponderAnswer(t *testing.T) {
+	r := Responder{
+		Service:  "_base-unit-deif._tcp.local",
+		Instance: "iE250-0bad0c",
+		Hostname: "iE250-0bad0c.local",
+		Port:     8443,
+		Text:     []string{"model=iE250"},
+		IPs:      []net.IP{net.ParseIP("192.168.2.21"), net.ParseIP("fe80::1")},
+	}
+
+	q := dns.Msg{}
+	q.SetQuestion("_base-unit-deif._tcp.local.", dns.TypePTR)
+	resp, ok := r.answer(q)
+	if !ok {
+		t.Fatalf("expected an answer to the PTR question")
+	}
+
+	ptr, ok := resp.Answer[0].(*dns.PTR)
+	if !ok || ptr.Ptr != "iE250-0bad0c._base-unit-deif._tcp.local." {
+		t.Fatalf("unexpected PTR answer: %v", resp.Answer[0])
+	}
+
+	q.SetQuestion(ptr.Ptr, dns.TypeSRV)
+	resp, ok = r.answer(q)
+	if !ok {
+		t.Fatalf("expected an answer to the SRV question")
+	}
+
+	srv, ok := resp.Answer[0].(*dns.SRV)
+	if !ok || srv.Target != "iE250-0bad0c.local." || srv.Port != 8443 {
+		t.Fatalf("unexpected SRV answer: %v", resp.Answer[0])
+	}
+
+	q.SetQuestion("iE250-0bad0c.local.", dns.TypeA)
+	resp, _ = r.answer(q)
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != dns.TypeA {
+		t.Fatalf("expected exactly one A record, got: %v", resp.Answer)
+	}
+
+	q.SetQuestion("someone-else.local.", dns.TypeA)
+	_, ok = r.answer(q)
+	if ok {
+		t.Fatalf("should not answer for other hosts")
+	}
+}
@@ -0,0 +1,48 @@
+package mdns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Target struct {
+	Hostname  string            `json:"hostname"`
+	Port      uint16            `json:"port,omitempty"`
+	IPv4      []netip.Addr      `json:"ipv4,omitempty"`
+	IPv6      []netip.Addr      `json:"ipv6,omitempty"`
+	Interface string            `json:"interface,omitempty"`
+	Text      map[string]string `json:"txt,omitempty"`
+
+	Marked bool `json:"-"`
+}
+
+// Address returns host:port suitable for reaching the bsp rest api of the
+// target. The port is left out if it is the https default. If useIP is set,
+// the first known address is used instead of the hostname.
+func (t *Target) Address(useIP bool) string {
+	host := t.Hostname
+	if useIP {
+		addrs := append(slices.Clone(t.IPv4), t.IPv6...)
+		if len(addrs) > 0 {
+			host = addrs[0].String()
+		}
+	}
+
+	if t.Port == 0 || t.Port == 443 {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(t.Port)))
+}
+
+// URL returns the url of the web interface of the target
+func (t *Target) URL() string {
+	return fmt.Sprintf("https://%s/", t.Address(false))
+}
@@ -0,0 +1,116 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// unicastInterval is how often a unicast dns server is asked,
+// it must stay well within maxStaleness.
+const unicastInterval = 30 * time.Second
+
+// resolvConf holds the system dns servers, used when browsing
+// other domains than local without an explicit server.
+var resolvConf = "/etc/resolv.conf"
+
+// unicastServer returns the dns server to browse, or an empty string
+// if only mDNS should be used.
+func (b *Browser) unicastServer() (string, error) {
+	if b.Server != "" {
+		_, _, err := net.SplitHostPort(b.Server)
+		if err != nil {
+			return net.JoinHostPort(b.Server, "53"), nil
+		}
+		return b.Server, nil
+	}
+
+	if b.multicast() {
+		return "", nil
+	}
+
+	conf, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil {
+		return "", fmt.Errorf("no dns server given for %s, and unable to read system servers: %w", b.domain(), err)
+	}
+
+	if len(conf.Servers) == 0 {
+		return "", fmt.Errorf("no dns server given for %s, and none found in %s", b.domain(), resolvConf)
+	}
+
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+// unicastBrowse walks the PTR, SRV, TXT and address records of name using
+// server (RFC 6763 wide-area DNS-SD), every response is passed on to c.
+func unicastBrowse(ctx context.Context, server, name string, c chan<- Message) error {
+	client := dns.Client{Timeout: 5 * time.Second}
+	source, _ := net.ResolveUDPAddr("udp", server)
+
+	exchange := func(name string, qtype uint16) (*dns.Msg, error) {
+		q := dns.Msg{}
+		q.SetQuestion(dns.Fqdn(name), qtype)
+
+		resp, _, err := client.ExchangeContext(ctx, &q, server)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to query %s: %w", server, name, err)
+		}
+
+		if resp.Rcode != dns.RcodeSuccess {
+			return nil, fmt.Errorf("%s: %s %s: %s", server, dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+		}
+
+		select {
+		case c <- Message{Msg: *resp, Source: source}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		return resp, nil
+	}
+
+	ptrs, err := exchange(name, dns.TypePTR)
+	if err != nil {
+		return err
+	}
+
+	// a single misconfigured instance should not hide the others
+	var errs []error
+	for _, rr := range ptrs.Answer {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok {
+			continue
+		}
+
+		_, err = exchange(ptr.Ptr, dns.TypeTXT)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		srvs, err := exchange(ptr.Ptr, dns.TypeSRV)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, rr := range srvs.Answer {
+			srv, ok := rr.(*dns.SRV)
+			if !ok {
+				continue
+			}
+
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				_, err = exchange(srv.Target, qtype)
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
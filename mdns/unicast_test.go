@@ -0,0 +1,129 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// zone is a tiny authoritative dns server for wide-area DNS-SD
+func zone(t *testing.T, records ...string) string {
+	t.Helper()
+
+	rrs := make([]dns.RR, 0, len(records))
+	for _, r := range records {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			t.Fatalf("invalid record %q: %s", r, err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := dns.Msg{}
+		resp.SetReply(r)
+		resp.Authoritative = true
+		resp.Rcode = dns.RcodeNameError
+
+		q := r.Question[0]
+		for _, rr := range rrs {
+			if !dns.IsSubDomain(q.Name, rr.Header().Name) {
+				continue
+			}
+
+			// the name exists, even if it has no records of this type
+			resp.Rcode = dns.RcodeSuccess
+			if rr.Header().Rrtype == q.Qtype {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+
+		_ = w.WriteMsg(&resp)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+
+	srv := dns.Server{PacketConn: conn, Handler: handler}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestUnicastBrowse(t *testing.T) {
+	server := zone(t,
+		"_base-unit-deif._tcp.plant.example. 300 IN PTR iE250-0bad0c._base-unit-deif._tcp.plant.example.",
+		"iE250-0bad0c._base-unit-deif._tcp.plant.example. 300 IN SRV 0 0 443 ie250-0bad0c.plant.example.",
+		`iE250-0bad0c._base-unit-deif._tcp.plant.example. 300 IN TXT "model=iE250"`,
+		"ie250-0bad0c.plant.example. 300 IN A 10.20.0.21",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b := Browser{Domain: "plant.example", Server: server}
+	events, err := b.Run(ctx)
+	if err != nil {
+		t.Fatalf("unable to browse: %s", err)
+	}
+
+	for e := range events {
+		if e.Type == Error {
+			t.Fatalf("unexpected error: %s", e.Err)
+		}
+
+		if len(e.Target.IPv4) == 0 {
+			continue
+		}
+
+		if e.Target.Hostname != "ie250-0bad0c.plant.example" || e.Target.IPv4[0].String() != "10.20.0.21" || e.Target.Text["model"] != "iE250" {
+			t.Fatalf("unexpected target: %+v", e.Target)
+		}
+
+		return
+	}
+
+	t.Fatalf("found nothing before deadline")
+}
+
+func TestUnicastUnknownService(t *testing.T) {
+	server := zone(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b := Browser{Domain: "plant.example", Server: server}
+	events, err := b.Run(ctx)
+	if err != nil {
+		t.Fatalf("unable to browse: %s", err)
+	}
+
+	e := <-events
+	if e.Type != Error {
+		t.Fatalf("expected an error event, got %s", e.Type)
+	}
+}
+
+func TestBrowserName(t *testing.T) {
+	cases := []struct {
+		browser Browser
+		want    string
+	}{
+		{Browser{}, "_base-unit-deif._tcp.local."},
+		{Browser{Domain: "plant.example."}, "_base-unit-deif._tcp.plant.example."},
+		{Browser{Service: "_http._tcp"}, "_http._tcp.local."},
+	}
+
+	for _, c := range cases {
+		got := c.browser.name()
+		if got != c.want {
+			t.Errorf("%+v: expected %s, got %s", c.browser, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type field struct {
+	key   string
+	value string
+}
+
+// flatten turns the json representation of r into dotted paths and
+// their values, in the order they are marshalled.
+func flatten(r any) ([]field, error) {
+	p, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal json: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	fields := make([]field, 0)
+	err = walk(dec, "", &fields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to flatten json: %w", err)
+	}
+
+	return fields, nil
+}
+
+func walk(dec *json.Decoder, path string, fields *[]field) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	// plain values at the top have no name
+	key := path
+	if key == "" {
+		key = "value"
+	}
+
+	switch v := t.(type) {
+	case json.Delim:
+		for i := 0; dec.More(); i++ {
+			name := strconv.Itoa(i)
+			if v == '{' {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				name = k.(string)
+			}
+
+			err := walk(dec, join(name), fields)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the closing delimiter
+		_, err := dec.Token()
+		return err
+
+	case nil:
+		*fields = append(*fields, field{key, ""})
+	case string:
+		*fields = append(*fields, field{key, v})
+	case json.Number:
+		*fields = append(*fields, field{key, v.String()})
+	case bool:
+		*fields = append(*fields, field{key, strconv.FormatBool(v)})
+	}
+
+	return nil
+}
+
+// tabulate flattens every record into a row, the columns are every
+// field seen, in the order they are first seen.
+func tabulate(list []any) ([]string, [][]string, error) {
+	columns := make([]string, 0)
+	index := make(map[string]int)
+	records := make([]map[string]string, 0, len(list))
+
+	for _, r := range list {
+		fields, err := flatten(r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		values := make(map[string]string, len(fields))
+		for _, f := range fields {
+			_, known := index[f.key]
+			if !known {
+				index[f.key] = len(columns)
+				columns = append(columns, f.key)
+			}
+			values[f.key] = f.value
+		}
+		records = append(records, values)
+	}
+
+	rows := make([][]string, 0, len(records))
+	for _, values := range records {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = values[c]
+		}
+		rows = append(rows, row)
+	}
+
+	return columns, rows, nil
+}
@@ -0,0 +1,320 @@
+// Package output renders the results of commands in the format asked
+// for using --output, one of text, json, ndjson, yaml, csv or table, or
+// through a Go template given with --template.
+//
+// Results are rendered through their json representation, so field
+// names are the same in every format: nested fields are flattened to
+// dotted paths for csv and table (software.active, interfaces.0.ifname)
+// and templates see the json field names, e.g. {{.host}}.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	// Text is the human readable output of each command, commands
+	// without one of their own fall back to Table.
+	Text     Format = "text"
+	JSON     Format = "json"
+	NDJSON   Format = "ndjson"
+	YAML     Format = "yaml"
+	CSV      Format = "csv"
+	Table    Format = "table"
+	Template Format = "template"
+)
+
+var formats = []Format{Text, JSON, NDJSON, YAML, CSV, Table, Template}
+
+// Printer renders records in Format
+type Printer struct {
+	Format Format
+
+	// Out receives the output, os.Stdout if nil
+	Out io.Writer
+
+	template *template.Template
+}
+
+// New returns a printer for format, text is used if format is empty.
+// text is the template used by the template format.
+func New(format string, text string) (*Printer, error) {
+	p := &Printer{Format: Format(strings.ToLower(format))}
+	if p.Format == "" {
+		p.Format = Text
+	}
+
+	// a template implies the template format
+	if text != "" && p.Format == Text {
+		p.Format = Template
+	}
+
+	valid := false
+	for _, f := range formats {
+		valid = valid || f == p.Format
+	}
+	if !valid {
+		return nil, fmt.Errorf("unknown output format %q, use one of %s", format, formatList())
+	}
+
+	if p.Format == Template {
+		if text == "" {
+			return nil, fmt.Errorf("template output needs --template")
+		}
+
+		t, err := template.New("output").Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template: %w", err)
+		}
+		p.template = t
+	} else if text != "" {
+		return nil, fmt.Errorf("--template cannot be used with --output %s", p.Format)
+	}
+
+	return p, nil
+}
+
+func formatList() string {
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, string(f))
+	}
+	return strings.Join(names, ", ")
+}
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		p, err := json.Marshal(v)
+		return string(p), err
+	},
+	"join": func(v []any, sep string) string {
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			s = append(s, fmt.Sprint(e))
+		}
+		return strings.Join(s, sep)
+	},
+}
+
+// AddFlags adds --output, --template and the --json shorthand to flags
+func AddFlags(flags *pflag.FlagSet) {
+	flags.BoolP("json", "j", false, "output as json, short for --output json")
+	flags.StringP("output", "o", "", fmt.Sprintf("output format, one of %s", formatList()))
+	flags.String("template", "", "render each result using a Go template, e.g. '{{.host}} {{.hostname}}'")
+}
+
+// FromFlags returns a printer as asked for by the flags added by AddFlags
+func FromFlags(flags *pflag.FlagSet) (*Printer, error) {
+	format, _ := flags.GetString("output")
+	text, _ := flags.GetString("template")
+
+	asJson, _ := flags.GetBool("json")
+	if asJson {
+		if format != "" && Format(format) != JSON {
+			return nil, fmt.Errorf("--json cannot be used with --output %s", format)
+		}
+		format = string(JSON)
+	}
+
+	return New(format, text)
+}
+
+// Structured is true if the output is meant for machines, commands
+// print their human readable output only if it is not.
+func (p *Printer) Structured() bool {
+	return p.Format != Text
+}
+
+func (p *Printer) out() io.Writer {
+	if p.Out == nil {
+		return os.Stdout
+	}
+	return p.Out
+}
+
+// Print renders records, which is either a slice of records or a single
+// one. Json renders slices as an array, every other format renders
+// each record on its own (a line, a row or a document).
+func (p *Printer) Print(records any) error {
+	list := items(records)
+
+	switch p.Format {
+	case JSON:
+		return p.json(records)
+	case NDJSON:
+		return p.ndjson(list)
+	case YAML:
+		return p.yaml(records)
+	case CSV:
+		return p.csv(list)
+	case Template:
+		return p.execute(list)
+	}
+
+	return p.table(list)
+}
+
+// items returns the elements of records if it is a slice
+func items(records any) []any {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []any{records}
+	}
+
+	list := make([]any, 0, v.Len())
+	for i := range v.Len() {
+		list = append(list, v.Index(i).Interface())
+	}
+	return list
+}
+
+func (p *Printer) json(records any) error {
+	enc := json.NewEncoder(p.out())
+	enc.SetIndent("", "  ")
+
+	// nil slices are still an empty list
+	if records == nil || reflect.ValueOf(records).Kind() == reflect.Slice && reflect.ValueOf(records).IsNil() {
+		records = []any{}
+	}
+
+	err := enc.Encode(records)
+	if err != nil {
+		return fmt.Errorf("unable to marshal json: %w", err)
+	}
+	return nil
+}
+
+func (p *Printer) ndjson(list []any) error {
+	enc := json.NewEncoder(p.out())
+	for _, r := range list {
+		err := enc.Encode(r)
+		if err != nil {
+			return fmt.Errorf("unable to marshal json: %w", err)
+		}
+	}
+	return nil
+}
+
+// yaml goes by way of json, keeping field names and their order
+func (p *Printer) yaml(records any) error {
+	j, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("unable to marshal json: %w", err)
+	}
+
+	// json is yaml, but in flow style
+	var n yaml.Node
+	err = yaml.Unmarshal(j, &n)
+	if err != nil {
+		return fmt.Errorf("unable to convert to yaml: %w", err)
+	}
+	blockStyle(&n)
+
+	enc := yaml.NewEncoder(p.out())
+	enc.SetIndent(2)
+	err = enc.Encode(&n)
+	if err != nil {
+		return fmt.Errorf("unable to marshal yaml: %w", err)
+	}
+	return enc.Close()
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+func (p *Printer) csv(list []any) error {
+	columns, rows, err := tabulate(list)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(p.out())
+	w.Write(columns)
+	w.WriteAll(rows)
+
+	return w.Error()
+}
+
+func (p *Printer) table(list []any) error {
+	columns, rows, err := tabulate(list)
+	if err != nil {
+		return err
+	}
+
+	headers := make([]string, 0, len(columns))
+	for _, c := range columns {
+		headers = append(headers, strings.ToUpper(c))
+	}
+
+	w := tabwriter.NewWriter(p.out(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(w, strings.Join(r, "\t"))
+	}
+
+	return w.Flush()
+}
+
+func (p *Printer) execute(list []any) error {
+	out := p.out()
+	for _, r := range list {
+		v, err := generic(r)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		err = p.template.Execute(&buf, v)
+		if err != nil {
+			return fmt.Errorf("unable to execute template: %w", err)
+		}
+
+		// one record per line, unless the template says otherwise
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+
+		_, err = out.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generic returns the json representation of r as maps and slices
+func generic(r any) (any, error) {
+	p, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal json: %w", err)
+	}
+
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json: %w", err)
+	}
+
+	return v, nil
+}
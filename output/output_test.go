@@ -0,0 +1,216 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+type software struct {
+	Active string `json:"active"`
+	A      string `json:"A"`
+}
+
+type record struct {
+	Host     string   `json:"host"`
+	Version  string   `json:"version"`
+	Running  bool     `json:"running"`
+	Software software `json:"software"`
+	Addrs    []string `json:"addrs,omitempty"`
+}
+
+var records = []record{
+	{"10.0.0.1", "1.0", true, software{"A", "2.0.9.0"}, []string{"10.0.0.1", "fe80::1"}},
+	{"10.0.0.2", "1.10", false, software{"B", "2.0.10.0"}, nil},
+}
+
+func render(t *testing.T, format, text string, records any) string {
+	t.Helper()
+
+	p, err := New(format, text)
+	if err != nil {
+		t.Fatalf("unable to create printer: %s", err)
+	}
+
+	var buf bytes.Buffer
+	p.Out = &buf
+
+	err = p.Print(records)
+	if err != nil {
+		t.Fatalf("unable to print %s: %s", format, err)
+	}
+
+	return buf.String()
+}
+
+func TestJSON(t *testing.T) {
+	out := render(t, "json", "", records)
+
+	var decoded []record
+	err := json.Unmarshal([]byte(out), &decoded)
+	if err != nil {
+		t.Fatalf("expected a json array, got %s: %s", out, err)
+	}
+	if len(decoded) != 2 || decoded[1].Host != "10.0.0.2" {
+		t.Fatalf("unexpected records: %+v", decoded)
+	}
+
+	// no records is an empty list, not null
+	out = render(t, "json", "", []record(nil))
+	if strings.TrimSpace(out) != "[]" {
+		t.Fatalf("expected an empty list, got %s", out)
+	}
+
+	// a single record is just that
+	out = render(t, "json", "", records[0])
+	if !strings.HasPrefix(out, "{") {
+		t.Fatalf("expected an object, got %s", out)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	out := render(t, "ndjson", "", records)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per record, got:\n%s", out)
+	}
+
+	for _, l := range lines {
+		var r record
+		err := json.Unmarshal([]byte(l), &r)
+		if err != nil {
+			t.Fatalf("unable to unmarshal %s: %s", l, err)
+		}
+	}
+}
+
+func TestYAML(t *testing.T) {
+	out := render(t, "yaml", "", records)
+
+	expected := `- host: 10.0.0.1
+  version: "1.0"
+  running: true
+  software:
+    active: A
+    A: 2.0.9.0
+  addrs:
+    - 10.0.0.1
+    - fe80::1
+- host: 10.0.0.2
+  version: "1.10"
+  running: false
+  software:
+    active: B
+    A: 2.0.10.0
+`
+	if out != expected {
+		t.Fatalf("unexpected yaml, got:\n%s", out)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	out := render(t, "csv", "", records)
+
+	expected := `host,version,running,software.active,software.A,addrs.0,addrs.1
+10.0.0.1,1.0,true,A,2.0.9.0,10.0.0.1,fe80::1
+10.0.0.2,1.10,false,B,2.0.10.0,,
+`
+	if out != expected {
+		t.Fatalf("unexpected csv, got:\n%s", out)
+	}
+}
+
+func TestTable(t *testing.T) {
+	out := render(t, "table", "", records)
+
+	lines := strings.Split(out, "\n")
+	if !strings.HasPrefix(lines[0], "HOST      VERSION  RUNNING  SOFTWARE.ACTIVE") {
+		t.Fatalf("unexpected header: %q", lines[0])
+	}
+
+	// text falls back to a table
+	if render(t, "", "", records) != out {
+		t.Fatalf("expected text to be rendered as a table")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	out := render(t, "", `{{.host}} {{.software.active}} {{join .addrs ","}}`, records)
+
+	expected := "10.0.0.1 A 10.0.0.1,fe80::1\n10.0.0.2 B \n"
+	if out != expected {
+		t.Fatalf("unexpected output, got:\n%q", out)
+	}
+
+	// templates ending with a newline are left alone
+	out = render(t, "template", "{{.host}}\n", records)
+	if out != "10.0.0.1\n10.0.0.2\n" {
+		t.Fatalf("unexpected output, got:\n%q", out)
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	cases := []struct {
+		args   []string
+		format Format
+		fails  bool
+	}{
+		{[]string{}, Text, false},
+		{[]string{"--json"}, JSON, false},
+		{[]string{"-j", "-o", "json"}, JSON, false},
+		{[]string{"-o", "YAML"}, YAML, false},
+		{[]string{"--template", "{{.host}}"}, Template, false},
+		{[]string{"-o", "xml"}, "", true},
+		{[]string{"-j", "-o", "csv"}, "", true},
+		{[]string{"-o", "template"}, "", true},
+		{[]string{"-o", "csv", "--template", "{{.host}}"}, "", true},
+		{[]string{"--template", "{{.host"}, "", true},
+	}
+
+	for _, c := range cases {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		AddFlags(flags)
+
+		err := flags.Parse(c.args)
+		if err != nil {
+			t.Fatalf("%v: unable to parse: %s", c.args, err)
+		}
+
+		p, err := FromFlags(flags)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%v: expected an error", c.args)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", c.args, err)
+			continue
+		}
+
+		if p.Format != c.format {
+			t.Errorf("%v: expected %s, got %s", c.args, c.format, p.Format)
+		}
+	}
+}
+
+func TestRow(t *testing.T) {
+	rows := []Row{
+		{[]string{"zulu", "alpha", "usage"}, []any{"z", nil, 12.5}},
+	}
+
+	out := render(t, "csv", "", rows)
+	if out != "zulu,alpha,usage\nz,,12.5\n" {
+		t.Fatalf("unexpected csv, got:\n%s", out)
+	}
+
+	out = render(t, "ndjson", "", rows)
+	if out != `{"zulu":"z","alpha":null,"usage":12.5}`+"\n" {
+		t.Fatalf("unexpected json, got:\n%s", out)
+	}
+}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Row is a record of named values, unlike a map it keeps the
+// order of its columns in every format.
+type Row struct {
+	Columns []string
+	Values  []any
+}
+
+func (r Row) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range r.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if i < len(r.Values) {
+			value = r.Values[i]
+		}
+
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,270 @@
+// Package scan finds controllers by probing every address of a network
+// for the BSP REST API, for sites where multicast is blocked.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/mdns"
+	"golang.org/x/sync/errgroup"
+)
+
+// MaxAddresses limits the size of the networks scanned, a /16 is
+// already a lot of probing.
+const MaxAddresses = 1 << 16
+
+// ErrNotBSP is returned by probes of hosts that answer https,
+// but do not look like the BSP REST API.
+var ErrNotBSP = errors.New("not a bsp device")
+
+// Scanner probes networks for controllers. The probe is an unauthenticated
+// GET of /bsp/system/status, which must be refused with 401 Unauthorized,
+// followed by a login at /auth/login without credentials - which must be
+// refused with 403 Forbidden, like controllers refuse wrong passwords.
+//
+// No credentials are sent while probing, so certificates are not verified -
+// controllers usually have self-signed ones anyway. Once a controller is
+// found, Status is asked for its hostname, serial and software version.
+type Scanner struct {
+	Prefixes []netip.Prefix
+
+	// Port of the https endpoint, 443 if zero.
+	Port uint16
+
+	// Parallel is the number of hosts probed at once, 64 if zero.
+	Parallel int
+
+	// Timeout for probing a single host, 2 seconds if zero.
+	Timeout time.Duration
+
+	// Status fetches the status of controllers found, logging in to them
+	// the usual way. Controllers are found without it, with fewer details.
+	// It is given twice Timeout.
+	Status func(ctx context.Context, t mdns.Target) (*bsp.Device, error)
+}
+
+// ParsePrefixes parses networks in CIDR notation, single addresses are
+// accepted as well.
+func ParsePrefixes(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, v := range networks {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("unable to parse network: %w", err)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		p = p.Masked()
+		if size(p) > MaxAddresses {
+			return nil, fmt.Errorf("%s: network too large, at most %d addresses can be scanned", p, MaxAddresses)
+		}
+
+		prefixes = append(prefixes, p)
+	}
+
+	return prefixes, nil
+}
+
+func size(p netip.Prefix) uint64 {
+	hostBits := p.Addr().BitLen() - p.Bits()
+	if hostBits >= 64 {
+		return ^uint64(0)
+	}
+	return 1 << hostBits
+}
+
+// addresses returns the host addresses of p, leaving out the network
+// and broadcast addresses of ipv4 networks larger than /31.
+func addresses(p netip.Prefix) []netip.Addr {
+	addrs := make([]netip.Addr, 0, size(p))
+	for a := p.Addr(); p.Contains(a); a = a.Next() {
+		addrs = append(addrs, a)
+	}
+
+	if p.Addr().Is4() && p.Bits() < 31 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+
+	return addrs
+}
+
+func (s *Scanner) port() uint16 {
+	if s.Port == 0 {
+		return 443
+	}
+	return s.Port
+}
+
+func (s *Scanner) parallel() int {
+	if s.Parallel <= 0 {
+		return 64
+	}
+	return s.Parallel
+}
+
+func (s *Scanner) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return s.Timeout
+}
+
+// Run scans the networks, devices are emitted as Added events in the same
+// shape as found by mdns.Browser. The channel is closed once every address
+// has been probed, or ctx is cancelled.
+func (s *Scanner) Run(ctx context.Context) (chan mdns.Event, error) {
+	if len(s.Prefixes) == 0 {
+		return nil, fmt.Errorf("no networks to scan")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout: s.timeout(),
+			DisableKeepAlives:   true,
+		},
+		Timeout: s.timeout(),
+	}
+
+	events := make(chan mdns.Event)
+	go func() {
+		defer close(events)
+
+		var (
+			mu    sync.Mutex
+			found []*mdns.Target
+		)
+
+		g, ctx := errgroup.WithContext(ctx)
+		g.SetLimit(s.parallel())
+
+	scan:
+		for _, p := range s.Prefixes {
+			for _, addr := range addresses(p) {
+				if ctx.Err() != nil {
+					break scan
+				}
+
+				g.Go(func() error {
+					t, err := s.probe(ctx, client, addr)
+					if err != nil {
+						// most addresses are expected to fail
+						return nil
+					}
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					found = append(found, t)
+					targets := make([]*mdns.Target, len(found))
+					for i, v := range found {
+						c := *v
+						targets[i] = &c
+					}
+
+					select {
+					case events <- mdns.Event{Type: mdns.Added, Target: *t, Time: time.Now(), Targets: targets}:
+					case <-ctx.Done():
+					}
+					return nil
+				})
+			}
+		}
+
+		_ = g.Wait()
+	}()
+
+	return events, nil
+}
+
+// probe checks if addr is a controller, returning it as a target if so
+func (s *Scanner) probe(ctx context.Context, client *http.Client, addr netip.Addr) (*mdns.Target, error) {
+	host := net.JoinHostPort(addr.String(), strconv.Itoa(int(s.port())))
+
+	// every bsp endpoint but login requires a token
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+host+"/bsp/system/status", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http request: %w", host, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, fmt.Errorf("%s: %w", host, ErrNotBSP)
+	}
+
+	// a login bound to fail tells controllers apart from anything
+	// else refusing requests, without handing out credentials.
+	login, err := json.Marshal(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal login request: %w", err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "POST", "https://"+host+"/auth/login", bytes.NewReader(login))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http request: %w", host, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+	resp.Body.Close()
+
+	t := &mdns.Target{
+		Hostname: addr.String(),
+		Port:     s.port(),
+		Text:     map[string]string{},
+	}
+	if addr.Is4() {
+		t.IPv4 = []netip.Addr{addr}
+	} else {
+		t.IPv6 = []netip.Addr{addr}
+	}
+
+	if resp.StatusCode != http.StatusForbidden {
+		return nil, fmt.Errorf("%s: %w", host, ErrNotBSP)
+	}
+
+	if s.Status == nil {
+		return t, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*s.timeout())
+	defer cancel()
+
+	d, err := s.Status(ctx, *t)
+	if err != nil {
+		// we know it is a device, details are a bonus
+		return t, nil
+	}
+
+	t.Text["hostname"] = d.Hostname
+	t.Text["serial"] = d.Serial
+	t.Text["version"] = d.Software.ActiveVersion()
+
+	return t, nil
+}
@@ -0,0 +1,169 @@
+package scan
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/bsp/bsptest"
+	"github.com/deif/iectl/mdns"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"192.168.1.7/24", "10.0.0.1", "fd00::/120"})
+	if err != nil {
+		t.Fatalf("unable to parse: %s", err)
+	}
+
+	expected := []string{"192.168.1.0/24", "10.0.0.1/32", "fd00::/120"}
+	for i, p := range prefixes {
+		if p.String() != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], p)
+		}
+	}
+
+	_, err = ParsePrefixes([]string{"10.0.0.0/8"})
+	if err == nil {
+		t.Errorf("expected a /8 to be refused")
+	}
+
+	_, err = ParsePrefixes([]string{"not-a-network"})
+	if err == nil {
+		t.Errorf("expected an error parsing garbage")
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	addrs := addresses(netip.MustParsePrefix("192.168.1.0/30"))
+	if len(addrs) != 2 || addrs[0].String() != "192.168.1.1" || addrs[1].String() != "192.168.1.2" {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+
+	addrs = addresses(netip.MustParsePrefix("192.168.1.8/31"))
+	if len(addrs) != 2 {
+		t.Fatalf("a /31 has two usable addresses, got %v", addrs)
+	}
+
+	addrs = addresses(netip.MustParsePrefix("fd00::/126"))
+	if len(addrs) != 4 {
+		t.Fatalf("ipv6 has no broadcast, got %v", addrs)
+	}
+}
+
+// scan runs a scanner against the host:port of a test server
+func scan(t *testing.T, hostPort string, status func(context.Context, mdns.Target) (*bsp.Device, error)) []mdns.Event {
+	t.Helper()
+
+	addrPort := netip.MustParseAddrPort(hostPort)
+	s := Scanner{
+		Prefixes: []netip.Prefix{netip.PrefixFrom(addrPort.Addr(), 32)},
+		Port:     addrPort.Port(),
+		Status:   status,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := s.Run(ctx)
+	if err != nil {
+		t.Fatalf("unable to scan: %s", err)
+	}
+
+	found := make([]mdns.Event, 0)
+	for e := range events {
+		found = append(found, e)
+	}
+
+	return found
+}
+
+func TestScan(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	// details are fetched by whoever knows how to log in
+	var asked mdns.Target
+	events := scan(t, srv.Host(), func(ctx context.Context, target mdns.Target) (*bsp.Device, error) {
+		asked = target
+
+		e, err := srv.Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return bsp.New(e).Status(ctx)
+	})
+	if len(events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Type != mdns.Added || e.Target.Hostname != "127.0.0.1" || e.Target.Address(false) != srv.Host() {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	if asked.Address(true) != srv.Host() {
+		t.Fatalf("expected the status of %s to be asked for, got %s", srv.Host(), asked.Address(true))
+	}
+
+	if e.Target.Text["hostname"] != "iE250-0bad0c" || e.Target.Text["serial"] != "2300000001" || e.Target.Text["version"] != "2.0.9.0" {
+		t.Fatalf("expected details from status, got %+v", e.Target.Text)
+	}
+
+	if len(e.Targets) != 1 {
+		t.Fatalf("expected targets to hold everything found")
+	}
+}
+
+func TestScanWithoutStatus(t *testing.T) {
+	srv := bsptest.NewServer()
+	defer srv.Close()
+
+	// the device takes admin/admin, which is never tried
+	events := scan(t, srv.Host(), nil)
+	if len(events) != 1 {
+		t.Fatalf("a device should be found without logging in, got %d events", len(events))
+	}
+
+	if len(events[0].Target.Text) != 0 || srv.Logins() != 0 {
+		t.Fatalf("expected no details and no logins, got %+v after %d logins", events[0].Target.Text, srv.Logins())
+	}
+}
+
+func TestScanNotBSP(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	events := scan(t, srv.Listener.Addr().String(), nil)
+	if len(events) != 0 {
+		t.Fatalf("expected nothing to be found, got %+v", events)
+	}
+}
+
+func TestScanSendsNoCredentials(t *testing.T) {
+	// something refusing everything, which is not a device
+	var logins []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/login" {
+			p, _ := io.ReadAll(r.Body)
+			logins = append(logins, string(p))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	events := scan(t, srv.Listener.Addr().String(), nil)
+	if len(events) != 0 {
+		t.Fatalf("expected nothing to be found, got %+v", events)
+	}
+
+	if len(logins) != 1 || logins[0] != `{"username":"","password":""}` {
+		t.Fatalf("expected a single login without credentials, got %q", logins)
+	}
+}
@@ -1,9 +1,45 @@
 package target
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/deif/iectl/auth"
+)
 
 type Collection []Endpoint
 
+// Close releases the clients of every endpoint, stopping their
+// tokens from being refreshed.
+func (c Collection) Close() {
+	for _, e := range c {
+		auth.Close(e.Client)
+	}
+}
+
+// Authenticate logs in to every endpoint not logged in already, in
+// parallel. The error of each endpoint is prefixed by its hostname.
+func (c Collection) Authenticate() error {
+	errs := make([]error, len(c))
+
+	var wg sync.WaitGroup
+	for i, e := range c {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := auth.Authenticate(e.Client)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", e.Hostname, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 // An endpoint is a hostname and a suitable http client
 type Endpoint struct {
 	Hostname string
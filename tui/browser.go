@@ -1,49 +1,199 @@
 package tui
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/deif/iectl/bsp"
 	"github.com/deif/iectl/mdns"
 )
 
-func BrowserModel(u chan []*mdns.Target) *model {
+// StatusFunc fetches the status of a discovered device
+type StatusFunc func(ctx context.Context, t mdns.Target) (*bsp.Device, error)
+
+// BrowserModel lists the devices found on u. If status is not nil, it is
+// used to fetch the status of every device found, which is shown in the
+// details pane and can be filtered on.
+func BrowserModel(u chan mdns.Event, status StatusFunc) *model {
+	delegate := browserDelegate{list.NewDefaultDelegate()}
+
 	m := model{
 		spinner: spinner.New(spinner.WithSpinner(spinner.Meter)),
-		list:    list.New(make([]list.Item, 0), list.NewDefaultDelegate(), 0, 0),
+		list:    list.New(make([]list.Item, 0), delegate, 0, 0),
 		updates: u,
+		status:  status,
+		info:    make(map[string]*deviceInfo),
 	}
 
 	m.list.Title = "Devices"
+	m.list.StatusMessageLifetime = 2 * errorLifetime
+	m.list.Filter = filterHostnames
+	m.list.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{browserKeys.mark, browserKeys.all, browserKeys.choose}
+	}
+	m.list.AdditionalFullHelpKeys = m.list.AdditionalShortHelpKeys
 
 	return &m
 }
 
 func (m *model) mdnsUpdates() tea.Cmd {
 	return func() tea.Msg {
-		return <-m.updates
+		// a scan is done at some point, keep showing what was found
+		e, ok := <-m.updates
+		if !ok {
+			return nil
+		}
+		return e
 	}
 }
 
 var (
-	docStyle = lipgloss.NewStyle().Margin(1, 2)
+	docStyle    = lipgloss.NewStyle().Margin(1, 2)
+	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#D7263D", Dark: "#FF5F5F"})
+	markedColor = lipgloss.AdaptiveColor{Light: "#D75F00", Dark: "#FFAF5F"}
+	paneStyle   = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, false, false, true).BorderForeground(lipgloss.Color("#626262")).PaddingLeft(2)
 )
 
+var browserKeys = struct {
+	mark, all, choose key.Binding
+}{
+	mark:   key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "mark")),
+	all:    key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "mark all/none")),
+	choose: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "choose")),
+}
+
+// errorLifetime is roughly how often the browser repeats errors
+const errorLifetime = 5 * time.Second
+
+// statusTimeout is how long fetching the status of a device may take
+const statusTimeout = 10 * time.Second
+
+// paneMinWidth is the narrowest window the details pane is shown in
+const paneMinWidth = 80
+
 type item interface {
 	Title() string
 	Description() string
 	FilterValue() string
 }
 
+// deviceInfo is what has been fetched about a device, it outlives
+// the targets as every mdns event carries fresh copies.
+type deviceInfo struct {
+	status   *bsp.Device
+	err      error
+	fetching bool
+}
+
+type statusMsg struct {
+	hostname string
+	status   *bsp.Device
+	err      error
+}
+
+// browserItem is a device in the list
+type browserItem struct {
+	target *mdns.Target
+	info   *deviceInfo
+}
+
+// markPrefix is put in front of every title, filterHostnames
+// depends on it being the same length marked or not.
+const (
+	markPrefix   = "[x] "
+	unmarkPrefix = "[ ] "
+)
+
+func (i *browserItem) Title() string {
+	if i.target.Marked {
+		return markPrefix + i.target.Hostname
+	}
+	return unmarkPrefix + i.target.Hostname
+}
+
+func (i *browserItem) Description() string {
+	d := i.target.URL()
+	if i.info.status != nil {
+		d += fmt.Sprintf(" %s %s", i.info.status.Serial, i.info.status.Software.ActiveVersion())
+	}
+	return d
+}
+
+// FilterValue is everything known about the device, starting with the
+// hostname as that is what is highlighted.
+func (i *browserItem) FilterValue() string {
+	t := i.target
+	values := []string{t.Hostname, t.Interface}
+	for _, a := range append(slices.Clone(t.IPv4), t.IPv6...) {
+		values = append(values, a.String())
+	}
+	for _, k := range slices.Sorted(maps.Keys(t.Text)) {
+		values = append(values, fmt.Sprintf("%s=%s", k, t.Text[k]))
+	}
+
+	if s := i.info.status; s != nil {
+		values = append(values, s.Serial, s.Hostname,
+			s.Software.ActiveVersion(), s.Software.InactiveVersion())
+	}
+
+	return strings.Join(values, " ")
+}
+
+// filterHostnames is the default fuzzy filter, but only highlights
+// matches within the hostname - the rest of the filter value is not
+// part of the title.
+func filterHostnames(term string, values []string) []list.Rank {
+	ranks := list.DefaultFilter(term, values)
+	for i, r := range ranks {
+		hostname, _, _ := strings.Cut(values[r.Index], " ")
+
+		matched := make([]int, 0, len(r.MatchedIndexes))
+		for _, v := range r.MatchedIndexes {
+			if v < len(hostname) {
+				matched = append(matched, v+len(markPrefix))
+			}
+		}
+		ranks[i].MatchedIndexes = matched
+	}
+
+	return ranks
+}
+
+// browserDelegate colours the titles of marked devices
+type browserDelegate struct {
+	list.DefaultDelegate
+}
+
+func (d browserDelegate) Render(w io.Writer, m list.Model, index int, li list.Item) {
+	i, ok := li.(*browserItem)
+	if ok && i.target.Marked {
+		d.Styles.NormalTitle = d.Styles.NormalTitle.Foreground(markedColor)
+		d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(markedColor)
+	}
+
+	d.DefaultDelegate.Render(w, m, index, li)
+}
+
 type model struct {
 	list    list.Model
 	spinner spinner.Model
+	width   int
+
+	updates chan mdns.Event
 
-	updates chan []*mdns.Target
+	status StatusFunc
+	info   map[string]*deviceInfo
 
 	Selected []*mdns.Target
 }
@@ -55,6 +205,40 @@ func (m *model) Init() tea.Cmd {
 	)
 }
 
+// fetch fetches the status of t, if anyone knows how
+func (m *model) fetch(t mdns.Target) tea.Cmd {
+	info := m.info[t.Hostname]
+	if m.status == nil || info.fetching || info.status != nil {
+		return nil
+	}
+
+	info.fetching = true
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		defer cancel()
+
+		s, err := m.status(ctx, t)
+		return statusMsg{hostname: t.Hostname, status: s, err: err}
+	}
+}
+
+func (m *model) items() []*browserItem {
+	items := make([]*browserItem, 0, len(m.list.Items()))
+	for _, v := range m.list.Items() {
+		i, ok := v.(*browserItem)
+		if !ok {
+			panic(fmt.Sprintf("can't handle %T", v))
+		}
+		items = append(items, i)
+	}
+	return items
+}
+
+func (m *model) highlighted() *browserItem {
+	i, _ := m.list.SelectedItem().(*browserItem)
+	return i
+}
+
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
@@ -63,15 +247,18 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
-		if msg.String() == "enter" {
+
+		// while typing a filter, keys are part of it
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+
+		switch {
+		case key.Matches(msg, browserKeys.choose):
 			selected := make([]*mdns.Target, 0)
-			for _, v := range m.list.Items() {
-				t, ok := v.(*mdns.Target)
-				if !ok {
-					panic(fmt.Sprintf("can't handle %T", v))
-				}
-				if t.Marked {
-					selected = append(selected, t)
+			for _, i := range m.items() {
+				if i.target.Marked {
+					selected = append(selected, i.target)
 				}
 			}
 
@@ -84,34 +271,83 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// we reach here, if the user didnt mark any items
 			// in that case, we select the item that was selected.
-			s := m.list.SelectedItem()
-			t, ok := s.(*mdns.Target)
-			if !ok {
-				panic(fmt.Sprintf("can't handle %T", s))
+			i := m.highlighted()
+			if i == nil {
+				return m, nil
 			}
 
-			m.Selected = []*mdns.Target{t}
+			m.Selected = []*mdns.Target{i.target}
 			return m, tea.Quit
+		case key.Matches(msg, browserKeys.mark):
+			i := m.highlighted()
+			if i != nil {
+				i.target.Marked = !i.target.Marked
+			}
+			return m, nil
+		case key.Matches(msg, browserKeys.all):
+			// marks whatever is shown, unless all of it is marked already
+			visible := m.list.VisibleItems()
+			all := true
+			for _, v := range visible {
+				if !v.(*browserItem).target.Marked {
+					all = false
+					break
+				}
+			}
+
+			for _, v := range visible {
+				v.(*browserItem).target.Marked = !all
+			}
+			return m, nil
 		}
-		if msg.String() == " " {
-			s := m.list.SelectedItem()
-			t, ok := s.(*mdns.Target)
-			if !ok {
-				panic(fmt.Sprintf("can't handle %T", s))
+	case mdns.Event:
+		if msg.Type == mdns.Error {
+			// the browser retries in the background, the message is
+			// kept around for as long as the errors keep coming.
+			status := m.list.NewStatusMessage(errorStyle.Render(msg.Err.Error()))
+			return m, tea.Batch(status, m.mdnsUpdates())
+		}
+
+		// every update is a fresh copy of the targets,
+		// carry over whatever the user has marked.
+		marked := make(map[string]bool)
+		for _, i := range m.items() {
+			if i.target.Marked {
+				marked[i.target.Hostname] = true
 			}
-			t.Marked = !t.Marked
-			return m, cmd
 		}
-	case []*mdns.Target:
-		i := make([]list.Item, 0)
-		for _, v := range msg {
-			i = append(i, v)
+
+		cmds := []tea.Cmd{m.mdnsUpdates()}
+		items := make([]list.Item, 0)
+		for _, v := range msg.Targets {
+			v.Marked = marked[v.Hostname]
+
+			if m.info[v.Hostname] == nil {
+				m.info[v.Hostname] = &deviceInfo{}
+			}
+			cmds = append(cmds, m.fetch(*v))
+
+			items = append(items, &browserItem{target: v, info: m.info[v.Hostname]})
 		}
-		m.list.SetItems(i)
-		return m, m.mdnsUpdates()
+
+		cmds = append(cmds, m.list.SetItems(items))
+		return m, tea.Batch(cmds...)
+	case statusMsg:
+		info := m.info[msg.hostname]
+		info.fetching = false
+		info.status, info.err = msg.status, msg.err
+
+		// the filter value has changed, filter again
+		return m, m.list.SetItems(m.list.Items())
 	case tea.WindowSizeMsg:
 		h, v := docStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v)
+		m.width = msg.Width - h
+
+		width := m.width
+		if m.width >= paneMinWidth {
+			width = m.width * 3 / 5
+		}
+		m.list.SetSize(width, msg.Height-v)
 	case spinner.TickMsg:
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
@@ -121,7 +357,79 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// details describes the highlighted device
+func (m *model) details() string {
+	i := m.highlighted()
+	if i == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	line := func(label string, value any) {
+		fmt.Fprintf(&b, "%s %v\n", dimStyle.Render(fmt.Sprintf("%-10s", label)), value)
+	}
+
+	t := i.target
+	b.WriteString(headerStyle.Render(t.Hostname) + "\n")
+	b.WriteString(t.URL() + "\n\n")
+
+	if t.Interface != "" {
+		line("interface", t.Interface)
+	}
+	for _, a := range t.IPv4 {
+		line("ipv4", a)
+	}
+	for _, a := range t.IPv6 {
+		line("ipv6", a)
+	}
+	if t.Port != 0 {
+		line("port", t.Port)
+	}
+
+	if len(t.Text) > 0 {
+		b.WriteString("\n" + headerStyle.Render("TXT") + "\n")
+		for _, k := range slices.Sorted(maps.Keys(t.Text)) {
+			line(k, t.Text[k])
+		}
+	}
+
+	if m.status == nil {
+		return b.String()
+	}
+
+	b.WriteString("\n" + headerStyle.Render("Status") + "\n")
+	switch s := i.info.status; {
+	case i.info.err != nil:
+		b.WriteString(errorStyle.Render(i.info.err.Error()) + "\n")
+	case s == nil:
+		b.WriteString(dimStyle.Render("fetching...") + "\n")
+	default:
+		line("hostname", s.Hostname)
+		line("serial", s.Serial)
+		line("active", fmt.Sprintf("%s (%s)", s.Software.Active, s.Software.ActiveVersion()))
+		line("other", s.Software.InactiveVersion())
+	}
+
+	return b.String()
+}
+
 func (m *model) View() string {
+	marked := 0
+	for _, i := range m.items() {
+		if i.target.Marked {
+			marked++
+		}
+	}
+
 	m.list.Title = fmt.Sprintf("Looking for devices %s", m.spinner.View())
-	return docStyle.Render(m.list.View())
+	if marked > 0 {
+		m.list.Title += fmt.Sprintf(" - %d marked", marked)
+	}
+
+	if m.width < paneMinWidth {
+		return docStyle.Render(m.list.View())
+	}
+
+	pane := paneStyle.Width(m.width - m.list.Width() - 1).Render(m.details())
+	return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), pane))
 }
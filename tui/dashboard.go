@@ -0,0 +1,618 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/deif/iectl/bsp"
+	"github.com/deif/iectl/filter"
+	"github.com/deif/iectl/mdns"
+)
+
+// DeviceStatus is what the dashboard polls from every device
+type DeviceStatus struct {
+	Device *bsp.Device
+	SSH    bool
+	RDP    bool
+}
+
+// Dashboard is what the dashboard needs to know to reach devices, actions
+// left nil are not offered.
+type Dashboard struct {
+	// Poll fetches the status of t
+	Poll func(ctx context.Context, t mdns.Target) (DeviceStatus, error)
+
+	// Interval is the time between polls of a device
+	Interval time.Duration
+
+	// Version is the firmware version devices should run, those running
+	// something else have drifted. If empty, whatever most devices run
+	// is expected.
+	Version string
+
+	Restart func(ctx context.Context, t mdns.Target) error
+
+	// SSH returns a command opening ssh sessions to targets, the dashboard
+	// is back once it exits.
+	SSH func(targets []mdns.Target) (*exec.Cmd, error)
+
+	// Install installs the firmware file on targets, it has the
+	// terminal for itself while doing so.
+	Install func(targets []mdns.Target, file string) error
+}
+
+var (
+	driftStyle    = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#B58900", Dark: "#FFD75F"})
+	okStyle       = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#2E7D32", Dark: "#87D787"})
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+	headerStyle   = lipgloss.NewStyle().Bold(true)
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFDF5")).Background(lipgloss.Color("#25A065")).Padding(0, 1)
+	dashboardHelp = "↑/↓ move • space mark • a mark all/none • r restart • s ssh • i install firmware • u update now • q quit"
+)
+
+// device is a row of the dashboard
+type device struct {
+	target mdns.Target
+
+	// present is whether the device is currently announced
+	present bool
+
+	status  *DeviceStatus
+	err     error
+	polled  time.Time
+	polling bool
+
+	marked bool
+}
+
+// offline devices have left the network, or do not answer
+func (d *device) offline() bool {
+	return !d.present || d.err != nil
+}
+
+type (
+	pollTick  struct{}
+	polledMsg struct {
+		hostname string
+		status   DeviceStatus
+		err      error
+		time     time.Time
+	}
+	actionMsg struct {
+		action string
+		err    error
+	}
+)
+
+type dashboard struct {
+	Dashboard
+
+	updates chan mdns.Event
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	// devices are kept in the order they were found
+	devices []*device
+	cursor  int
+
+	spinner spinner.Model
+	width   int
+	height  int
+
+	message      string
+	messageError bool
+	messageTime  time.Time
+
+	// confirming is set while asking if marked devices should restart
+	confirming bool
+
+	// asking is set while asking for a firmware file
+	asking bool
+	input  textinput.Model
+}
+
+// DashboardModel shows the devices found on u, polling the status of
+// each of them every d.Interval.
+func DashboardModel(u chan mdns.Event, d Dashboard) *dashboard {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	input := textinput.New()
+	input.Prompt = "firmware file: "
+	input.Placeholder = "path to .raucb bundle"
+
+	if d.Interval <= 0 {
+		d.Interval = 10 * time.Second
+	}
+
+	return &dashboard{
+		Dashboard: d,
+		updates:   u,
+		ctx:       ctx,
+		cancel:    cancel,
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Meter)),
+		input:     input,
+	}
+}
+
+func (m *dashboard) mdnsUpdates() tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-m.updates
+		if !ok {
+			return nil
+		}
+		return e
+	}
+}
+
+func (m *dashboard) tick() tea.Cmd {
+	return tea.Tick(m.Interval, func(time.Time) tea.Msg { return pollTick{} })
+}
+
+func (m *dashboard) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, m.mdnsUpdates(), m.tick())
+}
+
+func (m *dashboard) find(hostname string) *device {
+	for _, d := range m.devices {
+		if d.target.Hostname == hostname {
+			return d
+		}
+	}
+	return nil
+}
+
+// poll fetches the status of d, unless it is already being fetched
+func (m *dashboard) poll(d *device) tea.Cmd {
+	if m.Poll == nil || d.polling || !d.present {
+		return nil
+	}
+	d.polling = true
+
+	t := d.target
+	ctx := m.ctx
+	timeout := m.Interval
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		s, err := m.Poll(ctx, t)
+		return polledMsg{t.Hostname, s, err, time.Now()}
+	}
+}
+
+func (m *dashboard) pollAll() tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(m.devices))
+	for _, d := range m.devices {
+		cmds = append(cmds, m.poll(d))
+	}
+	return tea.Batch(cmds...)
+}
+
+// selected returns the marked devices, or the highlighted one
+func (m *dashboard) selected() []*device {
+	marked := make([]*device, 0)
+	for _, d := range m.devices {
+		if d.marked {
+			marked = append(marked, d)
+		}
+	}
+
+	if len(marked) > 0 {
+		return marked
+	}
+
+	if m.cursor < len(m.devices) {
+		return []*device{m.devices[m.cursor]}
+	}
+
+	return nil
+}
+
+func targets(devices []*device) []mdns.Target {
+	t := make([]mdns.Target, 0, len(devices))
+	for _, d := range devices {
+		t = append(t, d.target)
+	}
+	return t
+}
+
+func (m *dashboard) notify(msg string, isError bool) {
+	m.message = msg
+	m.messageError = isError
+	m.messageTime = time.Now()
+}
+
+func (m *dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		return m.key(msg)
+
+	case mdns.Event:
+		if msg.Type == mdns.Error {
+			m.notify(msg.Err.Error(), true)
+			return m, m.mdnsUpdates()
+		}
+
+		d := m.find(msg.Target.Hostname)
+		if msg.Type == mdns.Removed {
+			// keep showing it, but as offline
+			if d != nil {
+				d.present = false
+			}
+			return m, m.mdnsUpdates()
+		}
+
+		if d == nil {
+			d = &device{}
+			m.devices = append(m.devices, d)
+		}
+		d.target = msg.Target
+		d.present = true
+
+		return m, tea.Batch(m.mdnsUpdates(), m.poll(d))
+
+	case pollTick:
+		return m, tea.Batch(m.pollAll(), m.tick())
+
+	case polledMsg:
+		d := m.find(msg.hostname)
+		if d == nil {
+			return m, nil
+		}
+
+		d.polling = false
+		d.err = msg.err
+		if msg.err == nil {
+			d.status = &msg.status
+			d.polled = msg.time
+		}
+		return m, nil
+
+	case actionMsg:
+		if msg.err != nil {
+			m.notify(fmt.Sprintf("%s: %s", msg.action, msg.err), true)
+		} else {
+			m.notify(msg.action+": done", false)
+		}
+
+		// whatever was done, it probably changed something
+		return m, m.pollAll()
+
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.Width = msg.Width - len(m.input.Prompt) - 1
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+func (m *dashboard) key(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		m.cancel()
+		return m, tea.Quit
+	}
+
+	if m.asking {
+		return m.askFirmware(msg)
+	}
+
+	if m.confirming {
+		m.confirming = false
+		if msg.String() != "y" {
+			m.notify("restart cancelled", false)
+			return m, nil
+		}
+		return m, m.restart(m.selected())
+	}
+
+	switch msg.String() {
+	case "q", "esc":
+		m.cancel()
+		return m, tea.Quit
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(m.devices)-1, 0))
+	case " ":
+		if m.cursor < len(m.devices) {
+			m.devices[m.cursor].marked = !m.devices[m.cursor].marked
+		}
+	case "a":
+		// mark everything, unless everything is marked
+		all := true
+		for _, d := range m.devices {
+			all = all && d.marked
+		}
+		for _, d := range m.devices {
+			d.marked = !all
+		}
+	case "u":
+		return m, m.pollAll()
+	case "r":
+		if m.Restart == nil || len(m.selected()) == 0 {
+			return m, nil
+		}
+		m.confirming = true
+	case "s":
+		return m, m.ssh(m.selected())
+	case "i":
+		if m.Install == nil || len(m.selected()) == 0 {
+			return m, nil
+		}
+		m.asking = true
+		m.input.Reset()
+		return m, m.input.Focus()
+	}
+
+	return m, nil
+}
+
+func (m *dashboard) restart(devices []*device) tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(devices))
+	for _, d := range devices {
+		t := d.target
+		cmds = append(cmds, func() tea.Msg {
+			err := m.Restart(m.ctx, t)
+			return actionMsg{"restart " + t.Hostname, err}
+		})
+	}
+
+	m.notify(fmt.Sprintf("restarting %d device(s)...", len(devices)), false)
+	return tea.Batch(cmds...)
+}
+
+func (m *dashboard) ssh(devices []*device) tea.Cmd {
+	if m.SSH == nil || len(devices) == 0 {
+		return nil
+	}
+
+	c, err := m.SSH(targets(devices))
+	if err != nil {
+		m.notify(err.Error(), true)
+		return nil
+	}
+
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return actionMsg{"ssh", err}
+	})
+}
+
+func (m *dashboard) askFirmware(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.asking = false
+		return m, nil
+	case "enter":
+		m.asking = false
+		m.input.Blur()
+
+		file := strings.TrimSpace(m.input.Value())
+		_, err := os.Stat(file)
+		if err != nil {
+			m.notify(fmt.Sprintf("install: %s", err), true)
+			return m, nil
+		}
+
+		t := targets(m.selected())
+		install := funcCommand(func() error { return m.Install(t, file) })
+		return m, tea.Exec(install, func(err error) tea.Msg {
+			return actionMsg{"install " + file, err}
+		})
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// funcCommand runs a function as if it was a process, handing it the terminal
+type funcCommand func() error
+
+func (f funcCommand) Run() error          { return f() }
+func (f funcCommand) SetStdin(io.Reader)  {}
+func (f funcCommand) SetStdout(io.Writer) {}
+func (f funcCommand) SetStderr(io.Writer) {}
+
+// expected returns the version devices should run
+func (m *dashboard) expected() string {
+	if m.Version != "" {
+		return m.Version
+	}
+
+	count := make(map[string]int)
+	for _, d := range m.devices {
+		if d.status != nil && d.status.Device != nil {
+			count[d.status.Device.Software.ActiveVersion()]++
+		}
+	}
+
+	// most common, ties go to the highest version
+	versions := slices.SortedFunc(maps.Keys(count), filter.Compare)
+	best := ""
+	for _, v := range versions {
+		if count[v] >= count[best] {
+			best = v
+		}
+	}
+
+	return best
+}
+
+func (d *device) drifted(expected string) bool {
+	if d.status == nil || d.status.Device == nil || expected == "" {
+		return false
+	}
+	return d.status.Device.Software.ActiveVersion() != expected
+}
+
+// columns of the dashboard, and their widths
+var dashboardColumns = []struct {
+	name  string
+	width int
+}{
+	{"", 2}, {"HOSTNAME", 24}, {"STATE", 8}, {"ACTIVE", 14}, {"OTHER", 12},
+	{"ROOTFS", 7}, {"DATA", 7}, {"SSH", 4}, {"RDP", 4}, {"SEEN", 0},
+}
+
+func row(cells ...string) string {
+	var b strings.Builder
+	for i, c := range cells {
+		w := dashboardColumns[i].width
+		if w == 0 {
+			b.WriteString(c)
+			continue
+		}
+		if len(c) >= w {
+			c = c[:w-1]
+		}
+		b.WriteString(c + strings.Repeat(" ", w-len(c)))
+	}
+	return b.String()
+}
+
+func usage(d *bsp.Device, path string) string {
+	mp, ok := d.Mountpoint(path)
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", mp.Usage())
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func (m *dashboard) deviceRow(d *device, expected string, highlighted bool) string {
+	mark := " "
+	if d.marked {
+		mark = "*"
+	}
+
+	state := "online"
+	switch {
+	case !d.present:
+		state = "gone"
+	case d.err != nil:
+		state = "offline"
+	case d.status == nil:
+		state = "..."
+	}
+
+	cells := []string{mark, d.target.Hostname, state, "-", "-", "-", "-", "-", "-", "never"}
+	if d.status != nil && d.status.Device != nil {
+		s := d.status.Device.Software
+		cells[3] = fmt.Sprintf("%s %s", s.Active, s.ActiveVersion())
+		cells[4] = s.InactiveVersion()
+		cells[5] = usage(d.status.Device, "/")
+		cells[6] = usage(d.status.Device, "/data")
+		cells[7] = onOff(d.status.SSH)
+		cells[8] = onOff(d.status.RDP)
+		cells[9] = time.Since(d.polled).Round(time.Second).String() + " ago"
+	}
+
+	if d.err != nil {
+		cells[9] = d.err.Error()
+	}
+
+	style := lipgloss.NewStyle()
+	switch {
+	case d.offline():
+		style = errorStyle
+	case d.drifted(expected):
+		style = driftStyle
+	case d.status != nil:
+		style = okStyle
+	}
+
+	if highlighted {
+		style = style.Reverse(true)
+	}
+
+	if m.width > 0 {
+		style = style.MaxWidth(m.width)
+	}
+
+	return style.Render(row(cells...))
+}
+
+func (m *dashboard) View() string {
+	expected := m.expected()
+
+	var offline, drifted int
+	for _, d := range m.devices {
+		if d.offline() {
+			offline++
+		} else if d.drifted(expected) {
+			drifted++
+		}
+	}
+
+	var b strings.Builder
+	title := fmt.Sprintf("iectl dashboard %s", m.spinner.View())
+	fmt.Fprintf(&b, "%s  %d device(s), %s, %s", titleStyle.Render(title), len(m.devices),
+		errorStyle.Render(fmt.Sprintf("%d offline", offline)),
+		driftStyle.Render(fmt.Sprintf("%d drifted", drifted)))
+	if expected != "" {
+		fmt.Fprintf(&b, " from %s", expected)
+	}
+	b.WriteString("\n\n")
+
+	headers := make([]string, 0, len(dashboardColumns))
+	for _, c := range dashboardColumns {
+		headers = append(headers, c.name)
+	}
+	b.WriteString(headerStyle.Render(row(headers...)) + "\n")
+
+	// keep the cursor in view, leaving room for the header and footer
+	visible := len(m.devices)
+	if m.height > 0 {
+		visible = max(m.height-7, 1)
+	}
+	first := max(0, m.cursor-visible+1)
+
+	if len(m.devices) == 0 {
+		b.WriteString(dimStyle.Render("  looking for devices...") + "\n")
+	}
+
+	for i := first; i < len(m.devices) && i < first+visible; i++ {
+		b.WriteString(m.deviceRow(m.devices[i], expected, i == m.cursor) + "\n")
+	}
+
+	b.WriteString("\n")
+	switch {
+	case m.asking:
+		b.WriteString(m.input.View())
+	case m.confirming:
+		fmt.Fprintf(&b, "restart %d device(s)? y/n", len(m.selected()))
+	case m.message != "" && time.Since(m.messageTime) < 2*errorLifetime:
+		if m.messageError {
+			b.WriteString(errorStyle.Render(m.message))
+		} else {
+			b.WriteString(m.message)
+		}
+	default:
+		b.WriteString(dimStyle.Render(dashboardHelp))
+	}
+
+	return b.String()
+}